@@ -0,0 +1,156 @@
+// Package admission implements the parts of the Kubernetes admission.k8s.io/v1
+// API used by validating admission webhooks, and extracts the container
+// images of the workloads they review.
+package admission
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+const (
+	APIVersion = "admission.k8s.io/v1"
+	Kind       = "AdmissionReview"
+
+	OperationCreate = "CREATE"
+	OperationUpdate = "UPDATE"
+)
+
+var (
+	ErrInvalidReview       = errors.New("invalid AdmissionReview")
+	ErrUnsupportedResource = errors.New("unsupported resource kind")
+)
+
+// Review is an AdmissionReview, which holds the request sent to the webhook
+// and the webhook's response.
+type Review struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Request    *Request  `json:"request,omitempty"`
+	Response   *Response `json:"response,omitempty"`
+}
+
+// Request is the admission request for an operation on an object.
+type Request struct {
+	UID       string           `json:"uid"`
+	Kind      GroupVersionKind `json:"kind"`
+	Namespace string           `json:"namespace,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	Operation string           `json:"operation"`
+	Object    json.RawMessage  `json:"object,omitempty"`
+}
+
+// GroupVersionKind identifies the kind of an object.
+type GroupVersionKind struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+}
+
+// Response is the webhook's decision for an admission request.
+type Response struct {
+	UID     string  `json:"uid"`
+	Allowed bool    `json:"allowed"`
+	Status  *Status `json:"status,omitempty"`
+}
+
+// Status records why a request was not allowed.
+type Status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Parse decodes an AdmissionReview holding a request.
+func Parse(data []byte) (*Review, error) {
+	review := &Review{}
+	if err := json.Unmarshal(data, review); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidReview, err)
+	}
+	if review.APIVersion != APIVersion || review.Kind != Kind {
+		return nil, fmt.Errorf("%w: expected %s %s, got %s %s", ErrInvalidReview, APIVersion, Kind, review.APIVersion, review.Kind)
+	}
+	if review.Request == nil || review.Request.UID == "" {
+		return nil, fmt.Errorf("%w: request is not set", ErrInvalidReview)
+	}
+	return review, nil
+}
+
+// NewResponse creates the AdmissionReview responding to the review's request.
+// A message is only recorded if the request is not allowed.
+func NewResponse(review *Review, allowed bool, message string) *Review {
+	response := &Response{UID: review.Request.UID, Allowed: allowed}
+	if !allowed {
+		response.Status = &Status{Code: 403, Message: message}
+	}
+	return &Review{APIVersion: APIVersion, Kind: Kind, Response: response}
+}
+
+type container struct {
+	Image string `json:"image"`
+}
+
+type podSpec struct {
+	Containers          []container `json:"containers"`
+	InitContainers      []container `json:"initContainers"`
+	EphemeralContainers []container `json:"ephemeralContainers"`
+}
+
+type podTemplate struct {
+	Spec podSpec `json:"spec"`
+}
+
+/*
+Images returns the images of the containers of the object in the request,
+which must be a Pod or a workload that creates Pods from a template: a
+Deployment, ReplicaSet, StatefulSet, DaemonSet, Job, or CronJob. Each image is
+returned once, in the order it first appears.
+*/
+func (r *Request) Images() ([]string, error) {
+	var spec podSpec
+	switch r.Kind.Kind {
+	case "Pod":
+		pod := &podTemplate{}
+		if err := json.Unmarshal(r.Object, pod); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidReview, err)
+		}
+		spec = pod.Spec
+	case "Deployment", "ReplicaSet", "StatefulSet", "DaemonSet", "Job":
+		workload := &struct {
+			Spec struct {
+				Template podTemplate `json:"template"`
+			} `json:"spec"`
+		}{}
+		if err := json.Unmarshal(r.Object, workload); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidReview, err)
+		}
+		spec = workload.Spec.Template.Spec
+	case "CronJob":
+		cronJob := &struct {
+			Spec struct {
+				JobTemplate struct {
+					Spec struct {
+						Template podTemplate `json:"template"`
+					} `json:"spec"`
+				} `json:"jobTemplate"`
+			} `json:"spec"`
+		}{}
+		if err := json.Unmarshal(r.Object, cronJob); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidReview, err)
+		}
+		spec = cronJob.Spec.JobTemplate.Spec.Template.Spec
+	default:
+		return nil, fmt.Errorf("%w '%s'", ErrUnsupportedResource, r.Kind.Kind)
+	}
+
+	images := []string{}
+	for _, containers := range [][]container{spec.InitContainers, spec.Containers, spec.EphemeralContainers} {
+		for _, c := range containers {
+			if c.Image != "" && !slices.Contains(images, c.Image) {
+				images = append(images, c.Image)
+			}
+		}
+	}
+	return images, nil
+}
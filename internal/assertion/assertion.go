@@ -0,0 +1,198 @@
+// Package assertion evaluates CEL expressions over verified DSSE envelopes.
+// Expressions have access to the decoded payload, the payload type, and the
+// signers whose signatures were verified. See https://cel.dev.
+package assertion
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/adityasaky/essd/internal/key"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter"
+	"github.com/google/cel-go/parser"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// VarPayload is the decoded payload. JSON payloads are available as
+	// structured values, other payloads as a string.
+	VarPayload = "payload"
+	// VarPayloadType is the payload type of the envelope.
+	VarPayloadType = "payloadType"
+	// VarSigners is the list of signers whose signatures were verified. Each
+	// signer is a map with the keys keyid, name, identity, and issuer. The
+	// identity and issuer are only set for Sigstore signers.
+	VarSigners = "signers"
+)
+
+var ErrInvalidAssertion = errors.New("invalid assertion")
+
+// Error is returned when an assertion does not hold for an envelope.
+type Error struct {
+	Expression string
+	Reason     string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("assertion '%s' failed: %s", e.Expression, e.Reason)
+}
+
+// Input is what assertions are evaluated over.
+type Input struct {
+	PayloadType string
+	Payload     []byte
+	Signers     []key.VerifiedSigner
+}
+
+func (i *Input) activation() map[string]any {
+	var payload any
+	if err := json.Unmarshal(i.Payload, &payload); err != nil {
+		payload = string(i.Payload)
+	}
+
+	signers := []map[string]string{}
+	for _, signer := range i.Signers {
+		signers = append(signers, map[string]string{
+			"keyid":    signer.KeyID,
+			"name":     signer.Name,
+			"identity": signer.Identity,
+			"issuer":   signer.Issuer,
+		})
+	}
+
+	return map[string]any{
+		VarPayload:     payload,
+		VarPayloadType: i.PayloadType,
+		VarSigners:     signers,
+	}
+}
+
+// Assertion is a compiled CEL expression that must evaluate to true.
+type Assertion struct {
+	expression string
+	ast        *cel.Ast
+	program    cel.Program
+}
+
+// Compile parses and type checks the expression, which must evaluate to a
+// boolean.
+func Compile(expression string) (*Assertion, error) {
+	env, err := cel.NewEnv(
+		cel.Variable(VarPayload, cel.DynType),
+		cel.Variable(VarPayloadType, cel.StringType),
+		cel.Variable(VarSigners, cel.ListType(cel.MapType(cel.StringType, cel.StringType))),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	checked, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("%w '%s': %w", ErrInvalidAssertion, expression, issues.Err())
+	}
+	if checked.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("%w '%s': evaluates to %s, expected bool", ErrInvalidAssertion, expression, checked.OutputType())
+	}
+
+	program, err := env.Program(checked, cel.EvalOptions(cel.OptTrackState))
+	if err != nil {
+		return nil, fmt.Errorf("%w '%s': %w", ErrInvalidAssertion, expression, err)
+	}
+
+	return &Assertion{expression: expression, ast: checked, program: program}, nil
+}
+
+// String returns the assertion's expression.
+func (a *Assertion) String() string {
+	return a.expression
+}
+
+// Evaluate checks that the assertion holds for the input. If it does not, an
+// *Error is returned that reports the values of the parts of the expression
+// that made it false.
+func (a *Assertion) Evaluate(input *Input) error {
+	out, details, err := a.program.Eval(input.activation())
+	if err != nil {
+		return &Error{Expression: a.expression, Reason: err.Error()}
+	}
+
+	if holds, isBool := out.Value().(bool); isBool && holds {
+		return nil
+	}
+
+	reason := "evaluated to false"
+	if details != nil {
+		nativeAST := a.ast.NativeRep()
+		values := explain(ast.NavigateAST(nativeAST), nativeAST.SourceInfo(), details.State())
+		if len(values) > 0 {
+			reason = fmt.Sprintf("%s with %s", reason, strings.Join(values, ", "))
+		}
+	}
+	return &Error{Expression: a.expression, Reason: reason}
+}
+
+// explain returns the values of the operands of the terms that made the
+// expression false. Conjunctions and disjunctions are broken down into the
+// terms that evaluated to false.
+func explain(expr ast.NavigableExpr, info *ast.SourceInfo, state interpreter.EvalState) []string {
+	if expr.Kind() == ast.CallKind {
+		switch expr.AsCall().FunctionName() {
+		case operators.LogicalAnd, operators.LogicalOr:
+			values := []string{}
+			for _, arg := range expr.Children() {
+				if value, known := state.Value(arg.ID()); known && value.Value() == false {
+					values = append(values, explain(arg, info, state)...)
+				}
+			}
+			return values
+		case operators.LogicalNot:
+			return explain(expr.Children()[0], info, state)
+		}
+	}
+
+	operands := []ast.NavigableExpr{expr}
+	switch expr.Kind() {
+	case ast.CallKind:
+		operands = expr.Children()
+	case ast.ComprehensionKind:
+		operands = []ast.NavigableExpr{expr.AsComprehension().IterRange().(ast.NavigableExpr)}
+	}
+
+	values := []string{}
+	for _, operand := range operands {
+		if operand.Kind() == ast.LiteralKind {
+			continue
+		}
+		value, known := state.Value(operand.ID())
+		if !known {
+			continue
+		}
+		unparsed, err := parser.Unparse(operand, info)
+		if err != nil {
+			continue
+		}
+		values = append(values, fmt.Sprintf("%s = %s", unparsed, formatValue(value)))
+	}
+	return values
+}
+
+// formatValue renders a CEL value as JSON where possible.
+func formatValue(value ref.Val) string {
+	native, err := value.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+	if err == nil {
+		if jsonValue, isJSON := native.(*structpb.Value); isJSON {
+			valueBytes, err := json.Marshal(jsonValue.AsInterface())
+			if err == nil {
+				return string(valueBytes)
+			}
+		}
+	}
+	return fmt.Sprintf("%v", value)
+}
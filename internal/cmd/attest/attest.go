@@ -0,0 +1,137 @@
+package attest
+
+import (
+	"github.com/adityasaky/essd/internal/cmd/common"
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/intoto"
+	ita1 "github.com/in-toto/attestation/go/v1"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	signerOptions            common.SignerOptions
+	payloadValidationOptions common.PayloadValidationOptions
+	predicateOptions         common.PredicateOptions
+	formatOptions            common.FormatOptions
+
+	subjects         []string
+	digestAlgorithms []string
+
+	outputPath string
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	o.signerOptions.AddFlags(cmd)
+	o.payloadValidationOptions.AddFlags(cmd)
+
+	cmd.Flags().StringArrayVarP(
+		&o.subjects,
+		"subject",
+		"s",
+		nil,
+		"path of artifact to record as subject of the statement",
+	)
+	cmd.MarkFlagRequired("subject") //nolint:errcheck
+
+	cmd.Flags().StringSliceVar(
+		&o.digestAlgorithms,
+		"digest",
+		[]string{intoto.DigestSHA256},
+		"digest algorithms to record for subjects (sha256, sha512)",
+	)
+
+	o.predicateOptions.AddFlags(cmd)
+
+	cmd.Flags().StringVarP(
+		&o.outputPath,
+		"output",
+		"o",
+		"",
+		"output path to write envelope (\"-\" for stdout)",
+	)
+	cmd.MarkFlagRequired("output") //nolint:errcheck
+
+	o.formatOptions.AddFlags(cmd)
+}
+
+func (o *options) Run(cmd *cobra.Command, _ []string) error {
+	format, err := o.formatOptions.GetFormat(dsse.FormatJSON)
+	if err != nil {
+		return err
+	}
+	if err := o.signerOptions.CheckFormat(format); err != nil {
+		return err
+	}
+
+	subjects := []*ita1.ResourceDescriptor{}
+	for _, subjectPath := range o.subjects {
+		subject, err := intoto.NewSubjectFromFile(subjectPath, o.digestAlgorithms)
+		if err != nil {
+			return err
+		}
+		subjects = append(subjects, subject)
+	}
+
+	predicateType, predicate, err := o.predicateOptions.GetPredicate()
+	if err != nil {
+		return err
+	}
+
+	statement, err := intoto.NewStatement(subjects, predicateType, predicate)
+	if err != nil {
+		return err
+	}
+
+	registry, err := o.payloadValidationOptions.GetRegistry()
+	if err != nil {
+		return err
+	}
+
+	signer, err := o.signerOptions.GetSigner(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	env, err := common.SignStatement(cmd.Context(), statement, registry, signer)
+	if err != nil {
+		return err
+	}
+
+	return common.WriteEnvelope(o.outputPath, env, format)
+}
+
+func New() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:   "attest",
+		Short: "Create signed in-toto attestation for the specified subjects",
+		Long: `Create signed in-toto attestation for the specified subjects.
+
+The predicate is either read from a JSON file using --predicate, or generated as
+SLSA v1.0 provenance from a JSON build description using --provenance. The
+build description supports the following fields:
+
+  builderId             ID of the builder (required)
+  builderVersion        map of builder component names to versions
+  buildType             URI of the build type (required)
+  externalParameters    object with the build's external parameters (required)
+  internalParameters    object with the build's internal parameters
+  dependencies          paths of files recorded as resolved dependencies
+  goSum                 path of go.sum whose modules are resolved dependencies
+  resolvedDependencies  in-toto resource descriptors of other dependencies
+  invocationId          ID of the build invocation
+  startedOn             RFC 3339 timestamp of when the build started
+  finishedOn            RFC 3339 timestamp of when the build finished, the
+                        current time is used if unset
+
+The statement is validated before it is signed, including predicates of known
+types such as https://slsa.dev/provenance/v1 and predicates of types for which a
+schema is specified using --predicate-schema.`,
+		Args:              cobra.NoArgs,
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
@@ -1,11 +1,9 @@
 package cat
 
 import (
-	"encoding/json"
 	"fmt"
-	"os"
 
-	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/cmd/common"
 	"github.com/spf13/cobra"
 )
 
@@ -15,6 +13,8 @@ type options struct {
 	payloadTypeOnly bool
 
 	decodeBase64 bool
+
+	filterOptions common.BundleFilterOptions
 }
 
 func (o *options) AddFlags(cmd *cobra.Command) {
@@ -50,6 +50,8 @@ func (o *options) AddFlags(cmd *cobra.Command) {
 		false,
 		"base64 decode payload",
 	)
+
+	o.filterOptions.AddFlags(cmd)
 }
 
 func (o *options) Run(_ *cobra.Command, args []string) error {
@@ -70,15 +72,8 @@ func (o *options) Run(_ *cobra.Command, args []string) error {
 }
 
 func (o *options) printSummary(args []string) error {
-	for _, envPath := range args {
-		envBytes, err := os.ReadFile(envPath)
-		if err != nil {
-			return err
-		}
-		env := &dsse.Envelope{}
-		if err := json.Unmarshal(envBytes, env); err != nil {
-			return err
-		}
+	return o.forEachEnvelope(args, func(file *common.EnvelopeFile, i int) error {
+		env := file.Envelopes[i]
 
 		signatureKeyIDs := []string{}
 		signaturesWithoutKeyIDs := 0
@@ -90,7 +85,8 @@ func (o *options) printSummary(args []string) error {
 			}
 		}
 
-		fmt.Printf("Summary for %s:\n", envPath)
+		fmt.Printf("Summary for %s:\n", file.Name(i))
+		fmt.Printf("\tFormat: %s\n", file.Format)
 		fmt.Printf("\tPayload Type: %s\n", env.PayloadType)
 		fmt.Printf("\tSignatures without key IDs: %d\n", signaturesWithoutKeyIDs)
 		if len(signatureKeyIDs) > 0 {
@@ -99,21 +95,13 @@ func (o *options) printSummary(args []string) error {
 				fmt.Printf("\t\t%s\n", keyID)
 			}
 		}
-	}
-
-	return nil
+		return nil
+	})
 }
 
 func (o *options) printPayload(args []string, decodeBase64 bool) error {
-	for _, envPath := range args {
-		envBytes, err := os.ReadFile(envPath)
-		if err != nil {
-			return err
-		}
-		env := &dsse.Envelope{}
-		if err := json.Unmarshal(envBytes, env); err != nil {
-			return err
-		}
+	return o.forEachEnvelope(args, func(file *common.EnvelopeFile, i int) error {
+		env := file.Envelopes[i]
 		if decodeBase64 {
 			decodedBytes, err := env.DecodeB64Payload()
 			if err != nil {
@@ -123,21 +111,32 @@ func (o *options) printPayload(args []string, decodeBase64 bool) error {
 		} else {
 			fmt.Println(env.Payload)
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
 func (o *options) printPayloadType(args []string) error {
-	for _, envPath := range args {
-		envBytes, err := os.ReadFile(envPath)
+	return o.forEachEnvelope(args, func(file *common.EnvelopeFile, i int) error {
+		fmt.Println(file.Envelopes[i].PayloadType)
+		return nil
+	})
+}
+
+// forEachEnvelope calls fn for each envelope in the files at paths that
+// matches the filters. Bundles can hold any number of envelopes, so no
+// envelope matching is not an error.
+func (o *options) forEachEnvelope(paths []string, fn func(*common.EnvelopeFile, int) error) error {
+	for _, envPath := range paths {
+		file, err := common.ReadEnvelopes(envPath)
 		if err != nil {
 			return err
 		}
-		env := &dsse.Envelope{}
-		if err := json.Unmarshal(envBytes, env); err != nil {
-			return err
+
+		for _, i := range o.filterOptions.Selected(file) {
+			if err := fn(file, i); err != nil {
+				return err
+			}
 		}
-		fmt.Println(env.PayloadType)
 	}
 
 	return nil
@@ -146,8 +145,15 @@ func (o *options) printPayloadType(args []string) error {
 func New() *cobra.Command {
 	o := &options{}
 	cmd := &cobra.Command{
-		Use:               "cat",
-		Short:             "Concatenate specified parts of DSSE envelope",
+		Use:   "cat",
+		Short: "Concatenate specified parts of DSSE envelope",
+		Long: `Concatenate specified parts of DSSE envelope. An envelope is read from stdin if its path is "-".
+
+Paths can also refer to in-toto attestation bundles, JSON Lines files with one
+JSON envelope per line, conventionally with the .intoto.jsonl extension. The
+specified parts of each envelope in the bundle are concatenated. Envelopes can
+be selected by payload type using --filter-payload-type, and by the predicate
+type of their in-toto statements using --filter-predicate-type.`,
 		Args:              cobra.MinimumNArgs(1),
 		RunE:              o.Run,
 		DisableAutoGenTag: true,
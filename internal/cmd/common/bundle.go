@@ -0,0 +1,127 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/intoto"
+	"github.com/spf13/cobra"
+)
+
+var ErrNoEnvelopeMatched = errors.New("no envelope matched the filters")
+
+// EnvelopeFile holds the envelopes read from a file, which is either a single
+// envelope or an in-toto attestation bundle.
+type EnvelopeFile struct {
+	Path      string
+	Envelopes []*dsse.Envelope
+	Format    dsse.Format
+	IsBundle  bool
+}
+
+// Name returns the name used to refer to the i-th envelope of the file in
+// reports.
+func (f *EnvelopeFile) Name(i int) string {
+	if !f.IsBundle {
+		return DisplayName(f.Path)
+	}
+	return fmt.Sprintf("%s (envelope %d)", DisplayName(f.Path), i+1)
+}
+
+// ReadEnvelopes reads the envelopes at path, or from standard input if path is
+// "-". Files with the .intoto.jsonl or .jsonl extensions are read as bundles.
+// Other files are read as a single envelope in any supported format, or as a
+// bundle if they are not one.
+func ReadEnvelopes(path string) (*EnvelopeFile, error) {
+	data, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseEnvelopes(path, data)
+}
+
+// ParseEnvelopes parses the envelopes read from path like ReadEnvelopes.
+func ParseEnvelopes(path string, data []byte) (*EnvelopeFile, error) {
+	if !intoto.IsBundlePath(path) {
+		env, format, err := dsse.Unmarshal(data)
+		if err == nil {
+			return &EnvelopeFile{Path: path, Envelopes: []*dsse.Envelope{env}, Format: format}, nil
+		}
+
+		envelopes, bundleErr := intoto.ParseBundle(data)
+		if bundleErr != nil {
+			// The file is most likely meant to be a single envelope
+			return nil, fmt.Errorf("unable to parse envelope '%s': %w", DisplayName(path), err)
+		}
+		return &EnvelopeFile{Path: path, Envelopes: envelopes, Format: dsse.FormatJSON, IsBundle: true}, nil
+	}
+
+	envelopes, err := intoto.ParseBundle(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse bundle '%s': %w", DisplayName(path), err)
+	}
+	return &EnvelopeFile{Path: path, Envelopes: envelopes, Format: dsse.FormatJSON, IsBundle: true}, nil
+}
+
+// WriteBundle writes the envelopes as an in-toto attestation bundle to the
+// file at path, or standard output if path is "-".
+func WriteBundle(path string, envelopes []*dsse.Envelope) error {
+	bundle, err := intoto.MarshalBundle(envelopes)
+	if err != nil {
+		return err
+	}
+
+	if path == StdioPath {
+		// Bundles already end with a newline
+		_, err := os.Stdout.Write(bundle)
+		return err
+	}
+	return os.WriteFile(path, bundle, 0o644)
+}
+
+// BundleFilterOptions holds the flags used to select envelopes of bundles by
+// payload type and in-toto predicate type.
+type BundleFilterOptions struct {
+	PayloadTypes   []string
+	PredicateTypes []string
+}
+
+func (o *BundleFilterOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(
+		&o.PayloadTypes,
+		"filter-payload-type",
+		nil,
+		"only use envelopes with the payload type",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&o.PredicateTypes,
+		"filter-predicate-type",
+		nil,
+		"only use envelopes with in-toto statements of the predicate type",
+	)
+}
+
+// IsSet returns true if any filter was specified.
+func (o *BundleFilterOptions) IsSet() bool {
+	return len(o.PayloadTypes) > 0 || len(o.PredicateTypes) > 0
+}
+
+// Selected returns the indices of the file's envelopes that match the
+// filters. All envelopes are selected if no filter was specified.
+func (o *BundleFilterOptions) Selected(file *EnvelopeFile) []int {
+	filter := &intoto.BundleFilter{
+		PayloadTypes:   o.PayloadTypes,
+		PredicateTypes: o.PredicateTypes,
+	}
+
+	selected := []int{}
+	for i, env := range file.Envelopes {
+		if filter.Match(env) {
+			selected = append(selected, i)
+		}
+	}
+	return selected
+}
@@ -0,0 +1,147 @@
+package common
+
+import (
+	"maps"
+	"os"
+
+	"github.com/adityasaky/essd/internal/config"
+	"github.com/adityasaky/essd/internal/sigstore"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	configEnvVariable  = config.EnvPrefix + "CONFIG"
+	profileEnvVariable = config.EnvPrefix + "PROFILE"
+)
+
+// SkipConfigAnnotation is the annotation of commands whose flags are not set
+// from the configuration before they run, such as commands that read the
+// configuration themselves.
+const SkipConfigAnnotation = "essd/skip-config"
+
+// ConfigOptions holds the root command's persistent flags that select the
+// configuration and the Sigstore instance.
+type ConfigOptions struct {
+	ConfigPath string
+	Profile    string
+
+	Sigstore sigstore.Instance
+}
+
+func (o *ConfigOptions) AddFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(
+		&o.ConfigPath,
+		"config",
+		"",
+		"path of configuration file (default: $"+configEnvVariable+", or $XDG_CONFIG_HOME/essd/config.yaml)",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&o.Profile,
+		"profile",
+		"",
+		"configuration profile to use (default: $"+profileEnvVariable+")",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&o.Sigstore.FulcioURL,
+		"sigstore-fulcio-url",
+		sigstore.DefaultInstance.FulcioURL,
+		"URL of Fulcio instance to request Sigstore signing certificates from",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&o.Sigstore.RekorURL,
+		"sigstore-rekor-url",
+		sigstore.DefaultInstance.RekorURL,
+		"URL of Rekor instance to record Sigstore signatures in",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&o.Sigstore.OIDCIssuerURL,
+		"sigstore-oidc-issuer",
+		sigstore.DefaultInstance.OIDCIssuerURL,
+		"URL of OIDC issuer to authenticate with when signing with Sigstore",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&o.Sigstore.OIDCClientID,
+		"sigstore-oidc-client-id",
+		sigstore.DefaultInstance.OIDCClientID,
+		"OIDC client ID to authenticate with when signing with Sigstore",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&o.Sigstore.TrustedRootPath,
+		"sigstore-trusted-root",
+		"",
+		"path of trusted root of Sigstore instance in trusted_root.json format (default: public-good instance's root, fetched using TUF)",
+	)
+}
+
+/*
+Load reads the configuration and sets the flags of cmd, the command being
+executed, that are not specified on the command line to the values set by
+environment variables or the configuration file. The Sigstore instance is then
+configured using the resulting flags.
+*/
+func (o *ConfigOptions) Load(cmd *cobra.Command) error {
+	file, profile, err := o.Read(cmd.Root())
+	if err != nil {
+		return err
+	}
+
+	settings, err := ResolveSettings(file, config.Flags(cmd), config.SectionPath(cmd), profile)
+	if err != nil {
+		return err
+	}
+	if err := config.Apply(cmd, settings); err != nil {
+		return err
+	}
+
+	sigstore.Configure(o.Sigstore)
+	return nil
+}
+
+// Read reads and validates the configuration file selected using --config or
+// ESSD_CONFIG, or the default configuration file if it exists, and returns it
+// along with the profile selected using --profile or ESSD_PROFILE.
+func (o *ConfigOptions) Read(root *cobra.Command) (*config.File, string, error) {
+	path := o.ConfigPath
+	if path == "" {
+		path = os.Getenv(configEnvVariable)
+	}
+	required := path != ""
+	if !required {
+		defaultPath, err := config.DefaultPath()
+		if err != nil {
+			return nil, "", err
+		}
+		path = defaultPath
+	}
+
+	file, err := config.Load(path, required)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := file.Validate(root); err != nil {
+		return nil, "", err
+	}
+
+	profile := o.Profile
+	if profile == "" {
+		profile = os.Getenv(profileEnvVariable)
+	}
+	return file, profile, nil
+}
+
+// ResolveSettings resolves the configured values of the flags, other than
+// --config and --profile, which select the configuration and so cannot be
+// configured themselves.
+func ResolveSettings(file *config.File, flags map[string]*pflag.Flag, path []string, profile string) ([]config.Setting, error) {
+	flags = maps.Clone(flags)
+	delete(flags, "config")
+	delete(flags, "profile")
+	return file.Resolve(flags, path, profile)
+}
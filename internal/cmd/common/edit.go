@@ -0,0 +1,181 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ErrNoSignaturesLeft   = errors.New("edit would leave the envelope with no signatures, use --force to write it anyway")
+	ErrNoSignatureMatched = errors.New("no signature matches the selection")
+)
+
+// EditOptions holds the flags shared by commands that edit the signatures of
+// an envelope.
+type EditOptions struct {
+	OutputPath    string
+	DryRun        bool
+	Force         bool
+	FormatOptions FormatOptions
+}
+
+func (o *EditOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(
+		&o.OutputPath,
+		"output",
+		"o",
+		"",
+		"output path to write edited envelope, \"-\" for stdout (default: edit envelope in place)",
+	)
+
+	cmd.Flags().BoolVar(
+		&o.DryRun,
+		"dry-run",
+		false,
+		"show the signatures before and after the edit without writing the envelope",
+	)
+
+	cmd.Flags().BoolVar(
+		&o.Force,
+		"force",
+		false,
+		"write the envelope even if it is left with no signatures",
+	)
+
+	o.FormatOptions.AddFlags(cmd)
+}
+
+// Edit applies the edit to the signatures of the envelope at envPath, which is
+// read from stdin and written to stdout if it is "-". With --dry-run, the
+// signatures before and after the edit are printed instead of writing the
+// envelope.
+func (o *EditOptions) Edit(envPath string, edit func(env *dsse.Envelope) error) error {
+	env, inputFormat, err := ReadEnvelopeFormat(envPath)
+	if err != nil {
+		return err
+	}
+	format, err := o.FormatOptions.GetFormat(inputFormat)
+	if err != nil {
+		return err
+	}
+
+	before := slices.Clone(env.Signatures)
+	if err := edit(env); err != nil {
+		return err
+	}
+
+	if o.DryRun {
+		fmt.Println("Before:")
+		printSignatures(before)
+		fmt.Println("After:")
+		printSignatures(env.Signatures)
+		if len(env.Signatures) == 0 && !o.Force {
+			fmt.Println("The envelope would not be written without --force.")
+		}
+		return nil
+	}
+
+	if len(env.Signatures) == 0 && !o.Force {
+		return ErrNoSignaturesLeft
+	}
+
+	// Envelopes read from stdin are written to stdout by default
+	outputPath := o.OutputPath
+	if outputPath == "" {
+		outputPath = envPath
+	}
+	return WriteEnvelope(outputPath, env, format)
+}
+
+func printSignatures(signatures []dsse.Signature) {
+	if len(signatures) == 0 {
+		fmt.Println("\tno signatures")
+		return
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\tINDEX\tKEY ID\tEXTENSION\tSIGNATURE DIGEST") //nolint:errcheck
+	for i, sig := range signatures {
+		keyID := sig.KeyID
+		if keyID == "" {
+			keyID = "-"
+		}
+		extension := "-"
+		if sig.Extension != nil {
+			extension = sig.Extension.Kind
+		}
+		fmt.Fprintf(writer, "\t%d\t%s\t%s\t%s\n", i, keyID, extension, signatureDigest(sig.Sig)) //nolint:errcheck
+	}
+	writer.Flush() //nolint:errcheck
+}
+
+// signatureDigest abbreviates the SHA-256 digest of the signature so that
+// signatures can be told apart, as signatures such as SSH signatures share a
+// common prefix.
+func signatureDigest(sig string) string {
+	sigBytes, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return "invalid"
+	}
+	digest := sha256.Sum256(sigBytes)
+	return hex.EncodeToString(digest[:])[:12]
+}
+
+// SignatureSelectionOptions holds the flags used to select signatures of an
+// envelope by key ID or by index.
+type SignatureSelectionOptions struct {
+	KeyIDs  []string
+	Indices []int
+}
+
+func (o *SignatureSelectionOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(
+		&o.KeyIDs,
+		"key-id",
+		nil,
+		"key ID of signatures to select",
+	)
+
+	cmd.Flags().IntSliceVar(
+		&o.Indices,
+		"index",
+		nil,
+		"index of signature to select, starting at 0",
+	)
+
+	cmd.MarkFlagsMutuallyExclusive("key-id", "index")
+}
+
+// IsSet returns true if signatures were selected using flags.
+func (o *SignatureSelectionOptions) IsSet() bool {
+	return len(o.KeyIDs) > 0 || len(o.Indices) > 0
+}
+
+// Selected returns a function that reports whether the signature at index i of
+// the envelope is selected. Each selected key ID and index must match a
+// signature.
+func (o *SignatureSelectionOptions) Selected(env *dsse.Envelope) (func(i int) bool, error) {
+	for _, index := range o.Indices {
+		if index < 0 || index >= len(env.Signatures) {
+			return nil, fmt.Errorf("%w: index %d is out of range, the envelope has %d signatures", ErrNoSignatureMatched, index, len(env.Signatures))
+		}
+	}
+	for _, keyID := range o.KeyIDs {
+		if !slices.ContainsFunc(env.Signatures, func(sig dsse.Signature) bool { return sig.KeyID == keyID }) {
+			return nil, fmt.Errorf("%w: key ID '%s'", ErrNoSignatureMatched, keyID)
+		}
+	}
+
+	return func(i int) bool {
+		return slices.Contains(o.Indices, i) || slices.Contains(o.KeyIDs, env.Signatures[i].KeyID)
+	}, nil
+}
@@ -0,0 +1,139 @@
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adityasaky/essd/internal/dsse"
+)
+
+func testEnvelope() *dsse.Envelope {
+	return &dsse.Envelope{
+		PayloadType: "text/plain",
+		Payload:     base64.StdEncoding.EncodeToString([]byte("payload")),
+		Signatures: []dsse.Signature{
+			{KeyID: "alice", Sig: base64.StdEncoding.EncodeToString([]byte("alice"))},
+			{KeyID: "bob", Sig: base64.StdEncoding.EncodeToString([]byte("bob"))},
+			{KeyID: "alice", Sig: base64.StdEncoding.EncodeToString([]byte("alice again"))},
+		},
+	}
+}
+
+func TestEdit(t *testing.T) {
+	removeFirst := func(env *dsse.Envelope) error {
+		env.Signatures = env.Signatures[1:]
+		return nil
+	}
+	removeAll := func(env *dsse.Envelope) error {
+		env.Signatures = nil
+		return nil
+	}
+
+	tests := map[string]struct {
+		options *EditOptions
+		edit    func(env *dsse.Envelope) error
+		// output is the path the edited envelope is written to, relative to
+		// the envelope's directory, if any
+		output     string
+		signatures int
+		err        error
+	}{
+		"in place":                         {options: &EditOptions{}, edit: removeFirst, output: "envelope.json", signatures: 2},
+		"output":                           {options: &EditOptions{OutputPath: "edited.json"}, edit: removeFirst, output: "edited.json", signatures: 2},
+		"dry run":                          {options: &EditOptions{DryRun: true}, edit: removeFirst},
+		"no signatures left":               {options: &EditOptions{}, edit: removeAll, err: ErrNoSignaturesLeft},
+		"dry run with no signatures":       {options: &EditOptions{DryRun: true}, edit: removeAll},
+		"forced with no signatures":        {options: &EditOptions{Force: true}, edit: removeAll, output: "envelope.json"},
+		"edit fails":                       {options: &EditOptions{}, edit: func(*dsse.Envelope) error { return ErrNoSignatureMatched }, err: ErrNoSignatureMatched},
+		"forced output with no signatures": {options: &EditOptions{OutputPath: "edited.json", Force: true}, edit: removeAll, output: "edited.json"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			envPath := filepath.Join(dir, "envelope.json")
+			if err := WriteEnvelope(envPath, testEnvelope(), dsse.FormatJSON); err != nil {
+				t.Fatal(err)
+			}
+			original, err := os.ReadFile(envPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.options.OutputPath != "" {
+				test.options.OutputPath = filepath.Join(dir, test.options.OutputPath)
+			}
+
+			err = test.options.Edit(envPath, test.edit)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("expected %v, got %v", test.err, err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.output != "" {
+				env, err := ReadEnvelope(filepath.Join(dir, test.output))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(env.Signatures) != test.signatures {
+					t.Fatalf("expected %d signatures, got %d", test.signatures, len(env.Signatures))
+				}
+			}
+			// The envelope is only modified when it is edited in place
+			if test.output != "envelope.json" {
+				contents, err := os.ReadFile(envPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(contents, original) {
+					t.Fatal("envelope was modified")
+				}
+			}
+			if test.output != "edited.json" {
+				if _, err := os.Stat(filepath.Join(dir, "edited.json")); !os.IsNotExist(err) {
+					t.Fatalf("expected no output to be written, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestSignatureSelection(t *testing.T) {
+	env := testEnvelope()
+
+	tests := map[string]struct {
+		options  *SignatureSelectionOptions
+		selected []bool
+		err      error
+	}{
+		"key ID":          {options: &SignatureSelectionOptions{KeyIDs: []string{"alice"}}, selected: []bool{true, false, true}},
+		"index":           {options: &SignatureSelectionOptions{Indices: []int{1, 2}}, selected: []bool{false, true, true}},
+		"unknown key ID":  {options: &SignatureSelectionOptions{KeyIDs: []string{"alice", "carol"}}, err: ErrNoSignatureMatched},
+		"index too large": {options: &SignatureSelectionOptions{Indices: []int{3}}, err: ErrNoSignatureMatched},
+		"negative index":  {options: &SignatureSelectionOptions{Indices: []int{-1}}, err: ErrNoSignatureMatched},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			selected, err := test.options.Selected(env)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("expected %v, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, expected := range test.selected {
+				if selected(i) != expected {
+					t.Fatalf("signature %d selected: %t, expected %t", i, selected(i), expected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package common
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/spf13/cobra"
+)
+
+// FormatOptions holds the flag used to select the format envelopes are
+// written in.
+type FormatOptions struct {
+	Format string
+
+	// OtherFormats are formats other than envelope encodings that the command
+	// supports, such as COSE structures. Commands handle these formats before
+	// calling GetFormat.
+	OtherFormats []string
+}
+
+func (o *FormatOptions) AddFlags(cmd *cobra.Command) {
+	formats := []string{}
+	for _, format := range dsse.Formats {
+		formats = append(formats, string(format))
+	}
+	formats = append(formats, o.OtherFormats...)
+
+	cmd.Flags().StringVar(
+		&o.Format,
+		"format",
+		"",
+		fmt.Sprintf("format to write envelope in (%s) (default: format of the input envelope, or json)", strings.Join(formats, ", ")),
+	)
+}
+
+// IsOther returns true if one of the command's other formats was selected.
+func (o *FormatOptions) IsOther() bool {
+	return slices.Contains(o.OtherFormats, o.Format)
+}
+
+// GetFormat returns the format selected using --format, or the default
+// format if none was selected.
+func (o *FormatOptions) GetFormat(defaultFormat dsse.Format) (dsse.Format, error) {
+	if o.Format == "" {
+		if defaultFormat == "" {
+			return dsse.FormatJSON, nil
+		}
+		return defaultFormat, nil
+	}
+
+	format := dsse.Format(o.Format)
+	if !slices.Contains(dsse.Formats, format) {
+		return "", fmt.Errorf("%w: '%s', expected one of %v", dsse.ErrUnknownFormat, o.Format, dsse.Formats)
+	}
+	return format, nil
+}
@@ -0,0 +1,198 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/adityasaky/essd/internal/dsse"
+)
+
+// StdioPath is the path that refers to standard input when reading and to
+// standard output when writing.
+const StdioPath = "-"
+
+var ErrStdinReused = errors.New("standard input can only be read once")
+
+var stdinRead bool
+
+// ReadFile reads the file at path, or standard input if path is "-".
+func ReadFile(path string) ([]byte, error) {
+	if path != StdioPath {
+		return os.ReadFile(path)
+	}
+
+	if stdinRead {
+		return nil, ErrStdinReused
+	}
+	stdinRead = true
+	return io.ReadAll(os.Stdin)
+}
+
+// WriteFile writes data to the file at path, or standard output if path is
+// "-".
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	if path != StdioPath {
+		return os.WriteFile(path, data, perm)
+	}
+
+	// A trailing newline keeps shell prompts and line-based tools happy
+	_, err := os.Stdout.Write(append(data, '\n'))
+	return err
+}
+
+// DisplayName returns the name used to refer to the file at path in reports.
+func DisplayName(path string) string {
+	if path == StdioPath {
+		return "standard input"
+	}
+	return path
+}
+
+// ReadEnvelope reads and decodes the envelope at path, or from standard input
+// if path is "-". The envelope's format is detected.
+func ReadEnvelope(path string) (*dsse.Envelope, error) {
+	env, _, err := ReadEnvelopeFormat(path)
+	return env, err
+}
+
+// ReadEnvelopeFormat reads and decodes the envelope at path like ReadEnvelope,
+// and also returns the format it was encoded in.
+func ReadEnvelopeFormat(path string) (*dsse.Envelope, dsse.Format, error) {
+	envBytes, err := ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	env, format, err := dsse.Unmarshal(envBytes)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to parse envelope '%s': %w", DisplayName(path), err)
+	}
+	return env, format, nil
+}
+
+// WriteEnvelope writes the envelope encoded in the format to the file at path,
+// or standard output if path is "-".
+func WriteEnvelope(path string, env *dsse.Envelope, format dsse.Format) error {
+	envBytes, err := dsse.Marshal(env, format)
+	if err != nil {
+		return err
+	}
+
+	if format == dsse.FormatProtobuf {
+		return WriteBinaryFile(path, envBytes)
+	}
+	return WriteFile(path, envBytes, 0o644)
+}
+
+// WriteBinaryFile writes binary data to the file at path, or standard output
+// if path is "-". Unlike WriteFile, no newline is written to standard output,
+// as it would corrupt the data.
+func WriteBinaryFile(path string, data []byte) error {
+	if path != StdioPath {
+		return os.WriteFile(path, data, 0o644)
+	}
+	_, err := os.Stdout.Write(data)
+	return err
+}
+
+// Open opens the file at path for reading, or standard input if path is "-".
+func Open(path string) (io.ReadCloser, error) {
+	if path != StdioPath {
+		return os.Open(path)
+	}
+
+	if stdinRead {
+		return nil, ErrStdinReused
+	}
+	stdinRead = true
+	return io.NopCloser(os.Stdin), nil
+}
+
+// OpenSeekable opens the file at path for reading. If path is "-", standard
+// input is first copied to a temporary file, so that it can be read more than
+// once without being held in memory. The returned function closes the file and
+// removes any temporary file.
+func OpenSeekable(path string) (*os.File, func(), error) {
+	if path != StdioPath {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return file, func() { file.Close() }, nil //nolint:errcheck
+	}
+
+	if stdinRead {
+		return nil, nil, ErrStdinReused
+	}
+	stdinRead = true
+
+	file, cleanup, err := CreateTemp()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := io.Copy(file, os.Stdin); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return file, cleanup, nil
+}
+
+// CreateTemp creates a temporary file for holding data, such as a payload,
+// that is too large to hold in memory. The returned function closes and
+// removes the file.
+func CreateTemp() (*os.File, func(), error) {
+	file, err := os.CreateTemp("", "essd-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, func() {
+		file.Close()           //nolint:errcheck
+		os.Remove(file.Name()) //nolint:errcheck
+	}, nil
+}
+
+// DecodeStreamedEnvelope decodes the envelope read from r, writing its payload
+// to a temporary file rather than holding it in memory. The returned function
+// removes the temporary file.
+func DecodeStreamedEnvelope(r io.Reader) (*dsse.StreamedEnvelope, func(), error) {
+	payloadFile, cleanup, err := CreateTemp()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	env, err := dsse.DecodeEnvelope(r, payloadFile)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	env.Payload = payloadFile
+
+	return env, cleanup, nil
+}
+
+// WriteStreamedEnvelope writes the envelope to the file at path, or standard
+// output if path is "-", encoding its payload as it is read.
+func WriteStreamedEnvelope(path string, env *dsse.StreamedEnvelope) error {
+	if path == StdioPath {
+		if err := env.Encode(os.Stdout); err != nil {
+			return err
+		}
+		_, err := os.Stdout.Write([]byte{'\n'})
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := env.Encode(file); err != nil {
+		file.Close() //nolint:errcheck
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,64 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+var ErrUnknownLogFormat = errors.New("unknown log format")
+
+// LoggingOptions holds the root command's persistent flags that configure
+// the diagnostics logged to stderr.
+type LoggingOptions struct {
+	Level  string
+	Format string
+}
+
+func (o *LoggingOptions) AddFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(
+		&o.Level,
+		"log-level",
+		"info",
+		"minimum level of diagnostics to log (debug, info, warn, error)",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&o.Format,
+		"log-format",
+		LogFormatText,
+		fmt.Sprintf("format to log diagnostics in (%s, %s)", LogFormatText, LogFormatJSON),
+	)
+}
+
+// Configure sets the default logger to write diagnostics to w at the selected
+// level and in the selected format.
+func (o *LoggingOptions) Configure(w io.Writer) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(o.Level)); err != nil {
+		return fmt.Errorf("invalid log level '%s', expected one of debug, info, warn, error", o.Level)
+	}
+	handlerOpts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(o.Format) {
+	case LogFormatText:
+		handler = slog.NewTextHandler(w, handlerOpts)
+	case LogFormatJSON:
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		return fmt.Errorf("%w '%s', expected one of %s, %s", ErrUnknownLogFormat, o.Format, LogFormatText, LogFormatJSON)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
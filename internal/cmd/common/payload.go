@@ -0,0 +1,70 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/adityasaky/essd/internal/payload"
+	"github.com/spf13/cobra"
+)
+
+// PayloadValidationOptions holds the flags used to register JSON Schemas for
+// payload types and in-toto predicate types.
+type PayloadValidationOptions struct {
+	PayloadSchemas   []string
+	PredicateSchemas []string
+}
+
+func (o *PayloadValidationOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(
+		&o.PayloadSchemas,
+		"payload-schema",
+		nil,
+		"JSON Schema to validate payloads of a payload type with (specify using <payload type>=<path>)",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&o.PredicateSchemas,
+		"predicate-schema",
+		nil,
+		"JSON Schema to validate in-toto predicates of a predicate type with (specify using <predicate type>=<path>)",
+	)
+}
+
+// GetRegistry returns a registry of known payload types extended with the
+// schemas specified using flags.
+func (o *PayloadValidationOptions) GetRegistry() (*payload.Registry, error) {
+	registry := payload.NewRegistry()
+
+	for _, spec := range o.PayloadSchemas {
+		payloadType, schemaPath, err := parseSchemaSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		if err := registry.RegisterPayloadSchema(payloadType, schemaPath); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, spec := range o.PredicateSchemas {
+		predicateType, schemaPath, err := parseSchemaSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		if err := registry.RegisterPredicateSchema(predicateType, schemaPath); err != nil {
+			return nil, err
+		}
+	}
+
+	return registry, nil
+}
+
+func parseSchemaSpec(spec string) (string, string, error) {
+	// Payload and predicate types may contain '=', so the path follows the
+	// last one
+	index := strings.LastIndex(spec, "=")
+	if index <= 0 || index == len(spec)-1 {
+		return "", "", fmt.Errorf("invalid schema format '%s', expected <type>=<path>", spec)
+	}
+	return spec[:index], spec[index+1:], nil
+}
@@ -0,0 +1,106 @@
+package common
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/intoto"
+	"github.com/adityasaky/essd/internal/payload"
+	"github.com/adityasaky/essd/internal/slsa"
+	ita1 "github.com/in-toto/attestation/go/v1"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// PredicateOptions holds the flags used to specify the predicate for commands
+// that create in-toto attestations.
+type PredicateOptions struct {
+	PredicateType  string
+	PredicatePath  string
+	ProvenancePath string
+}
+
+func (o *PredicateOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(
+		&o.PredicateType,
+		"predicate-type",
+		"",
+		"type URI of the predicate",
+	)
+
+	cmd.Flags().StringVar(
+		&o.PredicatePath,
+		"predicate",
+		"",
+		"path of JSON predicate",
+	)
+
+	cmd.Flags().StringVar(
+		&o.ProvenancePath,
+		"provenance",
+		"",
+		"path of JSON build description to generate SLSA v1.0 provenance predicate from",
+	)
+
+	cmd.MarkFlagsOneRequired("predicate", "provenance")
+	cmd.MarkFlagsMutuallyExclusive("predicate", "provenance")
+	cmd.MarkFlagsMutuallyExclusive("predicate-type", "provenance")
+}
+
+// GetPredicate returns the predicate type and the predicate, either loaded
+// from the predicate file or generated from the build description.
+func (o *PredicateOptions) GetPredicate() (string, *structpb.Struct, error) {
+	if o.ProvenancePath != "" {
+		description, err := slsa.LoadBuildDescription(o.ProvenancePath)
+		if err != nil {
+			return "", nil, err
+		}
+		provenance, err := description.Provenance()
+		if err != nil {
+			return "", nil, err
+		}
+		predicate, err := slsa.ToStruct(provenance)
+		if err != nil {
+			return "", nil, err
+		}
+		return slsa.PredicateType, predicate, nil
+	}
+
+	if o.PredicateType == "" {
+		return "", nil, fmt.Errorf("required flag --predicate-type not set for --predicate")
+	}
+
+	predicate, err := intoto.LoadPredicate(o.PredicatePath)
+	if err != nil {
+		return "", nil, err
+	}
+	return o.PredicateType, predicate, nil
+}
+
+// SignStatement validates the statement using the registry and returns an
+// envelope for it signed using the signer.
+func SignStatement(ctx context.Context, statement *ita1.Statement, registry *payload.Registry, signer dsse.Signer) (*dsse.Envelope, error) {
+	statementBytes, err := protojson.Marshal(statement)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := registry.Validate(intoto.PayloadType, statementBytes); err != nil {
+		return nil, err
+	}
+
+	env := &dsse.Envelope{
+		PayloadType: intoto.PayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(statementBytes),
+		Signatures:  []dsse.Signature{},
+	}
+
+	if err := dsse.AddSignature(ctx, env, signer); err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
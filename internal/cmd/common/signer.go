@@ -0,0 +1,132 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/remote"
+	"github.com/adityasaky/essd/internal/sigstore"
+	"github.com/adityasaky/essd/internal/ssh"
+	"github.com/adityasaky/essd/internal/tlog"
+	"github.com/spf13/cobra"
+)
+
+var ErrRemoteTlog = errors.New("cannot use --tlog with a signing service")
+
+// SignerOptions holds the flags used to select the signer for commands that
+// create signatures.
+type SignerOptions struct {
+	SSHKeyPath  string
+	UseSigstore bool
+
+	UseTlog  bool
+	RekorURL string
+
+	RemoteOptions remote.Options
+}
+
+func (o *SignerOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(
+		&o.SSHKeyPath,
+		"key",
+		"k",
+		"",
+		"path of SSH key to sign with, or remote://<host>[:<port>] to sign using a signing service",
+	)
+
+	cmd.Flags().BoolVar(
+		&o.UseSigstore,
+		"sigstore",
+		false,
+		"sign with Sigstore",
+	)
+
+	cmd.MarkFlagsOneRequired("key", "sigstore")
+	cmd.MarkFlagsMutuallyExclusive("key", "sigstore")
+
+	cmd.Flags().BoolVar(
+		&o.UseTlog,
+		"tlog",
+		false,
+		"record SSH signature in a Rekor transparency log (Sigstore signatures are always recorded)",
+	)
+
+	cmd.Flags().StringVar(
+		&o.RekorURL,
+		"rekor-url",
+		tlog.DefaultRekorURL,
+		"URL of Rekor instance to record signatures in with --tlog",
+	)
+
+	cmd.MarkFlagsMutuallyExclusive("sigstore", "tlog")
+
+	cmd.Flags().StringVar(
+		&o.RemoteOptions.CAPath,
+		"remote-ca",
+		"",
+		"path of PEM encoded CA certificates to verify the signing service's certificate with (default: system certificates)",
+	)
+
+	cmd.Flags().StringVar(
+		&o.RemoteOptions.CertPath,
+		"remote-cert",
+		"",
+		"path of client certificate to authenticate to the signing service with",
+	)
+
+	cmd.Flags().StringVar(
+		&o.RemoteOptions.KeyPath,
+		"remote-key",
+		"",
+		"path of private key of the client certificate specified using --remote-cert",
+	)
+
+	cmd.MarkFlagsRequiredTogether("remote-cert", "remote-key")
+
+	cmd.Flags().StringVar(
+		&o.RemoteOptions.TokenPath,
+		"remote-token-file",
+		"",
+		"path of file holding the bearer token to authenticate to the signing service with",
+	)
+}
+
+// IsRemote returns true if signatures are requested from a signing service.
+func (o *SignerOptions) IsRemote() bool {
+	return strings.HasPrefix(o.SSHKeyPath, remote.Prefix)
+}
+
+// CheckFormat returns an error if signatures created by the selected signer
+// cannot be encoded in the envelope format, so that this is reported before
+// signing. Sigstore and transparency log signatures record their verification
+// material in signature extensions, which only JSON envelopes can hold.
+func (o *SignerOptions) CheckFormat(format dsse.Format) error {
+	if (o.UseSigstore || o.UseTlog) && format != dsse.FormatJSON {
+		return dsse.ErrExtensionUnsupported
+	}
+	return nil
+}
+
+func (o *SignerOptions) GetSigner(ctx context.Context) (dsse.Signer, error) {
+	if o.UseSigstore {
+		return sigstore.NewSigner(), nil
+	}
+
+	if o.IsRemote() {
+		if o.UseTlog {
+			return nil, ErrRemoteTlog
+		}
+		return remote.NewSigner(ctx, o.SSHKeyPath, &o.RemoteOptions)
+	}
+
+	signer, err := ssh.NewSignerFromFile(o.SSHKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	if o.UseTlog {
+		return tlog.NewSigner(signer, o.RekorURL)
+	}
+	return signer, nil
+}
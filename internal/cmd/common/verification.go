@@ -0,0 +1,401 @@
+package common
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/adityasaky/essd/internal/assertion"
+	"github.com/adityasaky/essd/internal/cose"
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/jws"
+	"github.com/adityasaky/essd/internal/key"
+	"github.com/adityasaky/essd/internal/opa"
+	"github.com/adityasaky/essd/internal/policy"
+	"github.com/adityasaky/essd/internal/tlog"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ErrStreamUnsupported    = errors.New("only verification using keys is supported with --stream")
+	ErrStructureUnsupported = errors.New("only verification using keys, without --require-tlog, is supported for COSE structures and JWS")
+)
+
+// VerificationOptions holds the flags used to verify envelopes, using either
+// keys or a policy, and to check the verified envelopes using assertions, Rego
+// policies, and payload validation.
+type VerificationOptions struct {
+	PublicKeys []string
+	PolicyPath string
+	Assertions []string
+	RegoPath   string
+	RegoQuery  string
+
+	RequireTlog bool
+	TlogKeyPath string
+
+	ValidatePayload          bool
+	PayloadValidationOptions PayloadValidationOptions
+}
+
+func (o *VerificationOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(
+		&o.PublicKeys,
+		"key",
+		"k",
+		nil,
+		"key to use for verifying signatures (specify sigstore using fulcio:<identity>::<issuer>)",
+	)
+
+	cmd.Flags().StringVar(
+		&o.PolicyPath,
+		"policy",
+		"",
+		"path of YAML or JSON policy to verify envelope against",
+	)
+
+	cmd.MarkFlagsOneRequired("key", "policy")
+	cmd.MarkFlagsMutuallyExclusive("key", "policy")
+
+	cmd.Flags().StringArrayVar(
+		&o.Assertions,
+		"assert",
+		nil,
+		"CEL expression that must hold for the verified envelope",
+	)
+
+	cmd.Flags().StringVar(
+		&o.RegoPath,
+		"rego",
+		"",
+		"path of Rego policy to evaluate against the verified envelope",
+	)
+
+	cmd.Flags().StringVar(
+		&o.RegoQuery,
+		"rego-query",
+		opa.DefaultQuery,
+		"Rego query that produces deny messages or a boolean",
+	)
+
+	cmd.Flags().BoolVar(
+		&o.RequireTlog,
+		"require-tlog",
+		false,
+		"require signatures to be recorded in a transparency log, verifying the entries offline",
+	)
+
+	cmd.Flags().StringVar(
+		&o.TlogKeyPath,
+		"tlog-key",
+		"",
+		"path of PEM public key of the transparency log to trust with --require-tlog (default: Sigstore public good instance)",
+	)
+
+	cmd.Flags().BoolVar(
+		&o.ValidatePayload,
+		"validate-payload",
+		false,
+		"validate the structure of the payload based on its payload type",
+	)
+
+	o.PayloadValidationOptions.AddFlags(cmd)
+}
+
+// Verify verifies the envelope, which is referred to using name in reports,
+// and returns the signers whose signatures were verified.
+func (o *VerificationOptions) Verify(ctx context.Context, name string, env *dsse.Envelope) ([]key.VerifiedSigner, error) {
+	var (
+		signers      []key.VerifiedSigner
+		acceptedKeys []dsse.AcceptedKey
+		err          error
+	)
+	if o.PolicyPath != "" {
+		signers, acceptedKeys, err = o.verifyPolicy(ctx, name, env)
+	} else {
+		signers, acceptedKeys, err = o.verifyKeys(ctx, env)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.verifyTlog(ctx, env, signers, acceptedKeys); err != nil {
+		return nil, err
+	}
+
+	if err := o.checkVerified(ctx, name, env, signers); err != nil {
+		return nil, err
+	}
+
+	return signers, nil
+}
+
+// checkVerified checks the envelope, whose signatures were verified, using the
+// assertions, Rego policy, and payload validation.
+func (o *VerificationOptions) checkVerified(ctx context.Context, name string, env *dsse.Envelope, signers []key.VerifiedSigner) error {
+	if err := o.evaluateAssertions(env, signers); err != nil {
+		return err
+	}
+
+	if err := o.evaluateRego(ctx, name, env, signers); err != nil {
+		return err
+	}
+
+	if o.ValidatePayload {
+		registry, err := o.PayloadValidationOptions.GetRegistry()
+		if err != nil {
+			return err
+		}
+		payload, err := env.DecodeB64Payload()
+		if err != nil {
+			return err
+		}
+		if err := registry.Validate(env.PayloadType, payload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// VerifyCOSE verifies the COSE structure using keys like verifyStructure.
+func (o *VerificationOptions) VerifyCOSE(ctx context.Context, name string, message *cose.Message) ([]key.VerifiedSigner, error) {
+	return o.verifyStructure(ctx, name, message.ContentType, message.Payload, func(verifiers []dsse.Verifier) ([]dsse.AcceptedKey, error) {
+		return cose.Verify(message, 1, verifiers...)
+	})
+}
+
+// VerifyJWS verifies the JWS using keys like verifyStructure.
+func (o *VerificationOptions) VerifyJWS(ctx context.Context, name string, message *jws.Message) ([]key.VerifiedSigner, error) {
+	return o.verifyStructure(ctx, name, message.PayloadType, message.Payload, func(verifiers []dsse.Verifier) ([]dsse.AcceptedKey, error) {
+		return jws.Verify(message, 1, verifiers...)
+	})
+}
+
+/*
+verifyStructure verifies a signed structure other than a DSSE envelope, such
+as a COSE structure or a JWS, using keys, and returns the signers whose
+signatures were verified. verifySignatures verifies the structure's signatures
+using the verifiers for the keys. The payload type recorded in the structure is
+treated like an envelope's, so that assertions, Rego policies, and payload
+validation check the payload like an envelope's. Policies and transparency log
+entries cannot be used.
+*/
+func (o *VerificationOptions) verifyStructure(ctx context.Context, name, payloadType string, payload []byte, verifySignatures func([]dsse.Verifier) ([]dsse.AcceptedKey, error)) ([]key.VerifiedSigner, error) {
+	if o.PolicyPath != "" || o.RequireTlog {
+		return nil, ErrStructureUnsupported
+	}
+
+	verifiers, err := o.getVerifiers()
+	if err != nil {
+		return nil, err
+	}
+
+	acceptedKeys, err := verifySignatures(verifiers)
+	if err != nil {
+		return nil, err
+	}
+
+	signers, err := key.VerifiedSigners(acceptedKeys, verifiers, o.PublicKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	env := &dsse.Envelope{
+		PayloadType: payloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+	}
+	if err := o.checkVerified(ctx, name, env, signers); err != nil {
+		return nil, err
+	}
+
+	return signers, nil
+}
+
+// VerifyStream verifies the streamed envelope using keys, and returns the
+// signers whose signatures were verified. Policies, assertions, Rego policies,
+// transparency log entries, and payload validation require the payload in
+// memory, and cannot be used.
+func (o *VerificationOptions) VerifyStream(ctx context.Context, env *dsse.StreamedEnvelope) ([]key.VerifiedSigner, error) {
+	if o.PolicyPath != "" || len(o.Assertions) > 0 || o.RegoPath != "" || o.RequireTlog || o.ValidatePayload {
+		return nil, ErrStreamUnsupported
+	}
+
+	verifiers, err := o.getVerifiers()
+	if err != nil {
+		return nil, err
+	}
+
+	envVerifier, err := dsse.NewMultiEnvelopeVerifier(1, verifiers...)
+	if err != nil {
+		return nil, err
+	}
+
+	acceptedKeys, err := envVerifier.VerifyStream(ctx, env)
+	if err != nil {
+		return nil, err
+	}
+
+	return key.VerifiedSigners(acceptedKeys, verifiers, o.PublicKeys)
+}
+
+func (o *VerificationOptions) verifyKeys(ctx context.Context, env *dsse.Envelope) ([]key.VerifiedSigner, []dsse.AcceptedKey, error) {
+	verifiers, err := o.getVerifiers()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	envVerifier, err := dsse.NewMultiEnvelopeVerifier(1, verifiers...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	acceptedKeys, err := envVerifier.Verify(ctx, env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Signers are named using the key references they were verified with
+	signers, err := key.VerifiedSigners(acceptedKeys, verifiers, o.PublicKeys)
+	return signers, acceptedKeys, err
+}
+
+func (o *VerificationOptions) verifyPolicy(ctx context.Context, name string, env *dsse.Envelope) ([]key.VerifiedSigner, []dsse.AcceptedKey, error) {
+	verificationPolicy, err := policy.Load(o.PolicyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, err := verificationPolicy.Verify(ctx, env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fmt.Printf("Policy evaluation for %s:\n", name)
+	for _, check := range result.Checks {
+		status := "PASS"
+		if !check.Passed {
+			status = "FAIL"
+		}
+		fmt.Printf("\t%s %s: %s\n", status, check.Rule, check.Message)
+	}
+
+	return result.Signers, result.AcceptedKeys, result.Err()
+}
+
+// verifyTlog checks that the signatures of the signers are recorded in a
+// trusted transparency log, and records when they were. Sigstore signatures
+// are skipped as their log entries are verified with the signatures.
+func (o *VerificationOptions) verifyTlog(ctx context.Context, env *dsse.Envelope, signers []key.VerifiedSigner, acceptedKeys []dsse.AcceptedKey) error {
+	if !o.RequireTlog {
+		return nil
+	}
+
+	trustedLogs, err := tlog.LoadTrustedLogs(o.TlogKeyPath)
+	if err != nil {
+		return err
+	}
+
+	payload, err := env.DecodeB64Payload()
+	if err != nil {
+		return err
+	}
+	paeEnc := dsse.PAE(env.PayloadType, payload)
+
+	// Signers are listed in the order of the accepted keys
+	for i, acceptedKey := range acceptedKeys {
+		if signers[i].Identity != "" {
+			continue
+		}
+
+		sig, err := acceptedKey.Sig.DecodeB64Sig()
+		if err != nil {
+			return err
+		}
+
+		integratedTime, err := trustedLogs.Verify(ctx, acceptedKey.Sig.Extension, paeEnc, sig, acceptedKey.Public)
+		if err != nil {
+			return fmt.Errorf("signature by '%s': %w", signers[i].Name, err)
+		}
+		slog.Debug("Verified transparency log entry", slog.String("payloadType", env.PayloadType), slog.String("keyid", acceptedKey.KeyID), slog.String("backend", "rekor"), slog.Time("integratedTime", integratedTime))
+		signers[i].Timestamps = []time.Time{integratedTime}
+	}
+
+	return nil
+}
+
+// evaluateAssertions checks that the assertions hold for the envelope, whose
+// signatures were verified for the signers.
+func (o *VerificationOptions) evaluateAssertions(env *dsse.Envelope, signers []key.VerifiedSigner) error {
+	if len(o.Assertions) == 0 {
+		return nil
+	}
+
+	compiled := []*assertion.Assertion{}
+	for _, expression := range o.Assertions {
+		compiledAssertion, err := assertion.Compile(expression)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, compiledAssertion)
+	}
+
+	payload, err := env.DecodeB64Payload()
+	if err != nil {
+		return err
+	}
+	input := &assertion.Input{PayloadType: env.PayloadType, Payload: payload, Signers: signers}
+
+	for _, compiledAssertion := range compiled {
+		if err := compiledAssertion.Evaluate(input); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// evaluateRego evaluates the Rego policy against the envelope, whose
+// signatures were verified for the signers, and reports deny messages.
+func (o *VerificationOptions) evaluateRego(ctx context.Context, name string, env *dsse.Envelope, signers []key.VerifiedSigner) error {
+	if o.RegoPath == "" {
+		return nil
+	}
+
+	payload, err := env.DecodeB64Payload()
+	if err != nil {
+		return err
+	}
+
+	denials, err := opa.Evaluate(ctx, o.RegoPath, o.RegoQuery, opa.NewInput(env.PayloadType, payload, signers))
+	if err != nil {
+		return err
+	}
+	if len(denials) == 0 {
+		return nil
+	}
+
+	fmt.Printf("Rego policy denied %s:\n", name)
+	for _, denial := range denials {
+		fmt.Printf("\tDENY %s\n", denial)
+	}
+
+	return fmt.Errorf("%w: %d deny messages", opa.ErrDenied, len(denials))
+}
+
+func (o *VerificationOptions) getVerifiers() ([]dsse.Verifier, error) {
+	verifiers := []dsse.Verifier{}
+
+	for _, keyRef := range o.PublicKeys {
+		verifier, err := key.NewVerifier(keyRef)
+		if err != nil {
+			return nil, err
+		}
+		verifiers = append(verifiers, verifier)
+	}
+
+	return verifiers, nil
+}
@@ -0,0 +1,18 @@
+package config
+
+import (
+	"github.com/adityasaky/essd/internal/cmd/config/show"
+	"github.com/spf13/cobra"
+)
+
+func New() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "config",
+		Short:             "Inspect essd configuration",
+		DisableAutoGenTag: true,
+	}
+
+	cmd.AddCommand(show.New())
+
+	return cmd
+}
@@ -0,0 +1,145 @@
+package show
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/adityasaky/essd/internal/cmd/common"
+	"github.com/adityasaky/essd/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+const sigstoreFlagPrefix = "sigstore-"
+
+var ErrUnknownCommand = errors.New("unknown command")
+
+type options struct{}
+
+func (o *options) Run(cmd *cobra.Command, args []string) error {
+	root := cmd.Root()
+	configOpts := &common.ConfigOptions{
+		ConfigPath: cmd.Flag("config").Value.String(),
+		Profile:    cmd.Flag("profile").Value.String(),
+	}
+	file, profile, err := configOpts.Read(root)
+	if err != nil {
+		return err
+	}
+
+	target := root
+	if len(args) > 0 {
+		found, remaining, err := root.Find(args)
+		if err != nil || len(remaining) > 0 {
+			return fmt.Errorf("%w '%s'", ErrUnknownCommand, strings.Join(args, " "))
+		}
+		target = found
+	}
+
+	// Settings that apply to any command are shown for the root command
+	flags := config.Flags(target)
+	if target == root {
+		flags = config.AllFlags(root)
+	}
+	resolved, err := common.ResolveSettings(file, flags, config.SectionPath(target), profile)
+	if err != nil {
+		return err
+	}
+
+	// The root command's flags specified for this command, such as the
+	// Sigstore instance's URLs, take precedence over the configuration
+	set := map[string]bool{}
+	commandLine := []config.Setting{}
+	cmd.Flags().Visit(func(flag *pflag.Flag) {
+		if _, applies := flags[flag.Name]; applies && flag.Name != "config" && flag.Name != "profile" {
+			set[flag.Name] = true
+			commandLine = append(commandLine, config.Setting{Flag: flag.Name, Values: []string{flag.Value.String()}, Source: "command line"})
+		}
+	})
+
+	settings := map[string]config.Setting{}
+	for _, setting := range append(commandLine, config.Effective(flags, resolved, set)...) {
+		settings[setting.Flag] = setting
+	}
+	root.PersistentFlags().VisitAll(func(flag *pflag.Flag) {
+		if _, set := settings[flag.Name]; !set && strings.HasPrefix(flag.Name, sigstoreFlagPrefix) {
+			settings[flag.Name] = config.Setting{Flag: flag.Name, Values: []string{flag.DefValue}, Source: "default"}
+		}
+	})
+
+	out := cmd.OutOrStdout()
+	if file.Path == "" {
+		fmt.Fprintln(out, "# Configuration file: none") //nolint:errcheck
+	} else {
+		fmt.Fprintf(out, "# Configuration file: %s\n", file.Path) //nolint:errcheck
+	}
+	if profile != "" {
+		fmt.Fprintf(out, "# Profile: %s\n", profile) //nolint:errcheck
+	}
+	fmt.Fprintf(out, "# Command: %s\n", target.CommandPath()) //nolint:errcheck
+
+	names := []string{}
+	for name := range settings {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		value, err := formatValues(settings[name].Values, flags[name])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s: %s  # %s\n", name, value, settings[name].Source) //nolint:errcheck
+	}
+	return nil
+}
+
+// formatValues returns the values of a setting in YAML, using a list for
+// flags that accept several values.
+func formatValues(values []string, flag *pflag.Flag) (string, error) {
+	formatted := []string{}
+	for _, value := range values {
+		if flag.Value.Type() == "bool" {
+			formatted = append(formatted, value)
+			continue
+		}
+		valueBytes, err := yaml.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		formatted = append(formatted, strings.TrimSpace(string(valueBytes)))
+	}
+
+	if config.IsListFlag(flag) {
+		return "[" + strings.Join(formatted, ", ") + "]", nil
+	}
+	return strings.Join(formatted, ", "), nil
+}
+
+func New() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:   "show [command...]",
+		Short: "Show the effective configuration",
+		Long: `Show the effective configuration of a command, which is the flag values set by
+environment variables, the selected profile, and the configuration file, along
+with where each value was set. If no command is specified, the settings that
+apply to any command are shown. The Sigstore instance's settings are always
+shown.
+
+See docs/configuration.md for the configuration file, profiles, and
+environment variables. Show the configuration of the sign command using the
+release profile:
+
+  essd --profile release config show sign`,
+		RunE: o.Run,
+		// The configuration is read by Run, so that the command line
+		// flags are not mixed with configured values
+		Annotations:       map[string]string{common.SkipConfigAnnotation: "true"},
+		DisableAutoGenTag: true,
+	}
+
+	return cmd
+}
@@ -0,0 +1,203 @@
+package convert
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/adityasaky/essd/internal/cmd/common"
+	"github.com/adityasaky/essd/internal/cose"
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/ssh"
+	"github.com/spf13/cobra"
+)
+
+var ErrKeyRequired = errors.New("required flag --key not set for converting signatures between DSSE and COSE")
+
+type options struct {
+	to         string
+	sshKeyPath string
+	outputPath string
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(
+		&o.to,
+		"to",
+		"",
+		fmt.Sprintf("format to convert to (%s, %s, %s, %s, %s)", dsse.FormatJSON, dsse.FormatProtobuf, dsse.FormatProtoJSON, cose.FormatSign1, cose.FormatSign),
+	)
+	cmd.MarkFlagRequired("to") //nolint:errcheck
+
+	cmd.Flags().StringVarP(
+		&o.sshKeyPath,
+		"key",
+		"k",
+		"",
+		"path of SSH key whose signature is converted",
+	)
+
+	cmd.Flags().StringVarP(
+		&o.outputPath,
+		"output",
+		"o",
+		"",
+		"output path to write converted envelope or COSE structure (\"-\" for stdout)",
+	)
+	cmd.MarkFlagRequired("output") //nolint:errcheck
+}
+
+func (o *options) Run(cmd *cobra.Command, args []string) error {
+	toCOSE := slices.Contains(cose.Formats, cose.Format(o.to))
+	if !toCOSE && !slices.Contains(dsse.Formats, dsse.Format(o.to)) {
+		return fmt.Errorf("unknown format '%s'", o.to)
+	}
+
+	data, err := common.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	if !cose.IsCOSE(data) {
+		env, _, err := dsse.Unmarshal(data)
+		if err != nil {
+			return fmt.Errorf("unable to parse envelope '%s': %w", common.DisplayName(args[0]), err)
+		}
+
+		// Envelopes are re-encoded with their signatures
+		if !toCOSE {
+			return common.WriteEnvelope(o.outputPath, env, dsse.Format(o.to))
+		}
+		return o.envelopeToCOSE(cmd.Context(), env)
+	}
+
+	message, err := cose.Unmarshal(data)
+	if err != nil {
+		return fmt.Errorf("unable to parse COSE structure '%s': %w", common.DisplayName(args[0]), err)
+	}
+	return o.coseToTarget(cmd.Context(), message, toCOSE)
+}
+
+// envelopeToCOSE verifies the envelope's signature by the key, and signs the
+// envelope's payload as a COSE structure using the key.
+func (o *options) envelopeToCOSE(ctx context.Context, env *dsse.Envelope) error {
+	signer, coseSigner, err := o.getSigners()
+	if err != nil {
+		return err
+	}
+
+	envVerifier, err := dsse.NewEnvelopeVerifier(signer)
+	if err != nil {
+		return err
+	}
+	if _, err := envVerifier.Verify(ctx, env); err != nil {
+		return fmt.Errorf("envelope is not signed by '%s': %w", o.sshKeyPath, err)
+	}
+
+	payload, err := env.DecodeB64Payload()
+	if err != nil {
+		return err
+	}
+	message, err := cose.NewMessage(cose.Format(o.to), env.PayloadType, payload)
+	if err != nil {
+		return err
+	}
+	if err := message.Sign(coseSigner); err != nil {
+		return err
+	}
+
+	messageBytes, err := cose.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return common.WriteBinaryFile(o.outputPath, messageBytes)
+}
+
+// coseToTarget verifies the COSE structure's signature by the key, and signs
+// its payload as an envelope or as another COSE structure using the key.
+func (o *options) coseToTarget(ctx context.Context, message *cose.Message, toCOSE bool) error {
+	signer, coseSigner, err := o.getSigners()
+	if err != nil {
+		return err
+	}
+
+	if _, err := cose.Verify(message, 1, signer); err != nil {
+		return fmt.Errorf("COSE structure is not signed by '%s': %w", o.sshKeyPath, err)
+	}
+
+	if toCOSE {
+		converted, err := cose.NewMessage(cose.Format(o.to), message.ContentType, message.Payload)
+		if err != nil {
+			return err
+		}
+		if err := converted.Sign(coseSigner); err != nil {
+			return err
+		}
+		messageBytes, err := cose.Marshal(converted)
+		if err != nil {
+			return err
+		}
+		return common.WriteBinaryFile(o.outputPath, messageBytes)
+	}
+
+	env := &dsse.Envelope{
+		PayloadType: message.ContentType,
+		Payload:     base64.StdEncoding.EncodeToString(message.Payload),
+		Signatures:  []dsse.Signature{},
+	}
+	if err := dsse.AddSignature(ctx, env, signer); err != nil {
+		return err
+	}
+	return common.WriteEnvelope(o.outputPath, env, dsse.Format(o.to))
+}
+
+// getSigners returns the SSH signer for the key, and the COSE signer for its
+// private key, which fails if COSE does not support the key's algorithm.
+func (o *options) getSigners() (*ssh.Signer, *cose.Signer, error) {
+	if o.sshKeyPath == "" {
+		return nil, nil, ErrKeyRequired
+	}
+
+	signer, err := ssh.NewSignerFromFile(o.sshKeyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	coseSigner, err := cose.NewSigner(signer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signer, coseSigner, nil
+}
+
+func New() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:   "convert",
+		Short: "Convert between DSSE envelope formats and COSE structures",
+		Long: `Convert between DSSE envelope formats and COSE structures.
+
+DSSE envelopes can be converted between JSON and the protobuf encodings with
+their signatures, as all of them encode the same envelope.
+
+DSSE envelopes and COSE_Sign1 or COSE_Sign structures (RFC 9052) sign
+different encodings of the payload, so signatures cannot be copied between
+them. Instead, the signature by the SSH key specified using --key is verified,
+and the payload is signed again in the target format using the same key. The
+key must be an unencrypted private key whose algorithm COSE supports: ECDSA
+keys on the P-256, P-384, or P-521 curves, Ed25519 keys, or RSA keys, which are
+used with RSASSA-PSS. The DSSE payload type is recorded as the COSE content
+type. For example:
+
+  essd convert --to cose-sign1 -k key -o release.cose release.dsse
+
+The input is read from stdin if its path is "-".`,
+		Args:              cobra.ExactArgs(1),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
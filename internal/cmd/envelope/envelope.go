@@ -0,0 +1,22 @@
+package envelope
+
+import (
+	"github.com/adityasaky/essd/internal/cmd/envelope/removesig"
+	"github.com/adityasaky/essd/internal/cmd/envelope/setkeyid"
+	"github.com/adityasaky/essd/internal/cmd/envelope/stripextensions"
+	"github.com/spf13/cobra"
+)
+
+func New() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "envelope",
+		Short:             "Edit the signatures of DSSE envelopes",
+		DisableAutoGenTag: true,
+	}
+
+	cmd.AddCommand(removesig.New())
+	cmd.AddCommand(setkeyid.New())
+	cmd.AddCommand(stripextensions.New())
+
+	return cmd
+}
@@ -0,0 +1,58 @@
+package removesig
+
+import (
+	"github.com/adityasaky/essd/internal/cmd/common"
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	editOptions      common.EditOptions
+	selectionOptions common.SignatureSelectionOptions
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	o.selectionOptions.AddFlags(cmd)
+	cmd.MarkFlagsOneRequired("key-id", "index")
+
+	o.editOptions.AddFlags(cmd)
+}
+
+func (o *options) Run(_ *cobra.Command, args []string) error {
+	return o.editOptions.Edit(args[0], func(env *dsse.Envelope) error {
+		selected, err := o.selectionOptions.Selected(env)
+		if err != nil {
+			return err
+		}
+
+		signatures := []dsse.Signature{}
+		for i, sig := range env.Signatures {
+			if !selected(i) {
+				signatures = append(signatures, sig)
+			}
+		}
+		env.Signatures = signatures
+
+		return nil
+	})
+}
+
+func New() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:   "remove-sig",
+		Short: "Remove signatures from DSSE envelope",
+		Long: `Remove signatures from DSSE envelope.
+
+Signatures are selected by key ID using --key-id, which removes every signature
+with the key ID, or by their index in the envelope using --index. Use
+--dry-run to list the signatures before and after removal. An envelope is not
+left with no signatures unless --force is used.`,
+		Args:              cobra.ExactArgs(1),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
@@ -0,0 +1,66 @@
+package setkeyid
+
+import (
+	"github.com/adityasaky/essd/internal/cmd/common"
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	editOptions      common.EditOptions
+	selectionOptions common.SignatureSelectionOptions
+
+	newKeyID string
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	o.selectionOptions.AddFlags(cmd)
+	cmd.MarkFlagsOneRequired("key-id", "index")
+
+	cmd.Flags().StringVar(
+		&o.newKeyID,
+		"new-key-id",
+		"",
+		"key ID to set for selected signatures (an empty key ID removes it)",
+	)
+	cmd.MarkFlagRequired("new-key-id") //nolint:errcheck
+
+	o.editOptions.AddFlags(cmd)
+}
+
+func (o *options) Run(_ *cobra.Command, args []string) error {
+	return o.editOptions.Edit(args[0], func(env *dsse.Envelope) error {
+		selected, err := o.selectionOptions.Selected(env)
+		if err != nil {
+			return err
+		}
+
+		for i := range env.Signatures {
+			if selected(i) {
+				env.Signatures[i].KeyID = o.newKeyID
+			}
+		}
+
+		return nil
+	})
+}
+
+func New() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:   "set-keyid",
+		Short: "Set the key ID of signatures in DSSE envelope",
+		Long: `Set the key ID of signatures in DSSE envelope.
+
+The signatures to update are selected by their current key ID using --key-id
+or by index using --index, and their key ID is set to --new-key-id. Key IDs are
+hints that are not signed, so signatures remain valid. Use --dry-run to list
+the signatures before and after the edit.`,
+		Args:              cobra.ExactArgs(1),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
@@ -0,0 +1,59 @@
+package stripextensions
+
+import (
+	"github.com/adityasaky/essd/internal/cmd/common"
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	editOptions      common.EditOptions
+	selectionOptions common.SignatureSelectionOptions
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	o.selectionOptions.AddFlags(cmd)
+	o.editOptions.AddFlags(cmd)
+}
+
+func (o *options) Run(_ *cobra.Command, args []string) error {
+	return o.editOptions.Edit(args[0], func(env *dsse.Envelope) error {
+		selected := func(int) bool { return true }
+		if o.selectionOptions.IsSet() {
+			var err error
+			selected, err = o.selectionOptions.Selected(env)
+			if err != nil {
+				return err
+			}
+		}
+
+		for i := range env.Signatures {
+			if selected(i) {
+				env.Signatures[i].Extension = nil
+			}
+		}
+
+		return nil
+	})
+}
+
+func New() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:   "strip-extensions",
+		Short: "Remove extensions from signatures in DSSE envelope",
+		Long: `Remove extensions from signatures in DSSE envelope.
+
+Extensions are removed from every signature, or from the signatures selected by
+key ID using --key-id or by index using --index. Sigstore signatures cannot be
+verified once their extension, which holds their certificate and transparency
+log entry, is removed. Use --dry-run to list the signatures before and after
+the edit.`,
+		Args:              cobra.ExactArgs(1),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
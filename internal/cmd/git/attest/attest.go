@@ -0,0 +1,107 @@
+package attest
+
+import (
+	"fmt"
+
+	"github.com/adityasaky/essd/internal/cmd/common"
+	"github.com/adityasaky/essd/internal/git"
+	"github.com/adityasaky/essd/internal/intoto"
+	ita1 "github.com/in-toto/attestation/go/v1"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	signerOptions            common.SignerOptions
+	payloadValidationOptions common.PayloadValidationOptions
+	predicateOptions         common.PredicateOptions
+
+	repository string
+	notesRef   string
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	o.signerOptions.AddFlags(cmd)
+	o.payloadValidationOptions.AddFlags(cmd)
+	o.predicateOptions.AddFlags(cmd)
+
+	cmd.Flags().StringVarP(
+		&o.repository,
+		"repository",
+		"C",
+		".",
+		"path of git repository",
+	)
+
+	cmd.Flags().StringVar(
+		&o.notesRef,
+		"notes-ref",
+		git.DefaultNotesRef,
+		"notes ref to store envelope under",
+	)
+}
+
+func (o *options) Run(cmd *cobra.Command, args []string) error {
+	repo, err := git.Open(o.repository)
+	if err != nil {
+		return err
+	}
+
+	object, err := repo.ResolveObject(args[0])
+	if err != nil {
+		return err
+	}
+
+	predicateType, predicate, err := o.predicateOptions.GetPredicate()
+	if err != nil {
+		return err
+	}
+
+	statement, err := intoto.NewStatement([]*ita1.ResourceDescriptor{object.Subject()}, predicateType, predicate)
+	if err != nil {
+		return err
+	}
+
+	registry, err := o.payloadValidationOptions.GetRegistry()
+	if err != nil {
+		return err
+	}
+
+	signer, err := o.signerOptions.GetSigner(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	env, err := common.SignStatement(cmd.Context(), statement, registry, signer)
+	if err != nil {
+		return err
+	}
+
+	if err := repo.AddEnvelope(o.notesRef, object.ID, env); err != nil {
+		return err
+	}
+
+	fmt.Printf("Attached attestation to %s %s under %s\n", object.Type, object.ID, o.notesRef)
+	return nil
+}
+
+func New() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:   "attest <revision>",
+		Short: "Create signed in-toto attestation for a git commit or tag",
+		Long: `Create signed in-toto attestation for a git commit or tag.
+
+The statement's subject is the object the revision resolves to, recorded using
+its gitCommit or gitTag digest and named using the ref the revision names, if
+any. Annotated tags are attested rather than the commits they tag. The envelope
+is stored as a git note on the object, under refs/notes/essd by default,
+alongside envelopes already attached to it. Notes refs are not pushed by
+default, use git push <remote> refs/notes/essd to publish them.`,
+		Args:              cobra.ExactArgs(1),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
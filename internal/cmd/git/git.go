@@ -0,0 +1,20 @@
+package git
+
+import (
+	"github.com/adityasaky/essd/internal/cmd/git/attest"
+	"github.com/adityasaky/essd/internal/cmd/git/verify"
+	"github.com/spf13/cobra"
+)
+
+func New() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "git",
+		Short:             "Attach and verify attestations for git objects",
+		DisableAutoGenTag: true,
+	}
+
+	cmd.AddCommand(attest.New())
+	cmd.AddCommand(verify.New())
+
+	return cmd
+}
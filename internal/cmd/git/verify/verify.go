@@ -0,0 +1,161 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/git"
+	"github.com/adityasaky/essd/internal/intoto"
+	"github.com/adityasaky/essd/internal/key"
+	"github.com/spf13/cobra"
+)
+
+var ErrNoVerifiedAttestation = errors.New("no attestation for the object could be verified")
+
+type options struct {
+	publicKeys    []string
+	predicateType string
+
+	repository string
+	notesRef   string
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(
+		&o.publicKeys,
+		"key",
+		"k",
+		nil,
+		"key to use for verifying signatures (specify sigstore using fulcio:<identity>::<issuer>)",
+	)
+	cmd.MarkFlagRequired("key") //nolint:errcheck
+
+	cmd.Flags().StringVar(
+		&o.predicateType,
+		"predicate-type",
+		"",
+		"only consider attestations with this predicate type",
+	)
+
+	cmd.Flags().StringVarP(
+		&o.repository,
+		"repository",
+		"C",
+		".",
+		"path of git repository",
+	)
+
+	cmd.Flags().StringVar(
+		&o.notesRef,
+		"notes-ref",
+		git.DefaultNotesRef,
+		"notes ref envelopes are stored under",
+	)
+}
+
+func (o *options) Run(cmd *cobra.Command, args []string) error {
+	repo, err := git.Open(o.repository)
+	if err != nil {
+		return err
+	}
+
+	object, err := repo.ResolveObject(args[0])
+	if err != nil {
+		return err
+	}
+
+	envs, err := repo.Envelopes(o.notesRef, object.ID)
+	if err != nil {
+		return err
+	}
+
+	verifiers := []dsse.Verifier{}
+	for _, keyRef := range o.publicKeys {
+		verifier, err := key.NewVerifier(keyRef)
+		if err != nil {
+			return err
+		}
+		verifiers = append(verifiers, verifier)
+	}
+	envVerifier, err := dsse.NewMultiEnvelopeVerifier(1, verifiers...)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Attestations for %s %s:\n", object.Type, object.ID)
+	if len(envs) == 0 {
+		fmt.Printf("\tnone found under %s\n", o.notesRef)
+	}
+
+	verified := 0
+	for i, env := range envs {
+		statement, err := intoto.StatementFromEnvelope(env)
+		if err != nil {
+			fmt.Printf("\tFAIL envelope %d: %s\n", i+1, err)
+			continue
+		}
+		if o.predicateType != "" && statement.GetPredicateType() != o.predicateType {
+			fmt.Printf("\tSKIP envelope %d: predicate type '%s'\n", i+1, statement.GetPredicateType())
+			continue
+		}
+
+		matched := false
+		for _, subject := range statement.GetSubject() {
+			if object.Matches(subject) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fmt.Printf("\tFAIL envelope %d: no subject of the statement matches the object\n", i+1)
+			continue
+		}
+
+		acceptedKeys, err := envVerifier.Verify(cmd.Context(), env)
+		if err != nil {
+			fmt.Printf("\tFAIL envelope %d: %s\n", i+1, err)
+			continue
+		}
+		signers, err := key.VerifiedSigners(acceptedKeys, verifiers, o.publicKeys)
+		if err != nil {
+			return err
+		}
+		names := []string{}
+		for _, signer := range signers {
+			names = append(names, signer.Name)
+		}
+
+		fmt.Printf("\tPASS envelope %d: predicate type '%s' signed by %s\n", i+1, statement.GetPredicateType(), strings.Join(names, ", "))
+		verified++
+	}
+
+	if verified == 0 {
+		return ErrNoVerifiedAttestation
+	}
+	return nil
+}
+
+func New() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:   "verify <revision>",
+		Short: "Verify in-toto attestations attached to a git commit or tag",
+		Long: `Verify in-toto attestations attached to a git commit or tag.
+
+The envelopes attached to the object the revision resolves to are verified
+using the specified keys, and the statements they carry must record the object
+as a subject. Fetch the notes ref of a remote to verify attestations published
+there, e.g. using git fetch <remote> refs/notes/essd:refs/notes/essd.
+
+The result for each envelope is reported, and verification succeeds if at
+least one attestation is verified.`,
+		Args:              cobra.ExactArgs(1),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
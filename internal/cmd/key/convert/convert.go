@@ -0,0 +1,70 @@
+package convert
+
+import (
+	"os"
+
+	"github.com/adityasaky/essd/internal/key"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	format     string
+	outputPath string
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(
+		&o.format,
+		"format",
+		"f",
+		"",
+		"format to convert key to (openssh, rfc4716, pem, sslib)",
+	)
+	cmd.MarkFlagRequired("format") //nolint:errcheck
+
+	cmd.Flags().StringVarP(
+		&o.outputPath,
+		"output",
+		"o",
+		"",
+		"output path to write converted key (default stdout)",
+	)
+}
+
+func (o *options) Run(_ *cobra.Command, args []string) error {
+	k, err := key.Load(args[0])
+	if err != nil {
+		return err
+	}
+
+	keyBytes, err := k.Marshal(key.Format(o.format))
+	if err != nil {
+		return err
+	}
+
+	if o.outputPath == "" {
+		_, err := os.Stdout.Write(keyBytes)
+		return err
+	}
+
+	perm := os.FileMode(0o644)
+	if k.Private != nil && key.Format(o.format) != key.FormatRFC4716 {
+		perm = 0o600
+	}
+	return os.WriteFile(o.outputPath, keyBytes, perm)
+}
+
+func New() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:               "convert",
+		Short:             "Convert a key between OpenSSH, RFC 4716, PEM, and securesystemslib JSON formats",
+		Long:              "Convert a key between OpenSSH, RFC 4716, PEM, and securesystemslib JSON formats. Private key material is preserved, except when converting to RFC 4716, which only holds public keys; encrypted private keys can only be converted to RFC 4716.",
+		Args:              cobra.ExactArgs(1),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
@@ -0,0 +1,64 @@
+package exportpublic
+
+import (
+	"os"
+
+	"github.com/adityasaky/essd/internal/key"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	format     string
+	outputPath string
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(
+		&o.format,
+		"format",
+		"f",
+		string(key.FormatOpenSSH),
+		"format to export public key in (openssh, rfc4716, pem, sslib)",
+	)
+
+	cmd.Flags().StringVarP(
+		&o.outputPath,
+		"output",
+		"o",
+		"",
+		"output path to write public key (default stdout)",
+	)
+}
+
+func (o *options) Run(_ *cobra.Command, args []string) error {
+	k, err := key.Load(args[0])
+	if err != nil {
+		return err
+	}
+
+	keyBytes, err := k.MarshalPublic(key.Format(o.format))
+	if err != nil {
+		return err
+	}
+
+	if o.outputPath == "" {
+		_, err := os.Stdout.Write(keyBytes)
+		return err
+	}
+
+	return os.WriteFile(o.outputPath, keyBytes, 0o644)
+}
+
+func New() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:               "export-public",
+		Short:             "Export the public portion of a key",
+		Args:              cobra.ExactArgs(1),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
@@ -0,0 +1,69 @@
+package id
+
+import (
+	"fmt"
+
+	"github.com/adityasaky/essd/internal/key"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	kind string
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(
+		&o.kind,
+		"kind",
+		"",
+		"print only the key ID of the specified kind (ssh, sslib, sigstore)",
+	)
+}
+
+func (o *options) Run(_ *cobra.Command, args []string) error {
+	for _, keyRef := range args {
+		k, err := key.Load(keyRef)
+		if err != nil {
+			return err
+		}
+
+		ids, err := k.IDs()
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for _, keyID := range ids {
+			switch {
+			case o.kind == "":
+				fmt.Printf("%s\t%s\n", keyID.Kind, keyID.Value)
+			case o.kind == keyID.Kind:
+				fmt.Println(keyID.Value)
+			default:
+				continue
+			}
+			found = true
+		}
+
+		if !found {
+			return fmt.Errorf("key '%s' has no key ID of kind '%s'", keyRef, o.kind)
+		}
+	}
+
+	return nil
+}
+
+func New() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:               "id",
+		Short:             "Print every form of key ID essd may use for the specified keys",
+		Long:              "Print every form of key ID essd may use for the specified keys. Keys may be specified as paths to OpenSSH, RFC 4716, PEM, or securesystemslib JSON files, or as Sigstore identities using fulcio:<identity>::<issuer>.",
+		Args:              cobra.MinimumNArgs(1),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
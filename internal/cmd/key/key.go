@@ -0,0 +1,24 @@
+package key
+
+import (
+	"github.com/adityasaky/essd/internal/cmd/key/convert"
+	"github.com/adityasaky/essd/internal/cmd/key/exportpublic"
+	"github.com/adityasaky/essd/internal/cmd/key/id"
+	"github.com/adityasaky/essd/internal/cmd/key/show"
+	"github.com/spf13/cobra"
+)
+
+func New() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "key",
+		Short:             "Inspect, convert, and fingerprint keys",
+		DisableAutoGenTag: true,
+	}
+
+	cmd.AddCommand(convert.New())
+	cmd.AddCommand(exportpublic.New())
+	cmd.AddCommand(id.New())
+	cmd.AddCommand(show.New())
+
+	return cmd
+}
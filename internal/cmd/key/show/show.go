@@ -0,0 +1,63 @@
+package show
+
+import (
+	"fmt"
+
+	"github.com/adityasaky/essd/internal/key"
+	"github.com/spf13/cobra"
+)
+
+type options struct{}
+
+func (o *options) Run(_ *cobra.Command, args []string) error {
+	for _, keyRef := range args {
+		k, err := key.Load(keyRef)
+		if err != nil {
+			return err
+		}
+
+		ids, err := k.IDs()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Key %s:\n", keyRef)
+		fmt.Printf("\tFormat: %s\n", k.Format)
+		fmt.Printf("\tType: %s\n", k.Type())
+		if k.IsSigstore() {
+			fmt.Printf("\tIdentity: %s\n", k.Identity)
+			fmt.Printf("\tIssuer: %s\n", k.Issuer)
+		} else {
+			switch {
+			case k.Private != nil:
+				fmt.Printf("\tPrivate key: yes\n")
+			case k.Encrypted:
+				fmt.Printf("\tPrivate key: yes (encrypted)\n")
+			default:
+				fmt.Printf("\tPrivate key: no\n")
+			}
+		}
+		if k.Comment != "" {
+			fmt.Printf("\tComment: %s\n", k.Comment)
+		}
+		fmt.Printf("\tKey IDs:\n")
+		for _, keyID := range ids {
+			fmt.Printf("\t\t%s: %s\n", keyID.Kind, keyID.Value)
+		}
+	}
+
+	return nil
+}
+
+func New() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:               "show",
+		Short:             "Show details of the specified keys",
+		Args:              cobra.MinimumNArgs(1),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+
+	return cmd
+}
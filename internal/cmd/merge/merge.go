@@ -0,0 +1,77 @@
+package merge
+
+import (
+	"github.com/adityasaky/essd/internal/cmd/common"
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	outputPath    string
+	formatOptions common.FormatOptions
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(
+		&o.outputPath,
+		"output",
+		"o",
+		"",
+		"output path to write merged envelope (\"-\" for stdout)",
+	)
+	cmd.MarkFlagRequired("output") //nolint:errcheck
+
+	o.formatOptions.AddFlags(cmd)
+}
+
+func (o *options) Run(_ *cobra.Command, args []string) error {
+	envelopes := []*dsse.Envelope{}
+	var inputFormat dsse.Format
+	for _, path := range args {
+		env, format, err := common.ReadEnvelopeFormat(path)
+		if err != nil {
+			return err
+		}
+		// The merged envelope is written in the format of the first envelope
+		// by default
+		if inputFormat == "" {
+			inputFormat = format
+		}
+		envelopes = append(envelopes, env)
+	}
+
+	format, err := o.formatOptions.GetFormat(inputFormat)
+	if err != nil {
+		return err
+	}
+
+	merged, err := dsse.Merge(envelopes...)
+	if err != nil {
+		return err
+	}
+
+	return common.WriteEnvelope(o.outputPath, merged, format)
+}
+
+func New() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:   "merge",
+		Short: "Merge signatures from DSSE envelopes with the same payload",
+		Long: `Merge signatures from DSSE envelopes with the same payload.
+
+Signers can sign copies of an envelope in parallel, and the signed copies can
+then be combined into a single envelope. The envelopes must have the same
+payload and payload type. Signatures that appear in several envelopes with the
+same key ID and signature are included once, and signature extensions are
+preserved. One of the envelopes can be read from stdin using "-". For example:
+
+  essd merge alice.dsse bob.dsse -o release.dsse`,
+		Args:              cobra.MinimumNArgs(2),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
@@ -0,0 +1,60 @@
+package attach
+
+import (
+	"fmt"
+
+	"github.com/adityasaky/essd/internal/cmd/common"
+	"github.com/adityasaky/essd/internal/oci"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	insecure bool
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(
+		&o.insecure,
+		"insecure",
+		false,
+		"allow accessing the registry over plain HTTP",
+	)
+}
+
+func (o *options) Run(cmd *cobra.Command, args []string) error {
+	env, err := common.ReadEnvelope(args[1])
+	if err != nil {
+		return err
+	}
+
+	client := oci.NewClient(cmd.Context(), o.insecure)
+	artifactRef, err := client.Attach(args[0], env)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Attached envelope to %s as %s\n", args[0], artifactRef)
+	return nil
+}
+
+func New() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:   "attach <image-ref> <envelope>",
+		Short: "Attach envelope to an artifact in an OCI registry",
+		Long: `Attach envelope to an artifact in an OCI registry.
+
+The envelope is pushed to the artifact's repository as an OCI artifact with the
+artifact type application/vnd.dsse.envelope.v1+json, whose subject is the
+artifact the reference resolves to. Registries that support the referrers API
+index it automatically; for other registries, the referrers tag for the
+artifact is updated. Registry credentials are read from the docker
+configuration. The envelope is read from stdin if its path is "-".`,
+		Args:              cobra.ExactArgs(2),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
@@ -0,0 +1,20 @@
+package oci
+
+import (
+	"github.com/adityasaky/essd/internal/cmd/oci/attach"
+	"github.com/adityasaky/essd/internal/cmd/oci/verify"
+	"github.com/spf13/cobra"
+)
+
+func New() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "oci",
+		Short:             "Attach and verify envelopes for artifacts in OCI registries",
+		DisableAutoGenTag: true,
+	}
+
+	cmd.AddCommand(attach.New())
+	cmd.AddCommand(verify.New())
+
+	return cmd
+}
@@ -0,0 +1,112 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/adityasaky/essd/internal/cmd/common"
+	"github.com/adityasaky/essd/internal/intoto"
+	"github.com/adityasaky/essd/internal/oci"
+	"github.com/spf13/cobra"
+)
+
+var ErrNoVerifiedEnvelope = errors.New("no envelope attached to the artifact could be verified")
+
+type options struct {
+	verificationOptions common.VerificationOptions
+
+	insecure             bool
+	allowUnboundPayloads bool
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	o.verificationOptions.AddFlags(cmd)
+
+	cmd.Flags().BoolVar(
+		&o.insecure,
+		"insecure",
+		false,
+		"allow accessing the registry over plain HTTP",
+	)
+
+	cmd.Flags().BoolVar(
+		&o.allowUnboundPayloads,
+		"allow-unbound-payloads",
+		false,
+		"accept envelopes whose payloads are not in-toto statements, which are not bound to the artifact and may have been copied from another artifact",
+	)
+}
+
+func (o *options) Run(cmd *cobra.Command, args []string) error {
+	client := oci.NewClient(cmd.Context(), o.insecure)
+
+	subject, err := client.Resolve(args[0])
+	if err != nil {
+		return err
+	}
+
+	attached, err := client.Envelopes(subject)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Envelopes attached to %s:\n", subject)
+	if len(attached) == 0 {
+		fmt.Println("\tnone found")
+	}
+
+	verified := 0
+	for _, artifact := range attached {
+		if artifact.Err != nil {
+			fmt.Printf("\tFAIL %s: %s\n", artifact.Digest.DigestStr(), artifact.Err)
+			continue
+		}
+
+		signers, err := o.verificationOptions.Verify(cmd.Context(), artifact.Digest.DigestStr(), artifact.Envelope)
+		if err == nil && !(o.allowUnboundPayloads && artifact.Envelope.PayloadType != intoto.PayloadType) {
+			err = oci.CheckSubject(artifact.Envelope, subject)
+		}
+		if err != nil {
+			fmt.Printf("\tFAIL %s: %s\n", artifact.Digest.DigestStr(), err)
+			continue
+		}
+
+		names := []string{}
+		for _, signer := range signers {
+			names = append(names, signer.Name)
+		}
+		fmt.Printf("\tPASS %s: signed by %s\n", artifact.Digest.DigestStr(), strings.Join(names, ", "))
+		verified++
+	}
+
+	if verified == 0 {
+		return ErrNoVerifiedEnvelope
+	}
+	return nil
+}
+
+func New() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:   "verify <image-ref>",
+		Short: "Verify envelopes attached to an artifact in an OCI registry",
+		Long: `Verify envelopes attached to an artifact in an OCI registry.
+
+Envelopes attached to the artifact the reference resolves to are discovered
+using the referrers API, falling back to the referrers tag for registries that
+do not support it. Each envelope is verified using the specified keys or
+policy, and must hold an in-toto statement that records the artifact's digest
+as a subject. Envelopes with other payload types are only accepted with
+--allow-unbound-payloads, as nothing binds them to the artifact.
+
+The result for each envelope is reported, and verification succeeds if at
+least one envelope is verified.`,
+		Args:              cobra.ExactArgs(1),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
@@ -1,22 +1,74 @@
 package cmd
 
 import (
+	"github.com/adityasaky/essd/internal/cmd/attest"
 	"github.com/adityasaky/essd/internal/cmd/cat"
+	"github.com/adityasaky/essd/internal/cmd/common"
+	"github.com/adityasaky/essd/internal/cmd/config"
+	"github.com/adityasaky/essd/internal/cmd/convert"
+	"github.com/adityasaky/essd/internal/cmd/envelope"
+	"github.com/adityasaky/essd/internal/cmd/git"
+	"github.com/adityasaky/essd/internal/cmd/key"
+	"github.com/adityasaky/essd/internal/cmd/merge"
+	"github.com/adityasaky/essd/internal/cmd/oci"
+	"github.com/adityasaky/essd/internal/cmd/serve"
 	"github.com/adityasaky/essd/internal/cmd/sign"
+	"github.com/adityasaky/essd/internal/cmd/tlog"
 	"github.com/adityasaky/essd/internal/cmd/verify"
+	"github.com/adityasaky/essd/internal/cmd/verifylayout"
 	"github.com/spf13/cobra"
 )
 
 func New() *cobra.Command {
+	o := &common.ConfigOptions{}
+	logOpts := &common.LoggingOptions{}
 	rootCmd := &cobra.Command{
-		Use:               "essd",
-		Short:             "A tool to sign, verify, and inspect DSSE envelopes",
+		Use:   "essd",
+		Short: "A tool to sign, verify, and inspect DSSE envelopes",
+		Long: `A tool to sign, verify, and inspect DSSE envelopes.
+
+Flags that are not specified on the command line are read from ESSD_*
+environment variables and the configuration file, which can declare profiles
+selected using --profile. See docs/configuration.md for details, and use essd
+config show to show the effective configuration.
+
+Diagnostics are logged to stderr at the level selected using --log-level, in
+the format selected using --log-format. Use --log-level debug to follow each
+step of signature verification.`,
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			// Logging is configured before loading the configuration, so
+			// that the logging flags apply to commands that skip it, and
+			// again after, as the configuration may set the logging flags
+			if err := logOpts.Configure(cmd.ErrOrStderr()); err != nil {
+				return err
+			}
+			if _, skip := cmd.Annotations[common.SkipConfigAnnotation]; skip {
+				return nil
+			}
+			if err := o.Load(cmd); err != nil {
+				return err
+			}
+			return logOpts.Configure(cmd.ErrOrStderr())
+		},
 		DisableAutoGenTag: true,
 	}
+	o.AddFlags(rootCmd)
+	logOpts.AddFlags(rootCmd)
 
+	rootCmd.AddCommand(attest.New())
 	rootCmd.AddCommand(cat.New())
+	rootCmd.AddCommand(config.New())
+	rootCmd.AddCommand(convert.New())
+	rootCmd.AddCommand(envelope.New())
+	rootCmd.AddCommand(git.New())
+	rootCmd.AddCommand(key.New())
+	rootCmd.AddCommand(merge.New())
+	rootCmd.AddCommand(oci.New())
+	rootCmd.AddCommand(serve.New())
 	rootCmd.AddCommand(sign.New())
+	rootCmd.AddCommand(tlog.New())
 	rootCmd.AddCommand(verify.New())
+	rootCmd.AddCommand(verifylayout.New())
 
 	return rootCmd
 }
@@ -0,0 +1,319 @@
+package serve
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/adityasaky/essd/internal/remote"
+	"github.com/adityasaky/essd/internal/server"
+	"github.com/adityasaky/essd/internal/ssh"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ErrSignerTLS   = errors.New("--signer requires --tls-cert and --tls-key, as clients authenticate using credentials")
+	ErrClientCATLS = errors.New("--client-ca requires --tls-cert and --tls-key")
+	ErrSignerKey   = errors.New("--signer must be the path of an SSH key, signing services cannot be used")
+)
+
+const (
+	readHeaderTimeout = 10 * time.Second
+	shutdownTimeout   = 30 * time.Second
+)
+
+type options struct {
+	address        string
+	policies       []string
+	keys           []string
+	maxRequestSize int64
+
+	signerKeyPath string
+	clientsPath   string
+	auditLogPath  string
+
+	tlsCertPath  string
+	tlsKeyPath   string
+	clientCAPath string
+
+	namespacePolicies  []string
+	insecureRegistries bool
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(
+		&o.address,
+		"address",
+		":8080",
+		"address to listen on",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&o.policies,
+		"policy",
+		nil,
+		"policy to verify envelopes against, as name=path",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&o.keys,
+		"key",
+		nil,
+		"key to verify envelopes with, as name=path or name=fulcio:<identity>::<issuer>",
+	)
+
+	cmd.Flags().Int64Var(
+		&o.maxRequestSize,
+		"max-request-size",
+		server.DefaultMaxRequestSize,
+		"maximum size of request bodies in bytes",
+	)
+
+	cmd.Flags().StringVar(
+		&o.signerKeyPath,
+		"signer",
+		"",
+		"path of SSH key to sign payloads with for clients (only SSH keys are supported)",
+	)
+
+	cmd.Flags().StringVar(
+		&o.clientsPath,
+		"clients",
+		"",
+		"path of file declaring the clients allowed to request signatures",
+	)
+
+	cmd.Flags().StringVar(
+		&o.auditLogPath,
+		"audit-log",
+		"",
+		"path of file to append the audit log of signing requests to (default: stderr)",
+	)
+
+	cmd.MarkFlagsRequiredTogether("signer", "clients")
+
+	cmd.Flags().StringVar(
+		&o.tlsCertPath,
+		"tls-cert",
+		"",
+		"path of PEM encoded certificate to serve HTTPS with",
+	)
+
+	cmd.Flags().StringVar(
+		&o.tlsKeyPath,
+		"tls-key",
+		"",
+		"path of PEM encoded private key of the certificate specified using --tls-cert",
+	)
+
+	cmd.MarkFlagsRequiredTogether("tls-cert", "tls-key")
+
+	cmd.Flags().StringVar(
+		&o.clientCAPath,
+		"client-ca",
+		"",
+		"path of PEM encoded CA certificates to verify client certificates with",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&o.namespacePolicies,
+		"namespace-policy",
+		nil,
+		"policy to verify images of workloads in a Kubernetes namespace against, as namespace=policy (\"*\" for other namespaces)",
+	)
+
+	cmd.Flags().BoolVar(
+		&o.insecureRegistries,
+		"insecure-registry",
+		false,
+		"allow accessing registries over plain HTTP when reviewing admission requests",
+	)
+}
+
+func (o *options) Run(cmd *cobra.Command, _ []string) error {
+	policies, err := parseNamed("policy", o.policies)
+	if err != nil {
+		return err
+	}
+	keys, err := parseNamed("key", o.keys)
+	if err != nil {
+		return err
+	}
+
+	namespacePolicies, err := parseNamed("namespace-policy", o.namespacePolicies)
+	if err != nil {
+		return err
+	}
+
+	config := server.Config{
+		Policies:           policies,
+		Keys:               keys,
+		MaxRequestSize:     o.maxRequestSize,
+		NamespacePolicies:  namespacePolicies,
+		InsecureRegistries: o.insecureRegistries,
+	}
+	if o.signerKeyPath != "" {
+		if o.tlsCertPath == "" {
+			return ErrSignerTLS
+		}
+		// Sigstore requires interactive authentication, and signing services
+		// would only relay requests, so the server signs using SSH keys
+		if strings.HasPrefix(o.signerKeyPath, remote.Prefix) {
+			return ErrSignerKey
+		}
+
+		config.Signer, err = ssh.NewSignerFromFile(o.signerKeyPath)
+		if err != nil {
+			return err
+		}
+		config.ClientsPath = o.clientsPath
+
+		if o.auditLogPath != "" {
+			auditLog, err := os.OpenFile(o.auditLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+			if err != nil {
+				return err
+			}
+			defer auditLog.Close() //nolint:errcheck
+			config.AuditLog = auditLog
+		}
+	}
+
+	tlsConfig, err := o.getTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	s, err := server.New(config)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- s.Watch(ctx)
+	}()
+
+	httpServer := &http.Server{
+		Addr:              o.address,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: readHeaderTimeout,
+		TLSConfig:         tlsConfig,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			serveErr <- httpServer.ListenAndServeTLS(o.tlsCertPath, o.tlsKeyPath)
+			return
+		}
+		serveErr <- httpServer.ListenAndServe()
+	}()
+	slog.Info("Listening", slog.String("address", o.address))
+
+	select {
+	case err := <-serveErr:
+		return err
+	case err := <-watchErr:
+		if err != nil {
+			return err
+		}
+	case <-ctx.Done():
+	}
+
+	// Requests in progress are completed before shutting down
+	s.Drain()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// getTLSConfig returns the TLS configuration of the server, which is nil if
+// the server does not use TLS. Clients present certificates optionally, so
+// that other clients can authenticate using tokens.
+func (o *options) getTLSConfig() (*tls.Config, error) {
+	if o.tlsCertPath == "" {
+		if o.clientCAPath != "" {
+			return nil, ErrClientCATLS
+		}
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if o.clientCAPath != "" {
+		caBytes, err := os.ReadFile(o.clientCAPath)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("no certificates found in '%s'", o.clientCAPath)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// parseNamed parses values of the form name=value of the flag.
+func parseNamed(flag string, values []string) (map[string]string, error) {
+	named := map[string]string{}
+	for _, value := range values {
+		name, ref, found := strings.Cut(value, "=")
+		if !found || name == "" || ref == "" {
+			return nil, fmt.Errorf("invalid --%s '%s', expected name=value", flag, value)
+		}
+		if _, exists := named[name]; exists {
+			return nil, fmt.Errorf("--%s '%s' specified more than once", flag, name)
+		}
+		named[name] = ref
+	}
+	return named, nil
+}
+
+func New() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve an HTTP API to verify DSSE envelopes",
+		Long: `Serve an HTTP API to verify DSSE envelopes.
+
+Envelopes sent to /v1/verify are verified against the policies specified using
+--policy or the keys specified using --key, which are reloaded when their files
+change. With --signer and --clients, the server also signs payloads for the
+clients declared in the clients file at /v1/sign, for essd sign and attest
+with --key remote://<host>[:<port>]. With --namespace-policy, the server acts
+as a Kubernetes validating admission webhook at /v1/admit. Health checks are
+served at /healthz and /readyz, and Prometheus metrics at /metrics.
+
+See docs/serve.md for the API, the clients file, and the admission webhook.
+For example:
+
+  essd serve --policy release=policy.yaml --key alice=alice.pub
+  essd serve --signer key --clients clients.yaml --tls-cert tls.crt --tls-key tls.key
+  essd serve --policy prod=prod.yaml --namespace-policy production=prod \
+    --tls-cert tls.crt --tls-key tls.key`,
+		Args:              cobra.NoArgs,
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
@@ -1,50 +1,42 @@
 package sign
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log/slog"
-	"os"
+	"slices"
 
+	"github.com/adityasaky/essd/internal/cmd/common"
+	"github.com/adityasaky/essd/internal/cose"
 	"github.com/adityasaky/essd/internal/dsse"
-	"github.com/adityasaky/essd/internal/sigstore"
-	"github.com/adityasaky/essd/internal/ssh"
+	"github.com/adityasaky/essd/internal/intoto"
+	"github.com/adityasaky/essd/internal/jws"
 	"github.com/secure-systems-lab/go-securesystemslib/cjson"
-	protobundle "github.com/sigstore/protobuf-specs/gen/pb-go/bundle/v1"
 	"github.com/spf13/cobra"
-	"google.golang.org/protobuf/encoding/protojson"
-	"google.golang.org/protobuf/types/known/structpb"
 )
 
 type options struct {
-	sshKeyPath  string
-	useSigstore bool
+	signerOptions            common.SignerOptions
+	payloadValidationOptions common.PayloadValidationOptions
+	formatOptions            common.FormatOptions
+	filterOptions            common.BundleFilterOptions
 
 	payloadType string
 
 	outputPath string
+	bundlePath string
 
 	canonicalizeJson bool
+
+	stream bool
 }
 
 func (o *options) AddFlags(cmd *cobra.Command) {
-	cmd.Flags().StringVarP(
-		&o.sshKeyPath,
-		"key",
-		"k",
-		"",
-		"path of SSH key to sign with",
-	)
-
-	cmd.Flags().BoolVar(
-		&o.useSigstore,
-		"sigstore",
-		false,
-		"sign with Sigstore",
-	)
-
-	cmd.MarkFlagsOneRequired("key", "sigstore")
+	o.signerOptions.AddFlags(cmd)
+	o.payloadValidationOptions.AddFlags(cmd)
 
 	cmd.Flags().StringVarP(
 		&o.payloadType,
@@ -59,7 +51,7 @@ func (o *options) AddFlags(cmd *cobra.Command) {
 		"output",
 		"o",
 		"",
-		"output path to write envelope",
+		"output path to write envelope (\"-\" for stdout)",
 	)
 
 	cmd.Flags().BoolVar(
@@ -68,146 +60,515 @@ func (o *options) AddFlags(cmd *cobra.Command) {
 		false,
 		"encode payload using canonical JSON (specified payload MUST be JSON)",
 	)
+
+	cmd.Flags().BoolVar(
+		&o.stream,
+		"stream",
+		false,
+		"sign without holding the payload in memory (payloads are not validated)",
+	)
+
+	o.formatOptions.OtherFormats = []string{
+		string(cose.FormatSign1), string(cose.FormatSign), string(jws.FormatJSON), string(jws.FormatCompact),
+	}
+	o.formatOptions.AddFlags(cmd)
+
+	cmd.Flags().StringVar(
+		&o.bundlePath,
+		"bundle",
+		"",
+		"path of in-toto attestation bundle to append signed envelope to, which is created if it does not exist",
+	)
+	cmd.MarkFlagsMutuallyExclusive("bundle", "output")
+	cmd.MarkFlagsMutuallyExclusive("bundle", "format")
+	cmd.MarkFlagsMutuallyExclusive("bundle", "stream")
+
+	o.filterOptions.AddFlags(cmd)
+	cmd.MarkFlagsMutuallyExclusive("stream", "filter-payload-type")
+	cmd.MarkFlagsMutuallyExclusive("stream", "filter-predicate-type")
 }
 
 func (o *options) Run(cmd *cobra.Command, args []string) error {
-	payload, err := os.ReadFile(args[0])
+	if o.formatOptions.IsOther() {
+		return o.runStructure(cmd, args)
+	}
+	if o.stream {
+		return o.runStream(cmd, args)
+	}
+
+	payload, err := common.ReadFile(args[0])
 	if err != nil {
 		return err
 	}
 
+	if intoto.IsBundlePath(args[0]) {
+		envelopes, err := intoto.ParseBundle(payload)
+		if err != nil {
+			return fmt.Errorf("unable to parse bundle '%s': %w", common.DisplayName(args[0]), err)
+		}
+		return o.signBundle(cmd, args[0], envelopes)
+	}
+
 	// Check if payload is already an envelope
-	isEnvelope := false
-	env := &dsse.Envelope{}
-	var signable []byte
-	if err := json.Unmarshal(payload, env); err == nil {
+	env, inputFormat, isEnvelope := parseEnvelope(payload)
+	if !isEnvelope {
+		// Bundles are only detected if every line is an envelope
+		if envelopes, err := intoto.ParseBundle(payload); err == nil {
+			return o.signBundle(cmd, args[0], envelopes)
+		}
+	}
+	if err := o.checkFlags(args[0], isEnvelope); err != nil {
+		return err
+	}
+
+	// Existing envelopes are written in their format by default, and bundles
+	// only hold JSON envelopes
+	if o.bundlePath != "" {
+		inputFormat = dsse.FormatJSON
+	}
+	format, err := o.formatOptions.GetFormat(inputFormat)
+	if err != nil {
+		return err
+	}
+	if err := o.signerOptions.CheckFormat(format); err != nil {
+		return err
+	}
+
+	if isEnvelope {
 		slog.Debug("Envelope exists, adding signature...")
-		isEnvelope = true
-		envPayload, err := env.DecodeB64Payload()
-		if err != nil {
-			return err
+
+		if selected := o.filterOptions.Selected(&common.EnvelopeFile{Envelopes: []*dsse.Envelope{env}}); len(selected) == 0 {
+			return fmt.Errorf("%w in '%s'", common.ErrNoEnvelopeMatched, common.DisplayName(args[0]))
 		}
-		signable = envPayload
 	} else {
 		slog.Debug("Creating new envelope...")
-		signable = payload
+
+		payload, err = o.canonicalize(payload)
+		if err != nil {
+			return err
+		}
+
 		env = &dsse.Envelope{
 			PayloadType: o.payloadType,
-			Payload:     base64.StdEncoding.EncodeToString(signable),
+			Payload:     base64.StdEncoding.EncodeToString(payload),
 			Signatures:  []dsse.Signature{},
 		}
 	}
 
-	if isEnvelope {
-		if o.canonicalizeJson {
-			return fmt.Errorf("cannot use --canonicalize-json when signing existing DSSE envelope")
-		}
+	if err := o.validatePayload(env); err != nil {
+		return err
+	}
 
-		if o.outputPath != "" {
-			return fmt.Errorf("cannot use --output when signing existing DSSE envelope")
-		} else {
-			o.outputPath = args[0]
+	signer, err := o.signerOptions.GetSigner(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	if err := dsse.AddSignature(cmd.Context(), env, signer); err != nil {
+		return err
+	}
+
+	if o.bundlePath != "" {
+		return intoto.AppendToBundle(o.bundlePath, env)
+	}
+	return common.WriteEnvelope(o.outputPath, env, format)
+}
+
+// signBundle adds a signature to each envelope of the bundle read from path
+// that matches the filters. The bundle is updated like an existing envelope,
+// or the signed envelopes are appended to the bundle specified using --bundle.
+func (o *options) signBundle(cmd *cobra.Command, path string, envelopes []*dsse.Envelope) error {
+	slog.Debug("Bundle exists, adding signatures...")
+
+	if err := o.checkFlags(path, true); err != nil {
+		return err
+	}
+	if format, err := o.formatOptions.GetFormat(dsse.FormatJSON); err != nil {
+		return err
+	} else if format != dsse.FormatJSON {
+		return fmt.Errorf("cannot use --format %s when signing bundle, bundles only hold JSON envelopes", format)
+	}
+
+	file := &common.EnvelopeFile{Path: path, Envelopes: envelopes, Format: dsse.FormatJSON, IsBundle: true}
+	selected := o.filterOptions.Selected(file)
+	if len(selected) == 0 {
+		return fmt.Errorf("%w in '%s'", common.ErrNoEnvelopeMatched, common.DisplayName(path))
+	}
+
+	signer, err := o.signerOptions.GetSigner(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	signed := []*dsse.Envelope{}
+	for _, i := range selected {
+		if err := o.validatePayload(envelopes[i]); err != nil {
+			return fmt.Errorf("%s: %w", file.Name(i), err)
+		}
+		if err := dsse.AddSignature(cmd.Context(), envelopes[i], signer); err != nil {
+			return fmt.Errorf("%s: %w", file.Name(i), err)
 		}
+		signed = append(signed, envelopes[i])
+	}
 
-		if o.payloadType != "" {
-			return fmt.Errorf("cannot use --payload-type when signing existing DSSE envelope")
+	if o.bundlePath == "" {
+		return common.WriteBundle(o.outputPath, envelopes)
+	}
+	for _, env := range signed {
+		if err := intoto.AppendToBundle(o.bundlePath, env); err != nil {
+			return err
 		}
-	} else {
+	}
+	return nil
+}
+
+// checkFlags checks the flags used for signing the payload at path, which is
+// an existing envelope if isEnvelope is set, and sets the default output path.
+func (o *options) checkFlags(path string, isEnvelope bool) error {
+	fromStdin := path == common.StdioPath
+
+	if !isEnvelope {
 		if o.payloadType == "" {
 			return fmt.Errorf("required flag --payload-type not set for creating new DSSE envelope")
 		}
 
-		if o.outputPath == "" {
-			o.outputPath = fmt.Sprintf("%s.dsse", args[0])
+		if o.filterOptions.IsSet() {
+			return fmt.Errorf("cannot use --filter-payload-type or --filter-predicate-type when creating new DSSE envelope")
 		}
+
+		if o.outputPath == "" && fromStdin {
+			o.outputPath = common.StdioPath
+		} else if o.outputPath == "" {
+			o.outputPath = fmt.Sprintf("%s.%s", path, o.outputExtension())
+		}
+
+		return nil
 	}
 
 	if o.canonicalizeJson {
-		jsonRepr := &map[string]any{}
-		if err := json.Unmarshal(signable, jsonRepr); err != nil {
-			return err
-		}
-		encodedBytes, err := cjson.EncodeCanonical(jsonRepr)
+		return fmt.Errorf("cannot use --canonicalize-json when signing existing DSSE envelope")
+	}
+
+	// Envelopes are signed in place, except for envelopes read from standard
+	// input, which are written to standard output by default
+	if o.outputPath != "" && !fromStdin {
+		return fmt.Errorf("cannot use --output when signing existing DSSE envelope")
+	} else if o.outputPath == "" {
+		o.outputPath = path
+	}
+
+	if o.payloadType != "" {
+		return fmt.Errorf("cannot use --payload-type when signing existing DSSE envelope")
+	}
+
+	return nil
+}
+
+// outputExtension returns the extension of the default output path for new
+// envelopes and other signed structures.
+func (o *options) outputExtension() string {
+	switch {
+	case slices.Contains(cose.Formats, cose.Format(o.formatOptions.Format)):
+		return "cose"
+	case slices.Contains(jws.Formats, jws.Format(o.formatOptions.Format)):
+		return "jws"
+	}
+	return "dsse"
+}
+
+// runStructure signs the payload as a COSE structure or a JWS rather than a
+// DSSE envelope. Like envelopes, existing structures of the selected format
+// have a signature added to them. Signatures are created using the SSH key's
+// private key.
+func (o *options) runStructure(cmd *cobra.Command, args []string) error {
+	format := o.formatOptions.Format
+	if o.stream || o.bundlePath != "" || o.filterOptions.IsSet() {
+		return fmt.Errorf("cannot use --stream, --bundle, or filters with --format %s", format)
+	}
+	if o.signerOptions.UseSigstore || o.signerOptions.UseTlog || o.signerOptions.IsRemote() {
+		return fmt.Errorf("cannot use --sigstore, --tlog, or a signing service with --format %s, signatures must be created using the key's private key", format)
+	}
+
+	payload, err := common.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(cose.Formats, cose.Format(format)) {
+		signed, err := o.signCOSE(cmd.Context(), args[0], payload)
 		if err != nil {
 			return err
 		}
-		signable = encodedBytes
+		return common.WriteBinaryFile(o.outputPath, signed)
 	}
 
-	signer, err := o.getSigner()
+	signed, err := o.signJWS(cmd.Context(), args[0], payload)
 	if err != nil {
 		return err
 	}
+	return common.WriteFile(o.outputPath, signed, 0o644)
+}
+
+// signCOSE signs the payload read from path as a COSE structure, or adds a
+// signature to it if it is a COSE structure. COSE_Sign1 structures hold a
+// single signature.
+func (o *options) signCOSE(ctx context.Context, path string, payload []byte) ([]byte, error) {
+	format := cose.Format(o.formatOptions.Format)
 
-	pae := dsse.PAE(o.payloadType, signable)
-	signature, err := signer.Sign(cmd.Context(), pae)
+	isMessage := cose.IsCOSE(payload)
+	if err := o.checkFlags(path, isMessage); err != nil {
+		return nil, err
+	}
+
+	var (
+		message *cose.Message
+		err     error
+	)
+	if isMessage {
+		slog.Debug("COSE structure exists, adding signature...")
+
+		message, err = cose.Unmarshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse COSE structure '%s': %w", common.DisplayName(path), err)
+		}
+		if message.Format != format {
+			return nil, fmt.Errorf("cannot add signature to %s structure using --format %s", message.Format, format)
+		}
+	} else {
+		slog.Debug("Creating new COSE structure...")
+
+		payload, err = o.canonicalize(payload)
+		if err != nil {
+			return nil, err
+		}
+		message, err = cose.NewMessage(format, o.payloadType, payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := o.validateDecodedPayload(message.ContentType, func() ([]byte, error) {
+		return message.Payload, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	signer, err := o.signerOptions.GetSigner(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	keyID, err := signer.KeyID()
+	coseSigner, err := cose.NewSigner(signer)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := message.Sign(coseSigner); err != nil {
+		return nil, err
 	}
 
-	if _, isSigstoreSigner := signer.(*sigstore.Signer); isSigstoreSigner {
-		// Unpack the bundle to get the signature + verification material
-		// Set extension in the signature object
+	return cose.Marshal(message)
+}
 
-		bundle := protobundle.Bundle{}
-		if err := protojson.Unmarshal(signature, &bundle); err != nil {
-			return err
+// signJWS signs the payload read from path as a JWS, or adds a signature to it
+// if it is a JWS. The compact serialization holds a single signature.
+func (o *options) signJWS(ctx context.Context, path string, payload []byte) ([]byte, error) {
+	format := jws.Format(o.formatOptions.Format)
+
+	// Payloads that merely look like a JWS are signed as payloads
+	message, err := jws.Unmarshal(payload)
+	isMessage := err == nil
+	if err := o.checkFlags(path, isMessage); err != nil {
+		return nil, err
+	}
+
+	if isMessage {
+		slog.Debug("JWS exists, adding signature...")
+
+		if message.Format != format {
+			return nil, fmt.Errorf("cannot add signature to JWS using --format %s, it uses %s", format, message.Format)
 		}
+	} else {
+		slog.Debug("Creating new JWS...")
 
-		actualSigBytes, err := protojson.Marshal(bundle.GetMessageSignature())
+		payload, err = o.canonicalize(payload)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		message, err = jws.NewMessage(format, o.payloadType, payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := o.validateDecodedPayload(message.PayloadType, func() ([]byte, error) {
+		return message.Payload, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	signer, err := o.signerOptions.GetSigner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	jwsSigner, err := jws.NewSigner(signer)
+	if err != nil {
+		return nil, err
+	}
+	if err := message.Sign(jwsSigner); err != nil {
+		return nil, err
+	}
+
+	return jws.Marshal(message)
+}
+
+// runStream signs the payload without holding it in memory. Payloads read
+// from stdin are first copied to a temporary file, as are the payloads of
+// existing envelopes, and the envelope's payload is encoded as it is written.
+func (o *options) runStream(cmd *cobra.Command, args []string) error {
+	if o.canonicalizeJson {
+		return fmt.Errorf("cannot use --canonicalize-json with --stream")
+	}
+	if intoto.IsBundlePath(args[0]) {
+		return fmt.Errorf("cannot use --stream with bundles")
+	}
+	if format, err := o.formatOptions.GetFormat(dsse.FormatJSON); err != nil {
+		return err
+	} else if format != dsse.FormatJSON {
+		return fmt.Errorf("cannot use --format %s with --stream, only JSON envelopes can be streamed", format)
+	}
 
-		verificationMaterial := bundle.GetVerificationMaterial()
-		verificationMaterialBytes, err := protojson.Marshal(verificationMaterial)
+	input, cleanupInput, err := common.OpenSeekable(args[0])
+	if err != nil {
+		return err
+	}
+	defer cleanupInput()
+
+	// Check if payload is already an envelope, which is decoded to a
+	// temporary file
+	env, cleanupPayload, err := common.DecodeStreamedEnvelope(input)
+	isEnvelope := err == nil && env.PayloadType != ""
+	if err == nil {
+		defer cleanupPayload()
+	}
+	if err := o.checkFlags(args[0], isEnvelope); err != nil {
+		return err
+	}
+
+	if isEnvelope {
+		slog.Debug("Envelope exists, adding signature...")
+	} else {
+		slog.Debug("Creating new envelope...")
+
+		info, err := input.Stat()
 		if err != nil {
 			return err
 		}
-		verificationMaterialStruct := new(structpb.Struct)
-		if err := protojson.Unmarshal(verificationMaterialBytes, verificationMaterialStruct); err != nil {
-			return err
+		env = &dsse.StreamedEnvelope{
+			PayloadType: o.payloadType,
+			Payload:     input,
+			PayloadSize: info.Size(),
+			Signatures:  []dsse.Signature{},
 		}
-
-		env.Signatures = append(env.Signatures, dsse.Signature{
-			Sig:   base64.StdEncoding.EncodeToString(actualSigBytes),
-			KeyID: keyID,
-			Extension: &dsse.Extension{
-				Kind: sigstore.ExtensionMimeType,
-				Ext:  verificationMaterialStruct,
-			},
-		})
-	} else {
-		env.Signatures = append(env.Signatures, dsse.Signature{
-			KeyID: keyID,
-			Sig:   base64.StdEncoding.EncodeToString(signature),
-		})
 	}
 
-	envBytes, err := json.Marshal(env)
+	signer, err := o.signerOptions.GetSigner(cmd.Context())
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(o.outputPath, envBytes, 0o644)
+	if err := env.AddSignature(cmd.Context(), signer); err != nil {
+		return err
+	}
+
+	return common.WriteStreamedEnvelope(o.outputPath, env)
 }
 
-func (o *options) getSigner() (dsse.Signer, error) {
-	if o.useSigstore {
-		return sigstore.NewSigner(), nil
+// parseEnvelope returns the envelope if the payload is a DSSE envelope. JSON
+// payloads are only treated as envelopes if they contain no other fields, so
+// that JSON documents are not mistaken for envelopes.
+func parseEnvelope(payload []byte) (*dsse.Envelope, dsse.Format, bool) {
+	env := &dsse.Envelope{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(env); err == nil && !decoder.More() {
+		return env, dsse.FormatJSON, env.PayloadType != ""
+	}
+
+	// Binary protobuf envelopes are only detected if they decode completely
+	env, format, err := dsse.Unmarshal(payload)
+	if err != nil || format != dsse.FormatProtobuf {
+		return nil, "", false
 	}
-	return ssh.NewSignerFromFile(o.sshKeyPath)
+	return env, format, true
+}
+
+// canonicalize encodes the payload of a new envelope using canonical JSON if
+// --canonicalize-json is set.
+func (o *options) canonicalize(payload []byte) ([]byte, error) {
+	if !o.canonicalizeJson {
+		return payload, nil
+	}
+
+	jsonRepr := &map[string]any{}
+	if err := json.Unmarshal(payload, jsonRepr); err != nil {
+		return nil, err
+	}
+	return cjson.EncodeCanonical(jsonRepr)
+}
+
+// validatePayload checks the envelope's payload if its payload type is known.
+func (o *options) validatePayload(env *dsse.Envelope) error {
+	return o.validateDecodedPayload(env.PayloadType, func() ([]byte, error) {
+		return env.DecodeB64Payload()
+	})
+}
+
+// validateDecodedPayload checks the payload returned by getPayload if the
+// payload type is known. The payload is only decoded if it is checked.
+func (o *options) validateDecodedPayload(payloadType string, getPayload func() ([]byte, error)) error {
+	registry, err := o.payloadValidationOptions.GetRegistry()
+	if err != nil {
+		return err
+	}
+
+	if !registry.IsKnown(payloadType) {
+		slog.Debug("Payload type is not known, skipping payload validation", slog.String("payloadType", payloadType))
+		return nil
+	}
+
+	payload, err := getPayload()
+	if err != nil {
+		return err
+	}
+	return registry.Validate(payloadType, payload)
 }
 
 func New() *cobra.Command {
 	o := &options{}
 	cmd := &cobra.Command{
-		Use:               "sign",
-		Short:             "Create signed DSSE envelope for an arbitrary payload",
+		Use:   "sign",
+		Short: "Create signed DSSE envelope for an arbitrary payload",
+		Long: `Create signed DSSE envelope for an arbitrary payload.
+
+The payload is read from the specified path, or from stdin if the path is "-".
+The envelope is written to the path specified using --output, or by default to
+the payload's path with the .dsse extension, or to stdout if the payload was
+read from stdin. If the payload is already a DSSE envelope, or an in-toto
+attestation bundle, a signature is added to it instead. With --bundle, the
+signed envelope is appended to the specified bundle.
+
+The key can be the address of a signing service started using essd serve
+--signer, as remote://<host>[:<port>]. With --tlog, SSH signatures are recorded
+in a transparency log. With --stream, the payload is not held in memory, so
+that large payloads can be signed. With --format, envelopes can be written
+using the protobuf encodings, and payloads signed as COSE structures or JWS.
+
+See docs/sign.md for bundles, signing services, streaming, and the supported
+formats. For example:
+
+  build | essd sign -k key -t application/json - | essd verify -k key.pub -
+  essd sign -k key -t application/vnd.in-toto+json --bundle release.intoto.jsonl statement.json
+  essd sign -k remote://signer.example.com --remote-token-file token -t text/plain notes.txt
+  essd sign -k alice -t application/json --format jws -o claims.jws claims.json`,
 		Args:              cobra.ExactArgs(1),
 		RunE:              o.Run,
 		DisableAutoGenTag: true,
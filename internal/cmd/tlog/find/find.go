@@ -0,0 +1,178 @@
+package find
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	essdssh "github.com/adityasaky/essd/internal/ssh"
+	"github.com/adityasaky/essd/internal/tlog"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+var ErrUnverifiedEntries = errors.New("some transparency log entries could not be verified")
+
+type options struct {
+	publicKey string
+	identity  string
+	issuer    string
+	digest    string
+
+	rekorURL    string
+	tlogKeyPath string
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(
+		&o.publicKey,
+		"key",
+		"k",
+		"",
+		"path of SSH key whose signatures to find",
+	)
+
+	cmd.Flags().StringVar(
+		&o.identity,
+		"identity",
+		"",
+		"Sigstore identity whose signatures to find (must be an email address)",
+	)
+
+	cmd.Flags().StringVar(
+		&o.issuer,
+		"issuer",
+		"",
+		"OIDC issuer of the Sigstore identity",
+	)
+
+	cmd.Flags().StringVar(
+		&o.digest,
+		"digest",
+		"",
+		"SHA-256 digest of the signed data, the PAE encoding for envelopes",
+	)
+
+	cmd.MarkFlagsOneRequired("key", "identity", "digest")
+	cmd.MarkFlagsRequiredTogether("identity", "issuer")
+
+	cmd.Flags().StringVar(
+		&o.rekorURL,
+		"rekor-url",
+		tlog.DefaultRekorURL,
+		"URL of Rekor instance to search",
+	)
+
+	cmd.Flags().StringVar(
+		&o.tlogKeyPath,
+		"tlog-key",
+		"",
+		"path of PEM public key of the transparency log (default: Sigstore public good instance)",
+	)
+}
+
+func (o *options) Run(cmd *cobra.Command, _ []string) error {
+	query := &tlog.Query{
+		Identity: o.identity,
+		Issuer:   o.issuer,
+		Digest:   strings.TrimPrefix(strings.ToLower(o.digest), "sha256:"),
+	}
+	if o.publicKey != "" {
+		sshKey, err := loadSSHKey(o.publicKey)
+		if err != nil {
+			return err
+		}
+		query.SSHKey = sshKey
+	}
+
+	trustedLogs, err := tlog.LoadTrustedLogs(o.tlogKeyPath)
+	if err != nil {
+		return err
+	}
+
+	client, err := tlog.NewClient(o.rekorURL)
+	if err != nil {
+		return err
+	}
+
+	found, err := client.Find(cmd.Context(), query)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Entries in %s matching the query:\n", o.rekorURL)
+
+	listed, failed := 0, 0
+	for _, foundEntry := range found {
+		entry := foundEntry.Entry
+		err := trustedLogs.VerifyEntry(cmd.Context(), entry)
+		if err == nil {
+			err = query.Match(entry)
+		}
+		if errors.Is(err, tlog.ErrIssuerMismatch) {
+			continue
+		}
+		listed++
+		if err != nil {
+			fmt.Printf("\tFAIL %s: %s\n", foundEntry.UUID, err)
+			failed++
+			continue
+		}
+
+		integratedTime := time.Unix(entry.GetIntegratedTime(), 0).UTC().Format(time.RFC3339)
+		fmt.Printf("\tPASS log index %d, integrated at %s, %s entry %s\n", entry.GetLogIndex(), integratedTime, entry.GetKindVersion().GetKind(), foundEntry.UUID)
+	}
+
+	if listed == 0 {
+		fmt.Println("\tnone found")
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d", ErrUnverifiedEntries, failed, listed)
+	}
+	return nil
+}
+
+func loadSSHKey(path string) (ssh.PublicKey, error) {
+	sslibKey, err := essdssh.NewKeyFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load '%s': %w", path, err)
+	}
+	verifier, err := essdssh.NewVerifierFromKey(sslibKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load '%s': %w", path, err)
+	}
+	return ssh.NewPublicKey(verifier.Public())
+}
+
+func New() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:   "find",
+		Short: "Find signatures recorded in a Rekor transparency log",
+		Long: `Find signatures recorded in a Rekor transparency log.
+
+Entries are searched for by the SSH key that created them using --key, by the
+Sigstore identity whose certificate they record using --identity and --issuer,
+or by the SHA-256 digest of the signed data using --digest. For signatures on
+DSSE envelopes, the signed data is the envelope's PAE encoding. When several
+criteria are specified, entries must match all of them. Rekor only indexes
+Sigstore identities that are email addresses, and entries for the email address
+from other issuers are not listed.
+
+Each entry's inclusion proof, checkpoint, and signed entry timestamp are
+verified offline using the key of the log specified using --tlog-key, or the
+keys of the Sigstore public good instance. Entries are also checked to match
+the criteria, as Rekor's index is not authenticated; with --digest, only
+rekord and hashedrekord entries, which record the digest, can match. Entries
+are listed with their log index and the time they were integrated into the
+log, and the command fails if any entry cannot be verified.`,
+		Args:              cobra.NoArgs,
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
@@ -0,0 +1,18 @@
+package tlog
+
+import (
+	"github.com/adityasaky/essd/internal/cmd/tlog/find"
+	"github.com/spf13/cobra"
+)
+
+func New() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "tlog",
+		Short:             "Inspect signatures recorded in transparency logs",
+		DisableAutoGenTag: true,
+	}
+
+	cmd.AddCommand(find.New())
+
+	return cmd
+}
@@ -1,89 +1,241 @@
 package verify
 
 import (
-	"encoding/json"
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
-	"os"
-	"strings"
 
+	"github.com/adityasaky/essd/internal/cmd/common"
+	"github.com/adityasaky/essd/internal/cose"
 	"github.com/adityasaky/essd/internal/dsse"
-	"github.com/adityasaky/essd/internal/sigstore"
-	"github.com/adityasaky/essd/internal/ssh"
+	"github.com/adityasaky/essd/internal/intoto"
+	"github.com/adityasaky/essd/internal/jws"
 	"github.com/spf13/cobra"
 )
 
+var ErrEnvelopesFailed = errors.New("envelopes in bundle failed verification")
+
 type options struct {
-	publicKeys []string
+	verificationOptions common.VerificationOptions
+	filterOptions       common.BundleFilterOptions
+
+	subjects []string
+
+	stream bool
 }
 
 func (o *options) AddFlags(cmd *cobra.Command) {
-	cmd.Flags().StringArrayVarP(
-		&o.publicKeys,
-		"key",
-		"k",
+	o.verificationOptions.AddFlags(cmd)
+	o.filterOptions.AddFlags(cmd)
+
+	cmd.Flags().StringArrayVar(
+		&o.subjects,
+		"subject",
 		nil,
-		"key to use for verifying signatures (specify sigstore using fulcio:<identity>::<issuer>)",
+		"path of artifact that must match a subject of the in-toto statement in the envelope",
 	)
-	cmd.MarkFlagRequired("key") //nolint:errcheck
+
+	cmd.Flags().BoolVar(
+		&o.stream,
+		"stream",
+		false,
+		"verify without holding the payload in memory (only supported with --key)",
+	)
+	cmd.MarkFlagsMutuallyExclusive("stream", "subject")
+	cmd.MarkFlagsMutuallyExclusive("stream", "filter-payload-type")
+	cmd.MarkFlagsMutuallyExclusive("stream", "filter-predicate-type")
 }
 
 func (o *options) Run(cmd *cobra.Command, args []string) error {
-	envBytes, err := os.ReadFile(args[0])
+	if o.stream {
+		return o.runStream(cmd, args)
+	}
+
+	data, err := common.ReadFile(args[0])
 	if err != nil {
 		return err
 	}
-	env := &dsse.Envelope{}
-	if err := json.Unmarshal(envBytes, env); err != nil {
+	if cose.IsCOSE(data) {
+		return o.verifyCOSE(cmd.Context(), args[0], data)
+	}
+	if jws.IsJWS(data) {
+		return o.verifyJWS(cmd.Context(), args[0], data)
+	}
+
+	file, err := common.ParseEnvelopes(args[0], data)
+	if err != nil {
 		return err
 	}
 
-	verifiers, err := o.getVerifiers()
+	selected := o.filterOptions.Selected(file)
+	if len(selected) == 0 {
+		return fmt.Errorf("%w in '%s'", common.ErrNoEnvelopeMatched, common.DisplayName(args[0]))
+	}
+
+	if !file.IsBundle {
+		return o.verifyEnvelope(cmd.Context(), file.Name(0), file.Envelopes[0])
+	}
+
+	// Every envelope of a bundle is verified, so that all failures are
+	// reported at once
+	failed := 0
+	for _, i := range selected {
+		if err := o.verifyEnvelope(cmd.Context(), file.Name(i), file.Envelopes[i]); err != nil {
+			fmt.Printf("FAIL %s: %s\n", file.Name(i), err)
+			failed++
+			continue
+		}
+		fmt.Printf("PASS %s\n", file.Name(i))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d", ErrEnvelopesFailed, failed, len(selected))
+	}
+	return nil
+}
+
+// verifyEnvelope verifies the envelope, which is referred to using name in
+// reports, and checks that the specified artifacts match its subjects.
+func (o *options) verifyEnvelope(ctx context.Context, name string, env *dsse.Envelope) error {
+	if _, err := o.verificationOptions.Verify(ctx, name, env); err != nil {
+		return err
+	}
+
+	return o.matchSubjects(env)
+}
+
+// matchSubjects checks that the specified artifacts match subjects of the
+// in-toto statement in the envelope.
+func (o *options) matchSubjects(env *dsse.Envelope) error {
+	if len(o.subjects) == 0 {
+		return nil
+	}
+
+	statement, err := intoto.StatementFromEnvelope(env)
 	if err != nil {
 		return err
 	}
 
-	envVerifier, err := dsse.NewMultiEnvelopeVerifier(1, verifiers...)
+	for _, subjectPath := range o.subjects {
+		if _, err := intoto.MatchSubject(statement, subjectPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verifyCOSE verifies the COSE structure read from path, and checks that the
+// specified artifacts match its subjects.
+func (o *options) verifyCOSE(ctx context.Context, path string, data []byte) error {
+	if o.filterOptions.IsSet() {
+		return fmt.Errorf("cannot use --filter-payload-type or --filter-predicate-type with COSE structures")
+	}
+
+	message, err := cose.Unmarshal(data)
 	if err != nil {
+		return fmt.Errorf("unable to parse COSE structure '%s': %w", common.DisplayName(path), err)
+	}
+
+	if _, err := o.verificationOptions.VerifyCOSE(ctx, common.DisplayName(path), message); err != nil {
 		return err
 	}
 
-	_, err = envVerifier.Verify(cmd.Context(), env)
-	return err
+	return o.matchSubjects(&dsse.Envelope{
+		PayloadType: message.ContentType,
+		Payload:     base64.StdEncoding.EncodeToString(message.Payload),
+	})
 }
 
-func (o *options) getVerifiers() ([]dsse.Verifier, error) {
-	verifiers := []dsse.Verifier{}
-
-	for _, key := range o.publicKeys {
-		if strings.HasPrefix(key, "fulcio:") {
-			key = strings.TrimPrefix(strings.TrimSpace(key), "fulcio:")
-			keySplit := strings.Split(key, "::")
-			if len(keySplit) != 2 {
-				return nil, fmt.Errorf("invalid fulcio format: %s", key)
-			}
-			verifier := sigstore.NewVerifierFromIdentityAndIssuer(keySplit[0], keySplit[1])
-			verifiers = append(verifiers, verifier)
-		} else {
-			sslibKey, err := ssh.NewKeyFromFile(key)
-			if err != nil {
-				return nil, fmt.Errorf("unable to load '%s': %w", key, err)
-			}
-			verifier, err := ssh.NewVerifierFromKey(sslibKey)
-			if err != nil {
-				return nil, fmt.Errorf("unable to load '%s': %w", key, err)
-			}
-			verifiers = append(verifiers, verifier)
-		}
+// verifyJWS verifies the JWS read from path, and checks that the specified
+// artifacts match its subjects.
+func (o *options) verifyJWS(ctx context.Context, path string, data []byte) error {
+	if o.filterOptions.IsSet() {
+		return fmt.Errorf("cannot use --filter-payload-type or --filter-predicate-type with JWS")
+	}
+
+	message, err := jws.Unmarshal(data)
+	if err != nil {
+		return fmt.Errorf("unable to parse JWS '%s': %w", common.DisplayName(path), err)
+	}
+
+	if _, err := o.verificationOptions.VerifyJWS(ctx, common.DisplayName(path), message); err != nil {
+		return err
+	}
+
+	return o.matchSubjects(&dsse.Envelope{
+		PayloadType: message.PayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(message.Payload),
+	})
+}
+
+// runStream verifies the envelope without holding its payload in memory. The
+// payload is decoded to a temporary file as the envelope is read.
+func (o *options) runStream(cmd *cobra.Command, args []string) error {
+	if intoto.IsBundlePath(args[0]) {
+		return fmt.Errorf("cannot use --stream with bundles")
+	}
+
+	input, err := common.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer input.Close() //nolint:errcheck
+
+	env, cleanup, err := common.DecodeStreamedEnvelope(input)
+	if err != nil {
+		return fmt.Errorf("unable to parse envelope '%s': %w", common.DisplayName(args[0]), err)
 	}
+	defer cleanup()
 
-	return verifiers, nil
+	_, err = o.verificationOptions.VerifyStream(cmd.Context(), env)
+	return err
 }
 
 func New() *cobra.Command {
 	o := &options{}
 	cmd := &cobra.Command{
-		Use:               "verify",
-		Short:             "Verify signatures in DSSE envelope using specified keys",
+		Use:   "verify",
+		Short: "Verify signatures in DSSE envelope using specified keys",
+		Long: `Verify signatures in DSSE envelope using specified keys.
+
+The envelope is read from stdin if its path is "-". The path can also refer to
+an in-toto attestation bundle, a JSON Lines file with one envelope per line,
+in which case every envelope in it is verified, or to a COSE or JWS structure
+created by sign using --format. With --subject, the artifacts must match a
+subject of each verified envelope.
+
+Instead of specifying keys, the envelope can be verified against a YAML or JSON
+policy using --policy, which declares the keys and Sigstore identities trusted
+for each allowed payload type, and the number of signatures required. The
+result of each rule of the policy is reported.
+
+Once signatures are verified, CEL expressions specified using --assert, and
+the assertions of the policy's rule for the payload type, must evaluate to true.
+When an expression evaluates to false, the values that made it false are
+reported.
+
+A Rego policy can also be evaluated against the verified envelope using --rego.
+The query specified using --rego-query, by default data.essd.deny, must produce
+either a set of deny messages or a boolean, where false denies the envelope.
+Deny messages are reported.
+
+With --require-tlog, the transparency log entries recorded in signatures are
+checked offline. With --stream, the payload is not held in memory, so that
+envelopes with large payloads can be verified.
+
+See docs/verify.md for bundles, COSE and JWS structures, the policy file
+format, the variables available to assertions, the input document of Rego
+policies, and transparency logs. For example:
+
+  essd verify -k alice.pub envelope.json
+  essd verify --policy policy.yaml release.intoto.jsonl
+  essd verify -k alice.pub --assert 'payload.predicateType == "https://slsa.dev/provenance/v1"' \
+    envelope.json
+  essd verify --policy policy.yaml --rego policy.rego envelope.json
+  essd verify -k release.pub --filter-predicate-type https://slsa.dev/provenance/v1 \
+    release.intoto.jsonl`,
 		Args:              cobra.MinimumNArgs(1),
 		RunE:              o.Run,
 		DisableAutoGenTag: true,
@@ -0,0 +1,145 @@
+package verifylayout
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/adityasaky/essd/internal/cmd/common"
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/key"
+	"github.com/adityasaky/essd/internal/layout"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	layoutKeys []string
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(
+		&o.layoutKeys,
+		"layout-key",
+		"k",
+		nil,
+		"key of the layout's owner (specify sigstore using fulcio:<identity>::<issuer>)",
+	)
+	cmd.MarkFlagRequired("layout-key") //nolint:errcheck
+}
+
+func (o *options) Run(cmd *cobra.Command, args []string) error {
+	layoutPath, linkDir := args[0], args[1]
+
+	layoutEnv, err := common.ReadEnvelope(layoutPath)
+	if err != nil {
+		return err
+	}
+
+	// Every layout owner must sign the layout
+	verifiers := []dsse.Verifier{}
+	for _, keyRef := range o.layoutKeys {
+		verifier, err := key.NewVerifier(keyRef)
+		if err != nil {
+			return err
+		}
+		verifiers = append(verifiers, verifier)
+	}
+	envVerifier, err := dsse.NewMultiEnvelopeVerifier(len(verifiers), verifiers...)
+	if err != nil {
+		return err
+	}
+	if _, err := envVerifier.Verify(cmd.Context(), layoutEnv); err != nil {
+		return fmt.Errorf("unable to verify layout '%s': %w", common.DisplayName(layoutPath), err)
+	}
+
+	supplyChainLayout, err := layout.FromEnvelope(layoutEnv)
+	if err != nil {
+		return err
+	}
+
+	linkEnvs, err := readLinks(linkDir)
+	if err != nil {
+		return err
+	}
+
+	report, err := supplyChainLayout.Verify(cmd.Context(), linkEnvs)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Layout verification for %s:\n", layoutPath)
+	printChecks(report.Checks)
+	for _, step := range report.Steps {
+		fmt.Printf("Step %s:\n", step.Name)
+		printChecks(step.Checks)
+	}
+
+	return report.Err()
+}
+
+func printChecks(checks []layout.Check) {
+	for _, check := range checks {
+		status := "PASS"
+		if !check.Passed {
+			status = "FAIL"
+		}
+		fmt.Printf("\t%s %s: %s\n", status, check.Rule, check.Message)
+	}
+}
+
+// readLinks reads the envelopes in the directory. Files that are not DSSE
+// envelopes are skipped.
+func readLinks(dir string) ([]*dsse.Envelope, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	envs := []*dsse.Envelope{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		env, err := common.ReadEnvelope(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			slog.Debug("Skipping file that is not an envelope", slog.String("name", entry.Name()), slog.Any("error", err))
+			continue
+		}
+		envs = append(envs, env)
+	}
+
+	return envs, nil
+}
+
+func New() *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:   "verify-layout <layout envelope> <link directory>",
+		Short: "Verify a supply chain against a signed in-toto layout",
+		Long: `Verify a supply chain against a signed in-toto layout.
+
+The layout envelope must be signed by every layout key specified, and is read
+from stdin if its path is "-". The envelopes in the link directory are matched
+to the layout's steps using the step names they record, and must be signed by
+the step's functionaries. Links are either in-toto link metadata or in-toto
+attestations with the predicate type https://in-toto.io/attestation/link/v0.3,
+whose subjects are the step's products.
+
+For each step, the number of functionaries that provided links must meet the
+step's threshold, and the links' materials and products must satisfy the
+step's MATCH, ALLOW, DISALLOW, REQUIRE, CREATE, DELETE, and MODIFY artifact
+rules. Functionary keys in the layout are securesystemslib keys, and Sigstore
+identities can be declared using the sigstore-oidc key type with identity and
+issuer key values. Inspections are not supported.
+
+The result of each check of the layout and its steps is reported.`,
+		Args:              cobra.ExactArgs(2),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
@@ -0,0 +1,420 @@
+// Package config reads essd configuration files and environment variables,
+// which set default values for the flags of essd's commands. The format of
+// configuration files and the precedence of settings are described in
+// docs/configuration.md.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// EnvPrefix is the prefix of environment variables that set flags.
+	EnvPrefix = "ESSD_"
+
+	profilesKey = "profiles"
+
+	// mutuallyExclusiveAnnotation is the annotation cobra records flag groups
+	// marked as mutually exclusive in.
+	mutuallyExclusiveAnnotation = "cobra_annotation_mutually_exclusive"
+)
+
+var (
+	ErrInvalidConfig  = errors.New("invalid configuration")
+	ErrUnknownProfile = errors.New("unknown profile")
+)
+
+// File is a configuration file.
+type File struct {
+	// Path is the path the file was read from, which is empty if no file was
+	// read.
+	Path     string
+	settings map[string]any
+	profiles map[string]map[string]any
+}
+
+// Setting is the value of a flag resolved from the configuration.
+type Setting struct {
+	Flag   string
+	Values []string
+	// Source describes where the value was set.
+	Source string
+}
+
+// DefaultPath returns the path of the configuration file in the XDG
+// configuration directory, $XDG_CONFIG_HOME/essd/config.yaml, which defaults
+// to ~/.config/essd/config.yaml.
+func DefaultPath() (string, error) {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, "essd", "config.yaml"), nil
+}
+
+// Load reads the configuration file at path. If the file does not exist and
+// is not required, an empty configuration is returned.
+func Load(path string, required bool) (*File, error) {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return &File{settings: map[string]any{}, profiles: map[string]map[string]any{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	settings := map[string]any{}
+	if err := yaml.Unmarshal(contents, &settings); err != nil {
+		return nil, fmt.Errorf("%w: unable to parse '%s': %w", ErrInvalidConfig, path, err)
+	}
+	if settings == nil {
+		settings = map[string]any{}
+	}
+
+	f := &File{Path: path, settings: settings, profiles: map[string]map[string]any{}}
+	if profiles, exists := settings[profilesKey]; exists {
+		profilesMap, isMap := profiles.(map[string]any)
+		if !isMap {
+			return nil, fmt.Errorf("%w: profiles must map profile names to settings", ErrInvalidConfig)
+		}
+		for name, profile := range profilesMap {
+			profileMap, isMap := profile.(map[string]any)
+			if !isMap {
+				return nil, fmt.Errorf("%w: profile '%s' must map flags to values", ErrInvalidConfig, name)
+			}
+			f.profiles[name] = profileMap
+		}
+		delete(settings, profilesKey)
+	}
+
+	return f, nil
+}
+
+// Profiles returns the names of the profiles declared in the file.
+func (f *File) Profiles() []string {
+	names := []string{}
+	for name := range f.profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Validate checks that the file's settings, including those of its profiles,
+// set flags of root or its subcommands, and that its sections are named after
+// commands.
+func (f *File) Validate(root *cobra.Command) error {
+	if err := validateSection(root, f.settings, nil); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	for _, name := range f.Profiles() {
+		if err := validateSection(root, f.profiles[name], nil); err != nil {
+			return fmt.Errorf("%w: profile '%s': %w", ErrInvalidConfig, name, err)
+		}
+	}
+	return nil
+}
+
+func validateSection(cmd *cobra.Command, section map[string]any, path []string) error {
+	for key, value := range section {
+		keyPath := strings.Join(append(slices.Clone(path), key), ".")
+		if subsection, isSection := value.(map[string]any); isSection {
+			subcommand := findSubcommand(cmd, key)
+			if subcommand == nil {
+				return fmt.Errorf("'%s' is not a command", keyPath)
+			}
+			if err := validateSection(subcommand, subsection, append(path, key)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !hasFlag(cmd, key) {
+			return fmt.Errorf("'%s' is not a flag", keyPath)
+		}
+		if _, err := toValues(value); err != nil {
+			return fmt.Errorf("'%s': %w", keyPath, err)
+		}
+	}
+	return nil
+}
+
+/*
+Resolve returns the settings that apply to the flags of a command whose
+sections are named by path, for the profile if it is set. Settings are ordered
+by precedence: environment variables come first, followed by the profile's
+settings and the file's settings. Within each, the settings of the command's
+own section come before those of its parents' sections. Each flag is resolved
+at most once, from the source with the highest precedence.
+*/
+func (f *File) Resolve(flags map[string]*pflag.Flag, path []string, profile string) ([]Setting, error) {
+	resolved := map[string]bool{}
+	settings := []Setting{}
+	add := func(setting Setting) {
+		if !resolved[setting.Flag] {
+			resolved[setting.Flag] = true
+			settings = append(settings, setting)
+		}
+	}
+
+	for _, name := range sortedFlagNames(flags) {
+		for i := len(path); i >= 0; i-- {
+			variable := envVariable(path[:i], name)
+			value, set := os.LookupEnv(variable)
+			if !set {
+				continue
+			}
+
+			values := []string{value}
+			if IsListFlag(flags[name]) {
+				values = strings.Split(value, ",")
+			}
+			add(Setting{Flag: name, Values: values, Source: fmt.Sprintf("environment variable %s", variable)})
+			break
+		}
+	}
+
+	if profile != "" {
+		profileSettings, exists := f.profiles[profile]
+		if !exists {
+			return nil, fmt.Errorf("%w '%s'", ErrUnknownProfile, profile)
+		}
+		if err := resolveSections(profileSettings, flags, path, fmt.Sprintf("profile '%s'", profile), add); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := resolveSections(f.settings, flags, path, "config file", add); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func resolveSections(settings map[string]any, flags map[string]*pflag.Flag, path []string, source string, add func(Setting)) error {
+	sections := []map[string]any{settings}
+	for _, name := range path {
+		section, isSection := sections[len(sections)-1][name].(map[string]any)
+		if !isSection {
+			break
+		}
+		sections = append(sections, section)
+	}
+
+	for i := len(sections) - 1; i >= 0; i-- {
+		sectionSource := source
+		if i > 0 {
+			sectionSource = fmt.Sprintf("%s, section %s", source, strings.Join(path[:i], "."))
+		}
+
+		keys := []string{}
+		for key := range sections[i] {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			if _, isSection := sections[i][key].(map[string]any); isSection {
+				continue
+			}
+			if _, isFlag := flags[key]; !isFlag {
+				continue
+			}
+
+			values, err := toValues(sections[i][key])
+			if err != nil {
+				return fmt.Errorf("%w: '%s': %w", ErrInvalidConfig, key, err)
+			}
+			if values == nil {
+				continue
+			}
+			if len(values) != 1 && !IsListFlag(flags[key]) {
+				return fmt.Errorf("%w: '%s' accepts a single value", ErrInvalidConfig, key)
+			}
+			add(Setting{Flag: key, Values: values, Source: sectionSource})
+		}
+	}
+	return nil
+}
+
+/*
+Apply sets the command's flags to the values of the settings, in order. Flags
+specified on the command line are not changed, nor are flags that are mutually
+exclusive with a flag that is already set, so that settings with a higher
+precedence, such as a key specified on the command line, override conflicting
+settings, such as using Sigstore by default.
+*/
+func Apply(cmd *cobra.Command, settings []Setting) error {
+	flags := cmd.Flags()
+	set := map[string]bool{}
+	flags.Visit(func(flag *pflag.Flag) {
+		set[flag.Name] = true
+	})
+
+	for _, setting := range Effective(Flags(cmd), settings, set) {
+		for _, value := range setting.Values {
+			if err := flags.Set(setting.Flag, value); err != nil {
+				return fmt.Errorf("invalid value for --%s set by %s: %w", setting.Flag, setting.Source, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Effective returns the settings that Apply sets, given the flags that are
+// set on the command line.
+func Effective(flags map[string]*pflag.Flag, settings []Setting, set map[string]bool) []Setting {
+	set = maps.Clone(set)
+	effective := []Setting{}
+	for _, setting := range settings {
+		flag, exists := flags[setting.Flag]
+		if !exists || set[setting.Flag] || conflicts(flag, set) {
+			continue
+		}
+		set[setting.Flag] = true
+		effective = append(effective, setting)
+	}
+	return effective
+}
+
+// Flags returns the flags of the command, including those it inherits.
+func Flags(cmd *cobra.Command) map[string]*pflag.Flag {
+	flags := map[string]*pflag.Flag{}
+	add := func(flag *pflag.Flag) {
+		flags[flag.Name] = flag
+	}
+	cmd.LocalFlags().VisitAll(add)
+	cmd.InheritedFlags().VisitAll(add)
+	return flags
+}
+
+// AllFlags returns the flags of the command and its subcommands. Flags of
+// subcommands with the same name as another flag are omitted.
+func AllFlags(cmd *cobra.Command) map[string]*pflag.Flag {
+	flags := Flags(cmd)
+	for _, subcommand := range cmd.Commands() {
+		for name, flag := range AllFlags(subcommand) {
+			if _, exists := flags[name]; !exists {
+				flags[name] = flag
+			}
+		}
+	}
+	return flags
+}
+
+// SectionPath returns the names of the sections of the command's settings,
+// which are the names of the command and its parents other than the root
+// command.
+func SectionPath(cmd *cobra.Command) []string {
+	path := []string{}
+	for c := cmd; c.HasParent(); c = c.Parent() {
+		path = append([]string{c.Name()}, path...)
+	}
+	return path
+}
+
+func conflicts(flag *pflag.Flag, set map[string]bool) bool {
+	for _, group := range flag.Annotations[mutuallyExclusiveAnnotation] {
+		for _, name := range strings.Split(group, " ") {
+			if name != flag.Name && set[name] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasFlag(cmd *cobra.Command, name string) bool {
+	_, exists := AllFlags(cmd)[name]
+	return exists
+}
+
+func findSubcommand(cmd *cobra.Command, name string) *cobra.Command {
+	for _, subcommand := range cmd.Commands() {
+		if subcommand.Name() == name {
+			return subcommand
+		}
+	}
+	return nil
+}
+
+// envVariable returns the name of the environment variable that sets the flag
+// for the command whose sections are named by path.
+func envVariable(path []string, flag string) string {
+	name := strings.Join(append(slices.Clone(path), flag), "_")
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// IsListFlag returns true if the flag accepts several values.
+func IsListFlag(flag *pflag.Flag) bool {
+	valueType := flag.Value.Type()
+	return strings.HasSuffix(valueType, "Slice") || strings.HasSuffix(valueType, "Array")
+}
+
+func sortedFlagNames(flags map[string]*pflag.Flag) []string {
+	names := []string{}
+	for name := range flags {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// toValues returns the flag values of a setting. Lists set each of their
+// elements, and values starting with ~/ are expanded to the home directory.
+// Null values do not set the flag.
+func toValues(value any) ([]string, error) {
+	var values []string
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		values = []string{}
+		for _, element := range v {
+			elementValues, err := toValues(element)
+			if err != nil {
+				return nil, err
+			}
+			if len(elementValues) != 1 {
+				return nil, errors.New("lists must hold single values")
+			}
+			values = append(values, elementValues...)
+		}
+		return values, nil
+	case string:
+		values = []string{expandHome(v)}
+	case bool:
+		values = []string{strconv.FormatBool(v)}
+	case float64:
+		values = []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	default:
+		return nil, fmt.Errorf("unsupported value of type %T", value)
+	}
+	return values, nil
+}
+
+func expandHome(value string) string {
+	rest, found := strings.CutPrefix(value, "~/")
+	if !found {
+		return value
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return value
+	}
+	return filepath.Join(home, rest)
+}
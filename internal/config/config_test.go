@@ -0,0 +1,194 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+const testConfig = `log-level: info
+key: root.key
+payload-type: text/plain
+sign:
+  key: sign.key
+  filter: [a, b]
+profiles:
+  release:
+    key: release.key
+    log-level: debug
+  keyless:
+    sign:
+      sigstore: true
+`
+
+// newCommands returns a root command with a persistent flag, and its sign
+// subcommand, whose --key and --sigstore flags are mutually exclusive.
+func newCommands() (*cobra.Command, *cobra.Command) {
+	root := &cobra.Command{Use: "essd"}
+	root.PersistentFlags().String("log-level", "warn", "")
+
+	sign := &cobra.Command{Use: "sign", RunE: func(*cobra.Command, []string) error { return nil }}
+	sign.Flags().String("key", "", "")
+	sign.Flags().Bool("sigstore", false, "")
+	sign.MarkFlagsMutuallyExclusive("key", "sigstore")
+	sign.Flags().String("payload-type", "", "")
+	sign.Flags().StringArray("filter", nil, "")
+	root.AddCommand(sign)
+
+	return root, sign
+}
+
+func loadTestConfig(t *testing.T, contents string) *File {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Load(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestResolveAndApply(t *testing.T) {
+	tests := map[string]struct {
+		env     map[string]string
+		profile string
+		args    map[string]string
+		// expected maps flags to their values once settings are applied
+		expected map[string]string
+		sources  map[string]string
+	}{
+		"config file": {
+			expected: map[string]string{"key": "sign.key", "sigstore": "false", "payload-type": "text/plain", "filter": "[a,b]", "log-level": "info"},
+			sources:  map[string]string{"key": "config file, section sign", "payload-type": "config file", "log-level": "config file"},
+		},
+		"profile": {
+			profile:  "release",
+			expected: map[string]string{"key": "release.key", "log-level": "debug", "payload-type": "text/plain"},
+			sources:  map[string]string{"key": "profile 'release'", "log-level": "profile 'release'"},
+		},
+		"environment": {
+			env:      map[string]string{"ESSD_KEY": "env.key", "ESSD_FILTER": "x,y", "ESSD_LOG_LEVEL": "error"},
+			profile:  "release",
+			expected: map[string]string{"key": "env.key", "filter": "[x,y]", "log-level": "error"},
+			sources:  map[string]string{"key": "environment variable ESSD_KEY", "filter": "environment variable ESSD_FILTER"},
+		},
+		"environment of command": {
+			env:      map[string]string{"ESSD_KEY": "env.key", "ESSD_SIGN_KEY": "sign-env.key"},
+			expected: map[string]string{"key": "sign-env.key"},
+			sources:  map[string]string{"key": "environment variable ESSD_SIGN_KEY"},
+		},
+		"command line": {
+			env:      map[string]string{"ESSD_KEY": "env.key"},
+			profile:  "release",
+			args:     map[string]string{"key": "cli.key", "log-level": "warn"},
+			expected: map[string]string{"key": "cli.key", "log-level": "warn", "payload-type": "text/plain"},
+		},
+		// Settings are not applied to flags that are mutually exclusive with
+		// flags set with a higher precedence
+		"mutually exclusive profile": {
+			profile:  "keyless",
+			expected: map[string]string{"sigstore": "true", "key": ""},
+			sources:  map[string]string{"sigstore": "profile 'keyless', section sign"},
+		},
+		"mutually exclusive command line": {
+			profile:  "keyless",
+			args:     map[string]string{"key": "cli.key"},
+			expected: map[string]string{"sigstore": "false", "key": "cli.key"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			for variable, value := range test.env {
+				t.Setenv(variable, value)
+			}
+			f := loadTestConfig(t, testConfig)
+			root, sign := newCommands()
+			if err := f.Validate(root); err != nil {
+				t.Fatal(err)
+			}
+			for flag, value := range test.args {
+				if err := sign.Flags().Set(flag, value); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			settings, err := f.Resolve(Flags(sign), SectionPath(sign), test.profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sources := map[string]string{}
+			for _, setting := range settings {
+				sources[setting.Flag] = setting.Source
+			}
+			for flag, source := range test.sources {
+				if sources[flag] != source {
+					t.Fatalf("--%s resolved from '%s', expected '%s'", flag, sources[flag], source)
+				}
+			}
+
+			if err := Apply(sign, settings); err != nil {
+				t.Fatal(err)
+			}
+			for flag, value := range test.expected {
+				if actual := sign.Flags().Lookup(flag).Value.String(); actual != value {
+					t.Fatalf("--%s is '%s', expected '%s'", flag, actual, value)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveInvalid(t *testing.T) {
+	_, sign := newCommands()
+
+	f := loadTestConfig(t, testConfig)
+	if _, err := f.Resolve(Flags(sign), SectionPath(sign), "unknown"); !errors.Is(err, ErrUnknownProfile) {
+		t.Fatalf("expected ErrUnknownProfile, got %v", err)
+	}
+
+	f = loadTestConfig(t, "key: [a.key, b.key]\n")
+	if _, err := f.Resolve(Flags(sign), SectionPath(sign), ""); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := map[string]string{
+		"unknown flag":            "unknown: true\n",
+		"unknown command":         "verify:\n  key: a.key\n",
+		"flag of other command":   "sign:\n  log-level: debug\n  unknown: true\n",
+		"unknown flag in profile": "profiles:\n  release:\n    unknown: true\n",
+		"list of maps":            "sign:\n  filter: [{a: b}]\n",
+	}
+	for name, contents := range tests {
+		t.Run(name, func(t *testing.T) {
+			root, _ := newCommands()
+			if err := loadTestConfig(t, contents).Validate(root); !errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("expected ErrInvalidConfig, got %v", err)
+			}
+		})
+	}
+
+	for _, contents := range []string{"profiles: []\n", "profiles:\n  release: a.key\n"} {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path, true); !errors.Is(err, ErrInvalidConfig) {
+			t.Fatalf("expected ErrInvalidConfig for %q, got %v", contents, err)
+		}
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "config.yaml"), false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "config.yaml"), true); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package cose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// Algorithm is a COSE algorithm identifier, see
+// https://www.iana.org/assignments/cose/cose.xhtml#algorithms.
+type Algorithm int64
+
+const (
+	AlgorithmES256 Algorithm = -7
+	AlgorithmES384 Algorithm = -35
+	AlgorithmES512 Algorithm = -36
+	AlgorithmEdDSA Algorithm = -8
+	AlgorithmPS256 Algorithm = -37
+)
+
+var (
+	// ErrUnsupportedAlgorithm indicates that a key or signature uses an
+	// algorithm that is not supported.
+	ErrUnsupportedAlgorithm = errors.New("unsupported COSE algorithm")
+	// ErrKeyMismatch indicates that a key cannot verify signatures of an
+	// algorithm.
+	ErrKeyMismatch = errors.New("key does not match signature algorithm")
+	// ErrInvalidSignature indicates that a signature is not valid.
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case AlgorithmES256:
+		return "ES256"
+	case AlgorithmES384:
+		return "ES384"
+	case AlgorithmES512:
+		return "ES512"
+	case AlgorithmEdDSA:
+		return "EdDSA"
+	case AlgorithmPS256:
+		return "PS256"
+	}
+	return fmt.Sprintf("%d", int64(a))
+}
+
+// AlgorithmForKey returns the algorithm used to sign with the public key's
+// private key. ECDSA keys are used with the hash matching their curve, and RSA
+// keys with RSASSA-PSS using SHA-256.
+func AlgorithmForKey(pub crypto.PublicKey) (Algorithm, error) {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return AlgorithmES256, nil
+		case elliptic.P384():
+			return AlgorithmES384, nil
+		case elliptic.P521():
+			return AlgorithmES512, nil
+		}
+		return 0, fmt.Errorf("%w: ECDSA curve %s", ErrUnsupportedAlgorithm, k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return AlgorithmEdDSA, nil
+	case *rsa.PublicKey:
+		return AlgorithmPS256, nil
+	}
+	return 0, fmt.Errorf("%w: key type %T", ErrUnsupportedAlgorithm, pub)
+}
+
+func (a Algorithm) hash() crypto.Hash {
+	switch a {
+	case AlgorithmES256, AlgorithmPS256:
+		return crypto.SHA256
+	case AlgorithmES384:
+		return crypto.SHA384
+	case AlgorithmES512:
+		return crypto.SHA512
+	}
+	// EdDSA signs the message itself
+	return 0
+}
+
+func (a Algorithm) sign(signer crypto.Signer, message []byte) ([]byte, error) {
+	digest := message
+	if hash := a.hash(); hash != 0 {
+		h := hash.New()
+		h.Write(message)
+		digest = h.Sum(nil)
+	}
+
+	switch a {
+	case AlgorithmES256, AlgorithmES384, AlgorithmES512:
+		pub, ok := signer.Public().(*ecdsa.PublicKey)
+		if !ok {
+			return nil, ErrKeyMismatch
+		}
+		der, err := signer.Sign(rand.Reader, digest, a.hash())
+		if err != nil {
+			return nil, err
+		}
+		// COSE encodes ECDSA signatures as the fixed size concatenation of r
+		// and s rather than ASN.1
+		r, s, err := parseECDSASignature(der)
+		if err != nil {
+			return nil, err
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		sig := make([]byte, 2*size)
+		r.FillBytes(sig[:size])
+		s.FillBytes(sig[size:])
+		return sig, nil
+	case AlgorithmEdDSA:
+		return signer.Sign(rand.Reader, digest, crypto.Hash(0))
+	case AlgorithmPS256:
+		return signer.Sign(rand.Reader, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: a.hash()})
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, a)
+}
+
+func (a Algorithm) verify(pub crypto.PublicKey, message, sig []byte) error {
+	digest := message
+	if hash := a.hash(); hash != 0 {
+		h := hash.New()
+		h.Write(message)
+		digest = h.Sum(nil)
+	}
+
+	switch a {
+	case AlgorithmES256, AlgorithmES384, AlgorithmES512:
+		k, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return ErrKeyMismatch
+		}
+		if expected, err := AlgorithmForKey(k); err != nil || expected != a {
+			return ErrKeyMismatch
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return ErrInvalidSignature
+		}
+		return nil
+	case AlgorithmEdDSA:
+		k, ok := pub.(ed25519.PublicKey)
+		if !ok {
+			return ErrKeyMismatch
+		}
+		if !ed25519.Verify(k, digest, sig) {
+			return ErrInvalidSignature
+		}
+		return nil
+	case AlgorithmPS256:
+		k, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return ErrKeyMismatch
+		}
+		if err := rsa.VerifyPSS(k, a.hash(), digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: a.hash()}); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, a)
+}
+
+func parseECDSASignature(der []byte) (*big.Int, *big.Int, error) {
+	var (
+		r, s  = new(big.Int), new(big.Int)
+		inner cryptobyte.String
+	)
+	input := cryptobyte.String(der)
+	if !input.ReadASN1(&inner, asn1.SEQUENCE) || !input.Empty() ||
+		!inner.ReadASN1Integer(r) || !inner.ReadASN1Integer(s) || !inner.Empty() {
+		return nil, nil, errors.New("invalid ASN.1 ECDSA signature")
+	}
+	return r, s, nil
+}
@@ -0,0 +1,327 @@
+// Package cose implements the COSE_Sign1 and COSE_Sign structures of RFC 9052
+// for signing payloads with the keys used for DSSE envelopes.
+package cose
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Format is a COSE signing structure.
+type Format string
+
+const (
+	// FormatSign1 is the COSE_Sign1 structure, which holds a single signature
+	// whose algorithm is recorded in the structure's protected header.
+	FormatSign1 Format = "cose-sign1"
+	// FormatSign is the COSE_Sign structure, which holds any number of
+	// signatures, each with its own headers.
+	FormatSign Format = "cose-sign"
+)
+
+// Formats lists the supported COSE signing structures.
+var Formats = []Format{FormatSign1, FormatSign}
+
+const (
+	tagSign1 = 18
+	tagSign  = 98
+
+	headerAlgorithm   = 1
+	headerContentType = 3
+	headerKeyID       = 4
+
+	contextSign1 = "Signature1"
+	contextSign  = "Signature"
+)
+
+var (
+	// ErrNotCOSE indicates that data is not a tagged COSE_Sign1 or COSE_Sign
+	// structure.
+	ErrNotCOSE = errors.New("data is not a COSE_Sign1 or COSE_Sign structure")
+	// ErrInvalidMessage indicates that a COSE structure is malformed.
+	ErrInvalidMessage = errors.New("invalid COSE structure")
+	// ErrUnknownFormat indicates that a COSE structure is not supported.
+	ErrUnknownFormat = errors.New("unknown COSE format")
+	// ErrSign1Signed indicates that a signature was added to a COSE_Sign1
+	// structure that is already signed.
+	ErrSign1Signed = errors.New("COSE_Sign1 structure can only hold a single signature, use COSE_Sign for multiple signatures")
+)
+
+var (
+	encMode cbor.EncMode
+	decMode cbor.DecMode
+)
+
+func init() {
+	var err error
+	// Headers are encoded deterministically, so that their encoding is stable
+	encMode, err = cbor.CoreDetEncOptions().EncMode()
+	if err != nil {
+		panic(err)
+	}
+	decMode, err = cbor.DecOptions{
+		DupMapKey:   cbor.DupMapKeyEnforcedAPF,
+		IndefLength: cbor.IndefLengthForbidden,
+	}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+}
+
+/*
+Message is a COSE_Sign1 or COSE_Sign structure. The content type header
+records the payload type of the equivalent DSSE envelope. The protected headers
+of parsed structures are kept as they were encoded, as signatures are computed
+over their encoding.
+*/
+type Message struct {
+	Format      Format
+	ContentType string
+	Payload     []byte
+	Signatures  []Signature
+
+	protected []byte
+}
+
+// Signature is a signature of a COSE structure.
+type Signature struct {
+	Algorithm Algorithm
+	KeyID     string
+	Signature []byte
+
+	protected []byte
+}
+
+// NewMessage creates an unsigned COSE structure of the format for the payload.
+func NewMessage(format Format, contentType string, payload []byte) (*Message, error) {
+	if format != FormatSign1 && format != FormatSign {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownFormat, format)
+	}
+
+	return &Message{
+		Format:      format,
+		ContentType: contentType,
+		Payload:     payload,
+		Signatures:  []Signature{},
+	}, nil
+}
+
+type sign1Message struct {
+	_           struct{} `cbor:",toarray"`
+	Protected   []byte
+	Unprotected map[int64]any
+	Payload     []byte
+	Signature   []byte
+}
+
+type signMessage struct {
+	_           struct{} `cbor:",toarray"`
+	Protected   []byte
+	Unprotected map[int64]any
+	Payload     []byte
+	Signatures  []signature
+}
+
+type signature struct {
+	_           struct{} `cbor:",toarray"`
+	Protected   []byte
+	Unprotected map[int64]any
+	Signature   []byte
+}
+
+// IsCOSE returns true if data starts with the tag of a COSE_Sign1 or COSE_Sign
+// structure.
+func IsCOSE(data []byte) bool {
+	return bytes.HasPrefix(data, []byte{0xc0 | tagSign1}) || bytes.HasPrefix(data, []byte{0xd8, tagSign})
+}
+
+// Marshal encodes the signed structure as a tagged COSE_Sign1 or COSE_Sign
+// structure.
+func Marshal(m *Message) ([]byte, error) {
+	if len(m.Signatures) == 0 {
+		return nil, fmt.Errorf("%w: structure is not signed", ErrInvalidMessage)
+	}
+
+	switch m.Format {
+	case FormatSign1:
+		s := m.Signatures[0]
+		content, err := encMode.Marshal(sign1Message{
+			Protected:   s.protected,
+			Unprotected: unprotectedHeaders(s.KeyID),
+			Payload:     nonNil(m.Payload),
+			Signature:   s.Signature,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return encMode.Marshal(cbor.RawTag{Number: tagSign1, Content: content})
+	case FormatSign:
+		signatures := []signature{}
+		for _, s := range m.Signatures {
+			signatures = append(signatures, signature{
+				Protected:   s.protected,
+				Unprotected: unprotectedHeaders(s.KeyID),
+				Signature:   s.Signature,
+			})
+		}
+		content, err := encMode.Marshal(signMessage{
+			Protected:   m.protected,
+			Unprotected: map[int64]any{},
+			Payload:     nonNil(m.Payload),
+			Signatures:  signatures,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return encMode.Marshal(cbor.RawTag{Number: tagSign, Content: content})
+	}
+
+	return nil, fmt.Errorf("%w: '%s'", ErrUnknownFormat, m.Format)
+}
+
+/*
+Unmarshal decodes a tagged COSE_Sign1 or COSE_Sign structure. Detached payloads
+are not supported, and the content type header must be a string, as it holds a
+payload type.
+*/
+func Unmarshal(data []byte) (*Message, error) {
+	if !IsCOSE(data) {
+		return nil, ErrNotCOSE
+	}
+
+	tag := cbor.RawTag{}
+	if err := decMode.Unmarshal(data, &tag); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+	}
+
+	if tag.Number == tagSign1 {
+		raw := sign1Message{}
+		if err := decMode.Unmarshal(tag.Content, &raw); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+		}
+
+		protected, err := parseProtected(raw.Protected)
+		if err != nil {
+			return nil, err
+		}
+		m, err := newParsedMessage(FormatSign1, protected, raw.Payload)
+		if err != nil {
+			return nil, err
+		}
+		s, err := newParsedSignature(raw.Protected, protected, raw.Unprotected, raw.Signature)
+		if err != nil {
+			return nil, err
+		}
+		m.Signatures = append(m.Signatures, s)
+		return m, nil
+	}
+
+	raw := signMessage{}
+	if err := decMode.Unmarshal(tag.Content, &raw); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+	}
+
+	protected, err := parseProtected(raw.Protected)
+	if err != nil {
+		return nil, err
+	}
+	m, err := newParsedMessage(FormatSign, protected, raw.Payload)
+	if err != nil {
+		return nil, err
+	}
+	m.protected = raw.Protected
+	for _, rawSig := range raw.Signatures {
+		sigProtected, err := parseProtected(rawSig.Protected)
+		if err != nil {
+			return nil, err
+		}
+		s, err := newParsedSignature(rawSig.Protected, sigProtected, rawSig.Unprotected, rawSig.Signature)
+		if err != nil {
+			return nil, err
+		}
+		m.Signatures = append(m.Signatures, s)
+	}
+	return m, nil
+}
+
+func newParsedMessage(format Format, protected map[int64]any, payload []byte) (*Message, error) {
+	if payload == nil {
+		return nil, fmt.Errorf("%w: detached payloads are not supported", ErrInvalidMessage)
+	}
+
+	m := &Message{Format: format, Payload: payload, Signatures: []Signature{}}
+	if contentType, has := protected[headerContentType]; has {
+		contentTypeString, isString := contentType.(string)
+		if !isString {
+			return nil, fmt.Errorf("%w: content type is not a string", ErrInvalidMessage)
+		}
+		m.ContentType = contentTypeString
+	}
+	return m, nil
+}
+
+func newParsedSignature(encodedProtected []byte, protected, unprotected map[int64]any, sig []byte) (Signature, error) {
+	s := Signature{Signature: sig, protected: encodedProtected}
+
+	switch alg := protected[headerAlgorithm].(type) {
+	case int64:
+		s.Algorithm = Algorithm(alg)
+	case uint64:
+		s.Algorithm = Algorithm(alg) //nolint:gosec
+	default:
+		return Signature{}, fmt.Errorf("%w: algorithm is not set", ErrInvalidMessage)
+	}
+
+	// The key ID is usually unprotected, but can be protected
+	keyID, has := unprotected[headerKeyID]
+	if !has {
+		keyID, has = protected[headerKeyID]
+	}
+	if has {
+		keyIDBytes, isBytes := keyID.([]byte)
+		if !isBytes {
+			return Signature{}, fmt.Errorf("%w: key ID is not a byte string", ErrInvalidMessage)
+		}
+		s.KeyID = string(keyIDBytes)
+	}
+
+	return s, nil
+}
+
+// parseProtected decodes protected headers, which are empty if their encoding
+// is empty.
+func parseProtected(encoded []byte) (map[int64]any, error) {
+	headers := map[int64]any{}
+	if len(encoded) == 0 {
+		return headers, nil
+	}
+	if err := decMode.Unmarshal(encoded, &headers); err != nil {
+		return nil, fmt.Errorf("%w: unable to decode protected headers: %w", ErrInvalidMessage, err)
+	}
+	return headers, nil
+}
+
+func encodeProtected(headers map[int64]any) ([]byte, error) {
+	if len(headers) == 0 {
+		return []byte{}, nil
+	}
+	return encMode.Marshal(headers)
+}
+
+func unprotectedHeaders(keyID string) map[int64]any {
+	headers := map[int64]any{}
+	if keyID != "" {
+		headers[headerKeyID] = []byte(keyID)
+	}
+	return headers
+}
+
+func nonNil(b []byte) []byte {
+	if b == nil {
+		return []byte{}
+	}
+	return b
+}
@@ -0,0 +1,113 @@
+package cose
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+
+	"github.com/adityasaky/essd/internal/dsse"
+)
+
+// ErrIncompatibleSigner indicates that a signer cannot create signatures using
+// standard algorithms.
+var ErrIncompatibleSigner = errors.New("signer cannot create COSE signatures")
+
+// Signer signs COSE structures using the private key of a DSSE signer.
+type Signer struct {
+	key       crypto.Signer
+	keyID     string
+	algorithm Algorithm
+}
+
+// NewSigner creates a COSE signer for the DSSE signer, which must implement
+// dsse.PrivateKeySigner with a key whose algorithm COSE supports.
+func NewSigner(signer dsse.Signer) (*Signer, error) {
+	privateKeySigner, ok := signer.(dsse.PrivateKeySigner)
+	if !ok {
+		return nil, ErrIncompatibleSigner
+	}
+
+	key, err := privateKeySigner.PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := AlgorithmForKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := signer.KeyID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Signer{key: key, keyID: keyID, algorithm: algorithm}, nil
+}
+
+// Algorithm returns the algorithm the signer signs with.
+func (s *Signer) Algorithm() Algorithm {
+	return s.algorithm
+}
+
+// Sign adds a signature to the structure. The key ID is recorded as an
+// unprotected header.
+func (m *Message) Sign(s *Signer) error {
+	if m.Format == FormatSign1 && len(m.Signatures) > 0 {
+		return ErrSign1Signed
+	}
+
+	sig := Signature{Algorithm: s.algorithm, KeyID: s.keyID}
+
+	var (
+		toBeSigned []byte
+		err        error
+	)
+	switch m.Format {
+	case FormatSign1:
+		headers := map[int64]any{headerAlgorithm: int64(s.algorithm)}
+		if m.ContentType != "" {
+			headers[headerContentType] = m.ContentType
+		}
+		if sig.protected, err = encodeProtected(headers); err != nil {
+			return err
+		}
+	case FormatSign:
+		// The body's protected headers cannot change once it is signed
+		if len(m.Signatures) == 0 {
+			headers := map[int64]any{}
+			if m.ContentType != "" {
+				headers[headerContentType] = m.ContentType
+			}
+			if m.protected, err = encodeProtected(headers); err != nil {
+				return err
+			}
+		}
+		if sig.protected, err = encodeProtected(map[int64]any{headerAlgorithm: int64(s.algorithm)}); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: '%s'", ErrUnknownFormat, m.Format)
+	}
+
+	toBeSigned, err = m.toBeSigned(sig)
+	if err != nil {
+		return err
+	}
+
+	if sig.Signature, err = s.algorithm.sign(s.key, toBeSigned); err != nil {
+		return err
+	}
+	m.Signatures = append(m.Signatures, sig)
+	return nil
+}
+
+// toBeSigned returns the Sig_structure encoding that the signature is computed
+// over, see https://www.rfc-editor.org/rfc/rfc9052#section-4.4.
+func (m *Message) toBeSigned(s Signature) ([]byte, error) {
+	switch m.Format {
+	case FormatSign1:
+		return encMode.Marshal([]any{contextSign1, nonNil(s.protected), []byte{}, nonNil(m.Payload)})
+	case FormatSign:
+		return encMode.Marshal([]any{contextSign, nonNil(m.protected), nonNil(s.protected), []byte{}, nonNil(m.Payload)})
+	}
+	return nil, fmt.Errorf("%w: '%s'", ErrUnknownFormat, m.Format)
+}
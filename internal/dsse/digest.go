@@ -0,0 +1,129 @@
+package dsse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ErrInvalidPAE indicates that data is not a PAE encoding.
+var ErrInvalidPAE = errors.New("invalid PAE encoding")
+
+const (
+	// maxPAELengthDigits bounds the length fields of PAE encodings that are
+	// read.
+	maxPAELengthDigits = 19
+	// maxPAEPayloadTypeLen bounds the payload types of PAE encodings that are
+	// read, as they are held in memory.
+	maxPAEPayloadTypeLen = 1 << 16
+)
+
+/*
+DigestSigner is implemented by signers that can sign the digest of a message
+rather than the message, so that the message does not need to be sent to
+them. The digest must be computed using the signer's digest algorithm.
+*/
+type DigestSigner interface {
+	Signer
+	DigestAlgorithm() crypto.Hash
+	SignDigest(ctx context.Context, digest []byte) ([]byte, error)
+}
+
+/*
+DigestVerifier is implemented by verifiers that can verify a signature over a
+message using the digest of the message, computed using the verifier's digest
+algorithm.
+*/
+type DigestVerifier interface {
+	Verifier
+	DigestAlgorithm() crypto.Hash
+	VerifyDigest(ctx context.Context, digest []byte, sig []byte) error
+}
+
+/*
+ReadPAEPrefix reads the PAE encoding from r up to the payload, and returns the
+payload type and the length of the payload, which can then be read from r.
+*/
+func ReadPAEPrefix(r *bufio.Reader) (string, int64, error) {
+	version, err := readPAEField(r, len("DSSEv1"))
+	if err != nil {
+		return "", 0, err
+	}
+	if version != "DSSEv1" {
+		return "", 0, fmt.Errorf("%w: unknown version '%s'", ErrInvalidPAE, version)
+	}
+
+	payloadTypeLen, err := readPAELength(r)
+	if err != nil {
+		return "", 0, err
+	}
+	if payloadTypeLen > maxPAEPayloadTypeLen {
+		return "", 0, fmt.Errorf("%w: payload type is too long", ErrInvalidPAE)
+	}
+	payloadType := make([]byte, payloadTypeLen+1)
+	if _, err := io.ReadFull(r, payloadType); err != nil {
+		return "", 0, fmt.Errorf("%w: %w", ErrInvalidPAE, err)
+	}
+	if payloadType[payloadTypeLen] != ' ' {
+		return "", 0, fmt.Errorf("%w: payload type does not match its length", ErrInvalidPAE)
+	}
+
+	payloadLen, err := readPAELength(r)
+	if err != nil {
+		return "", 0, err
+	}
+	return string(payloadType[:payloadTypeLen]), payloadLen, nil
+}
+
+// ParsePAE returns the payload type and payload encoded in the PAE encoding.
+func ParsePAE(data []byte) (string, []byte, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	payloadType, payloadLen, err := ReadPAEPrefix(r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	payload, err := io.ReadAll(r)
+	if err != nil {
+		return "", nil, err
+	}
+	if int64(len(payload)) != payloadLen {
+		return "", nil, fmt.Errorf("%w: payload does not match its length", ErrInvalidPAE)
+	}
+	return payloadType, payload, nil
+}
+
+// readPAEField reads a field of at most maxLen bytes terminated by a space.
+func readPAEField(r *bufio.Reader, maxLen int) (string, error) {
+	field := []byte{}
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrInvalidPAE, err)
+		}
+		if b == ' ' {
+			return string(field), nil
+		}
+		if len(field) == maxLen {
+			return "", fmt.Errorf("%w: field is too long", ErrInvalidPAE)
+		}
+		field = append(field, b)
+	}
+}
+
+func readPAELength(r *bufio.Reader) (int64, error) {
+	field, err := readPAEField(r, maxPAELengthDigits)
+	if err != nil {
+		return 0, err
+	}
+	length, err := strconv.ParseInt(field, 10, 64)
+	if err != nil || length < 0 || strconv.FormatInt(length, 10) != field {
+		return 0, fmt.Errorf("%w: invalid length '%s'", ErrInvalidPAE, field)
+	}
+	return length, nil
+}
@@ -0,0 +1,153 @@
+package dsse
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	protodsse "github.com/sigstore/protobuf-specs/gen/pb-go/dsse"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Format is an encoding of envelopes.
+type Format string
+
+const (
+	// FormatJSON is the JSON envelope encoding defined by the DSSE
+	// specification, with a base64 encoded payload.
+	FormatJSON Format = "json"
+	// FormatProtobuf is the binary protobuf encoding of the io.intoto.Envelope
+	// message, which holds the payload and signatures as raw bytes.
+	FormatProtobuf Format = "protobuf"
+	// FormatProtoJSON is the protojson encoding of the io.intoto.Envelope
+	// message.
+	FormatProtoJSON Format = "protojson"
+)
+
+var (
+	// ErrUnknownFormat indicates that an envelope encoding is not supported.
+	ErrUnknownFormat = errors.New("unknown envelope format")
+	// ErrNotEnvelope indicates that data could not be decoded as an envelope
+	// in any supported format.
+	ErrNotEnvelope = errors.New("data is not an envelope in a supported format")
+	// ErrExtensionUnsupported indicates that an envelope's signatures have
+	// extensions, which the protobuf encodings cannot hold.
+	ErrExtensionUnsupported = errors.New("signature extensions cannot be encoded using protobuf, remove them first")
+)
+
+// Formats lists the supported envelope encodings.
+var Formats = []Format{FormatJSON, FormatProtobuf, FormatProtoJSON}
+
+/*
+Marshal encodes the envelope in the format. Signature extensions are not part
+of the io.intoto.Envelope message, so envelopes whose signatures have
+extensions can only be encoded as JSON.
+*/
+func Marshal(e *Envelope, format Format) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return json.Marshal(e)
+	case FormatProtobuf:
+		protoEnv, err := toProto(e)
+		if err != nil {
+			return nil, err
+		}
+		return proto.Marshal(protoEnv)
+	case FormatProtoJSON:
+		protoEnv, err := toProto(e)
+		if err != nil {
+			return nil, err
+		}
+		return protojson.Marshal(protoEnv)
+	}
+
+	return nil, fmt.Errorf("%w: '%s'", ErrUnknownFormat, format)
+}
+
+/*
+Unmarshal decodes an envelope, detecting whether it is encoded as JSON or as
+binary protobuf. JSON envelopes and protojson envelopes are decoded the same
+way, as their field names and base64 encoded payloads match, and are reported
+as FormatJSON. Binary protobuf envelopes must have a payload type and no fields
+other than those of an io.intoto.Envelope.
+*/
+func Unmarshal(data []byte) (*Envelope, Format, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		e := &Envelope{}
+		if err := json.Unmarshal(data, e); err != nil {
+			return nil, "", err
+		}
+		return e, FormatJSON, nil
+	}
+
+	protoEnv := &protodsse.Envelope{}
+	if err := proto.Unmarshal(data, protoEnv); err != nil {
+		return nil, "", fmt.Errorf("%w: %w", ErrNotEnvelope, err)
+	}
+	// Arbitrary data can decode as protobuf, so only complete envelopes are
+	// accepted
+	if protoEnv.GetPayloadType() == "" || hasUnknownFields(protoEnv) {
+		return nil, "", ErrNotEnvelope
+	}
+
+	return fromProto(protoEnv), FormatProtobuf, nil
+}
+
+func toProto(e *Envelope) (*protodsse.Envelope, error) {
+	payload, err := e.DecodeB64Payload()
+	if err != nil {
+		return nil, err
+	}
+
+	protoEnv := &protodsse.Envelope{
+		Payload:     payload,
+		PayloadType: e.PayloadType,
+		Signatures:  []*protodsse.Signature{},
+	}
+	for _, s := range e.Signatures {
+		if s.Extension != nil {
+			return nil, ErrExtensionUnsupported
+		}
+		sig, err := b64Decode(s.Sig)
+		if err != nil {
+			return nil, err
+		}
+		protoEnv.Signatures = append(protoEnv.Signatures, &protodsse.Signature{
+			Sig:   sig,
+			Keyid: s.KeyID,
+		})
+	}
+
+	return protoEnv, nil
+}
+
+func fromProto(protoEnv *protodsse.Envelope) *Envelope {
+	e := &Envelope{
+		PayloadType: protoEnv.GetPayloadType(),
+		Payload:     base64.StdEncoding.EncodeToString(protoEnv.GetPayload()),
+		Signatures:  []Signature{},
+	}
+	for _, s := range protoEnv.GetSignatures() {
+		e.Signatures = append(e.Signatures, Signature{
+			KeyID: s.GetKeyid(),
+			Sig:   base64.StdEncoding.EncodeToString(s.GetSig()),
+		})
+	}
+
+	return e
+}
+
+func hasUnknownFields(protoEnv *protodsse.Envelope) bool {
+	if len(protoEnv.ProtoReflect().GetUnknown()) > 0 {
+		return true
+	}
+	for _, s := range protoEnv.GetSignatures() {
+		if len(s.ProtoReflect().GetUnknown()) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -40,6 +40,14 @@ type Signature struct {
 	Extension *Extension `json:"extension,omitempty"`
 }
 
+/*
+DecodeB64Sig returns the signature's raw bytes, decoded from the sig field
+using the same flexible decoder as DecodeB64Payload.
+*/
+func (s *Signature) DecodeB64Sig() ([]byte, error) {
+	return b64Decode(s.Sig)
+}
+
 type Extension struct {
 	Kind string           `json:"kind"`
 	Ext  *structpb.Struct `json:"ext"`
@@ -50,23 +58,27 @@ PAE implementes the DSSE Pre-Authentic Encoding
 https://github.com/secure-systems-lab/dsse/blob/master/protocol.md#signature-definition
 */
 func PAE(payloadType string, payload []byte) []byte {
-	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s",
-		len(payloadType), payloadType,
-		len(payload), payload))
+	prefix := paePrefix(payloadType, int64(len(payload)))
+	paeEnc := make([]byte, 0, len(prefix)+len(payload))
+	return append(append(paeEnc, prefix...), payload...)
+}
+
+// paePrefix returns the PAE encoding up to the payload, so that the payload
+// can be appended or streamed after it.
+func paePrefix(payloadType string, payloadLen int64) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d ", len(payloadType), payloadType, payloadLen))
 }
 
 /*
-Both standard and url encoding are allowed:
+Both standard and url encoding are allowed, with or without padding:
 https://github.com/secure-systems-lab/dsse/blob/master/envelope.md
 */
 func b64Decode(s string) ([]byte, error) {
-	b, err := base64.StdEncoding.DecodeString(s)
-	if err != nil {
-		b, err = base64.URLEncoding.DecodeString(s)
-		if err != nil {
-			return nil, fmt.Errorf("unable to base64 decode payload (is payload in the right format?)")
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if b, err := encoding.DecodeString(s); err == nil {
+			return b, nil
 		}
 	}
 
-	return b, nil
+	return nil, fmt.Errorf("unable to base64 decode payload (is payload in the right format?)")
 }
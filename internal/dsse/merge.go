@@ -0,0 +1,80 @@
+package dsse
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNoEnvelopes indicates that no envelopes were provided to merge.
+	ErrNoEnvelopes = errors.New("no envelopes provided")
+	// ErrEnvelopeMismatch indicates that envelopes being merged do not have
+	// the same payload and payload type.
+	ErrEnvelopeMismatch = errors.New("envelopes do not have the same payload and payload type")
+)
+
+/*
+Merge combines the signatures of the envelopes, which must have the same
+payload and payload type, into a new envelope. Signatures with the same key ID
+and signature bytes are only included once, in the order they first appear.
+Extensions are preserved; when a duplicate signature carries an extension the
+first occurrence lacks, the extension is kept.
+*/
+func Merge(envelopes ...*Envelope) (*Envelope, error) {
+	if len(envelopes) == 0 {
+		return nil, ErrNoEnvelopes
+	}
+
+	first := envelopes[0]
+	payload, err := first.DecodeB64Payload()
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &Envelope{
+		PayloadType: first.PayloadType,
+		Payload:     first.Payload,
+		Signatures:  []Signature{},
+	}
+
+	type sigKey struct {
+		keyID string
+		sig   string
+	}
+	seen := map[sigKey]int{}
+
+	for i, env := range envelopes {
+		if env.PayloadType != first.PayloadType {
+			return nil, fmt.Errorf("%w: envelope %d has payload type '%s', expected '%s'", ErrEnvelopeMismatch, i+1, env.PayloadType, first.PayloadType)
+		}
+		// Payloads are compared decoded as either base64 encoding is allowed
+		envPayload, err := env.DecodeB64Payload()
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(envPayload, payload) {
+			return nil, fmt.Errorf("%w: envelope %d has a different payload", ErrEnvelopeMismatch, i+1)
+		}
+
+		for _, sig := range env.Signatures {
+			sigBytes, err := b64Decode(sig.Sig)
+			if err != nil {
+				return nil, fmt.Errorf("unable to decode signature in envelope %d: %w", i+1, err)
+			}
+
+			key := sigKey{keyID: sig.KeyID, sig: string(sigBytes)}
+			if index, isDuplicate := seen[key]; isDuplicate {
+				if merged.Signatures[index].Extension == nil {
+					merged.Signatures[index].Extension = sig.Extension
+				}
+				continue
+			}
+
+			seen[key] = len(merged.Signatures)
+			merged.Signatures = append(merged.Signatures, sig)
+		}
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,63 @@
+package dsse
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	payload := base64.StdEncoding.EncodeToString([]byte("payload\xfb\xff"))
+	urlPayload := base64.URLEncoding.EncodeToString([]byte("payload\xfb\xff"))
+	alice := Signature{KeyID: "alice", Sig: base64.StdEncoding.EncodeToString([]byte("alice"))}
+	bob := Signature{KeyID: "bob", Sig: base64.StdEncoding.EncodeToString([]byte("bob"))}
+	// The same signature, encoded differently, is a duplicate
+	aliceURL := Signature{KeyID: "alice", Sig: base64.RawURLEncoding.EncodeToString([]byte("alice"))}
+	aliceExtension := Signature{KeyID: "alice", Sig: alice.Sig, Extension: &Extension{Kind: "kind"}}
+	// The same signature bytes under another key ID are not a duplicate
+	carol := Signature{KeyID: "carol", Sig: alice.Sig}
+
+	merged, err := Merge(
+		&Envelope{PayloadType: "text/plain", Payload: payload, Signatures: []Signature{alice, bob}},
+		&Envelope{PayloadType: "text/plain", Payload: urlPayload, Signatures: []Signature{bob, aliceURL, aliceExtension, carol}},
+		&Envelope{PayloadType: "text/plain", Payload: payload},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.PayloadType != "text/plain" || merged.Payload != payload {
+		t.Fatalf("unexpected envelope %+v", merged)
+	}
+	if len(merged.Signatures) != 3 {
+		t.Fatalf("expected 3 signatures, got %+v", merged.Signatures)
+	}
+	for i, keyID := range []string{"alice", "bob", "carol"} {
+		if merged.Signatures[i].KeyID != keyID {
+			t.Fatalf("signature %d has key ID '%s', expected '%s'", i, merged.Signatures[i].KeyID, keyID)
+		}
+	}
+	// The extension of a duplicate is kept if the first occurrence lacks one
+	if merged.Signatures[0].Sig != alice.Sig || merged.Signatures[0].Extension == nil || merged.Signatures[0].Extension.Kind != "kind" {
+		t.Fatalf("unexpected signature %+v", merged.Signatures[0])
+	}
+}
+
+func TestMergeMismatch(t *testing.T) {
+	env := &Envelope{PayloadType: "text/plain", Payload: base64.StdEncoding.EncodeToString([]byte("payload"))}
+
+	tests := map[string]*Envelope{
+		"payload type": {PayloadType: "application/json", Payload: env.Payload},
+		"payload":      {PayloadType: "text/plain", Payload: base64.StdEncoding.EncodeToString([]byte("other"))},
+	}
+	for name, other := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Merge(env, other); !errors.Is(err, ErrEnvelopeMismatch) {
+				t.Fatalf("expected ErrEnvelopeMismatch, got %v", err)
+			}
+		})
+	}
+
+	if _, err := Merge(); !errors.Is(err, ErrNoEnvelopes) {
+		t.Fatalf("expected ErrNoEnvelopes, got %v", err)
+	}
+}
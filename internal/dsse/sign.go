@@ -63,23 +63,51 @@ func (es *EnvelopeSigner) SignPayload(ctx context.Context, payloadType string, b
 		PayloadType: payloadType,
 	}
 
-	paeEnc := PAE(payloadType, body)
-
 	for _, signer := range es.providers {
-		sig, err := signer.Sign(ctx, paeEnc)
-		if err != nil {
+		if err := AddSignature(ctx, &e, signer); err != nil {
 			return nil, err
 		}
-		keyID, err := signer.KeyID()
-		if err != nil {
-			keyID = ""
-		}
-
-		e.Signatures = append(e.Signatures, Signature{
-			KeyID: keyID,
-			Sig:   base64.StdEncoding.EncodeToString(sig),
-		})
 	}
 
 	return &e, nil
 }
+
+/*
+AddSignature signs the envelope's payload and payload type using the signer and
+appends the resulting signature to the envelope. If the signer implements
+SignerWithExtension, the verification material it returns is recorded in the
+signature's extension.
+*/
+func AddSignature(ctx context.Context, e *Envelope, signer Signer) error {
+	body, err := e.DecodeB64Payload()
+	if err != nil {
+		return err
+	}
+	paeEnc := PAE(e.PayloadType, body)
+
+	var (
+		sig []byte
+		ext *Extension
+	)
+	if extSigner, ok := signer.(SignerWithExtension); ok {
+		sig, ext, err = extSigner.SignWithExtension(ctx, paeEnc)
+	} else {
+		sig, err = signer.Sign(ctx, paeEnc)
+	}
+	if err != nil {
+		return err
+	}
+
+	keyID, err := signer.KeyID()
+	if err != nil {
+		keyID = ""
+	}
+
+	e.Signatures = append(e.Signatures, Signature{
+		KeyID:     keyID,
+		Sig:       base64.StdEncoding.EncodeToString(sig),
+		Extension: ext,
+	})
+
+	return nil
+}
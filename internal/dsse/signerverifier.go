@@ -34,11 +34,37 @@ type Verifier interface {
 	Public() crypto.PublicKey
 }
 
+/*
+SignerWithExtension is implemented by signers that produce verification
+material, such as a certificate or transparency log entry, alongside the raw
+signature. The material is recorded in the signature's extension.
+*/
+type SignerWithExtension interface {
+	SignWithExtension(ctx context.Context, data []byte) ([]byte, *Extension, error)
+}
+
+/*
+PrivateKeySigner is implemented by signers that can sign using their private
+key directly. Formats such as COSE and JWS require signatures created using
+standard algorithms, so signers whose signatures use another format, such as
+SSH signatures, provide their private key instead.
+*/
+type PrivateKeySigner interface {
+	PrivateKey() (crypto.Signer, error)
+}
+
 type SupportsSignatureExtension interface {
 	SetExtension(*structpb.Struct)
 	ExpectedExtensionKind() string
 }
 
+// BackendVerifier is implemented by verifiers that report the backend they
+// verify signatures with, such as ssh or sigstore, which is recorded in
+// diagnostics.
+type BackendVerifier interface {
+	Backend() string
+}
+
 // SignerVerifier provides both the signing and verification interface.
 type SignerVerifier interface {
 	Signer
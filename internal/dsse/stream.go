@@ -0,0 +1,570 @@
+package dsse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// streamChunkSize is the size of the chunks payloads are decoded in.
+const streamChunkSize = 32 * 1024
+
+var (
+	// ErrInvalidEnvelope indicates that a streamed envelope could not be
+	// decoded.
+	ErrInvalidEnvelope = errors.New("invalid envelope")
+	// ErrUnknownField indicates that a streamed envelope has a field that is
+	// not part of an envelope.
+	ErrUnknownField = errors.New("envelope has unknown field")
+)
+
+/*
+StreamSigner is implemented by signers that can sign a message read from a
+reader, hashing it incrementally rather than holding it in memory.
+*/
+type StreamSigner interface {
+	Signer
+	SignStream(ctx context.Context, r io.Reader) ([]byte, error)
+}
+
+/*
+StreamVerifier is implemented by verifiers that can verify a signature over a
+message read from a reader, hashing it incrementally rather than holding it in
+memory.
+*/
+type StreamVerifier interface {
+	Verifier
+	VerifyStream(ctx context.Context, r io.Reader, sig []byte) error
+}
+
+/*
+StreamedEnvelope is an envelope whose payload is read from an io.ReaderAt, such
+as a file, rather than held in memory. The payload is read each time it is
+signed, verified, or encoded.
+*/
+type StreamedEnvelope struct {
+	PayloadType string
+	Signatures  []Signature
+	Payload     io.ReaderAt
+	PayloadSize int64
+}
+
+/*
+PAEReader returns a reader of the PAE encoding of the envelope's payload type
+and payload, reading the payload as the encoding is read.
+*/
+func (e *StreamedEnvelope) PAEReader() io.Reader {
+	return io.MultiReader(
+		bytes.NewReader(paePrefix(e.PayloadType, e.PayloadSize)),
+		io.NewSectionReader(e.Payload, 0, e.PayloadSize),
+	)
+}
+
+/*
+AddSignature signs the envelope's PAE encoding using the signer and appends the
+resulting signature to the envelope. Signers that implement StreamSigner are
+passed the encoding as it is read. Other signers, and signers that implement
+SignerWithExtension, are passed the encoding in memory.
+*/
+func (e *StreamedEnvelope) AddSignature(ctx context.Context, signer Signer) error {
+	var (
+		sig []byte
+		ext *Extension
+		err error
+	)
+	switch s := signer.(type) {
+	case SignerWithExtension:
+		// Verification material, such as transparency log entries, may
+		// record the signed data
+		paeEnc, err := io.ReadAll(e.PAEReader())
+		if err != nil {
+			return err
+		}
+		sig, ext, err = s.SignWithExtension(ctx, paeEnc)
+		if err != nil {
+			return err
+		}
+	case StreamSigner:
+		sig, err = s.SignStream(ctx, e.PAEReader())
+		if err != nil {
+			return err
+		}
+	default:
+		paeEnc, err := io.ReadAll(e.PAEReader())
+		if err != nil {
+			return err
+		}
+		sig, err = signer.Sign(ctx, paeEnc)
+		if err != nil {
+			return err
+		}
+	}
+
+	keyID, err := signer.KeyID()
+	if err != nil {
+		keyID = ""
+	}
+
+	e.Signatures = append(e.Signatures, Signature{
+		KeyID:     keyID,
+		Sig:       base64.StdEncoding.EncodeToString(sig),
+		Extension: ext,
+	})
+
+	return nil
+}
+
+/*
+Encode writes the envelope as JSON to w, base64 encoding the payload as it is
+read. The encoding matches that of an Envelope marshalled using encoding/json.
+*/
+func (e *StreamedEnvelope) Encode(w io.Writer) error {
+	payloadType, err := json.Marshal(e.PayloadType)
+	if err != nil {
+		return err
+	}
+	signatures, err := json.Marshal(e.Signatures)
+	if err != nil {
+		return err
+	}
+
+	bufferedWriter := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(bufferedWriter, `{"payloadType":%s,"payload":"`, payloadType); err != nil {
+		return err
+	}
+	encoder := base64.NewEncoder(base64.StdEncoding, bufferedWriter)
+	if _, err := io.Copy(encoder, io.NewSectionReader(e.Payload, 0, e.PayloadSize)); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(bufferedWriter, `","signatures":%s}`, signatures); err != nil {
+		return err
+	}
+
+	return bufferedWriter.Flush()
+}
+
+/*
+DecodeEnvelope decodes the JSON envelope read from r, writing its base64
+decoded payload to payload as it is read rather than holding it in memory. The
+returned envelope's PayloadSize is set to the size of the decoded payload, and
+its Payload must be set by the caller, for example to the file payload was
+written to. Fields other than those of an envelope are rejected.
+*/
+func DecodeEnvelope(r io.Reader, payload io.Writer) (*StreamedEnvelope, error) {
+	reader := bufio.NewReader(r)
+	env := &StreamedEnvelope{}
+
+	if err := expectByte(reader, '{'); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for {
+		c, err := nextNonSpace(reader)
+		if err != nil {
+			return nil, err
+		}
+		if c == '}' && len(seen) == 0 {
+			break
+		}
+		if c != '"' {
+			return nil, fmt.Errorf("%w: expected field name, found '%c'", ErrInvalidEnvelope, c)
+		}
+
+		nameBuffer := &bytes.Buffer{}
+		if err := decodeString(reader, nameBuffer); err != nil {
+			return nil, err
+		}
+		// Field names are matched case-insensitively, as encoding/json does
+		name := strings.ToLower(nameBuffer.String())
+		if seen[name] {
+			return nil, fmt.Errorf("%w: duplicate field '%s'", ErrInvalidEnvelope, nameBuffer.String())
+		}
+		seen[name] = true
+
+		if err := expectByte(reader, ':'); err != nil {
+			return nil, err
+		}
+
+		switch name {
+		case "payload":
+			if err := expectByte(reader, '"'); err != nil {
+				return nil, err
+			}
+			decoder := &base64Writer{w: payload}
+			if err := decodeString(reader, decoder); err != nil {
+				return nil, err
+			}
+			if err := decoder.Close(); err != nil {
+				return nil, err
+			}
+			env.PayloadSize = decoder.n
+		case "payloadtype":
+			if err := decodeValue(reader, &env.PayloadType); err != nil {
+				return nil, err
+			}
+		case "signatures":
+			if err := decodeValue(reader, &env.Signatures); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%w: '%s'", ErrUnknownField, nameBuffer.String())
+		}
+
+		c, err = nextNonSpace(reader)
+		if err != nil {
+			return nil, err
+		}
+		if c == '}' {
+			break
+		}
+		if c != ',' {
+			return nil, fmt.Errorf("%w: expected ',' or '}', found '%c'", ErrInvalidEnvelope, c)
+		}
+	}
+
+	if !seen["payload"] {
+		return nil, fmt.Errorf("%w: missing payload", ErrInvalidEnvelope)
+	}
+
+	// Only whitespace may follow the envelope
+	for {
+		c, err := reader.ReadByte()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return nil, fmt.Errorf("%w: unexpected data after envelope", ErrInvalidEnvelope)
+	}
+
+	return env, nil
+}
+
+func nextNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return 0, fmt.Errorf("%w: %w", ErrInvalidEnvelope, io.ErrUnexpectedEOF)
+			}
+			return 0, err
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return c, nil
+	}
+}
+
+func expectByte(r *bufio.Reader, expected byte) error {
+	c, err := nextNonSpace(r)
+	if err != nil {
+		return err
+	}
+	if c != expected {
+		return fmt.Errorf("%w: expected '%c', found '%c'", ErrInvalidEnvelope, expected, c)
+	}
+	return nil
+}
+
+/*
+decodeString decodes the rest of a JSON string, whose opening quote has been
+read, writing the unescaped string to w in chunks.
+*/
+func decodeString(r *bufio.Reader, w io.Writer) error {
+	chunk := make([]byte, 0, streamChunkSize)
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		_, err := w.Write(chunk)
+		chunk = chunk[:0]
+		return err
+	}
+
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("%w: unterminated string", ErrInvalidEnvelope)
+			}
+			return err
+		}
+
+		switch {
+		case c == '"':
+			return flush()
+		case c < 0x20:
+			return fmt.Errorf("%w: control character in string", ErrInvalidEnvelope)
+		case c == '\\':
+			escaped, err := decodeEscape(r)
+			if err != nil {
+				return err
+			}
+			chunk = append(chunk, escaped...)
+		default:
+			chunk = append(chunk, c)
+		}
+
+		if len(chunk) >= streamChunkSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func decodeEscape(r *bufio.Reader) ([]byte, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("%w: unterminated string", ErrInvalidEnvelope)
+	}
+
+	switch c {
+	case '"', '\\', '/':
+		return []byte{c}, nil
+	case 'b':
+		return []byte{'\b'}, nil
+	case 'f':
+		return []byte{'\f'}, nil
+	case 'n':
+		return []byte{'\n'}, nil
+	case 'r':
+		return []byte{'\r'}, nil
+	case 't':
+		return []byte{'\t'}, nil
+	case 'u':
+		hexDigits := make([]byte, 4)
+		if _, err := io.ReadFull(r, hexDigits); err != nil {
+			return nil, fmt.Errorf("%w: unterminated string", ErrInvalidEnvelope)
+		}
+		codePoint, err := strconv.ParseUint(string(hexDigits), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid escape '\\u%s'", ErrInvalidEnvelope, hexDigits)
+		}
+
+		// Characters outside the basic multilingual plane are escaped as
+		// surrogate pairs. Unpaired surrogates are decoded as U+FFFD, as
+		// encoding/json does.
+		if utf16.IsSurrogate(rune(codePoint)) {
+			if low, found := peekLowSurrogate(r); found {
+				return utf8.AppendRune(nil, utf16.DecodeRune(rune(codePoint), low)), nil
+			}
+		}
+		return utf8.AppendRune(nil, rune(codePoint)), nil
+	}
+
+	return nil, fmt.Errorf("%w: invalid escape '\\%c'", ErrInvalidEnvelope, c)
+}
+
+// peekLowSurrogate consumes the escaped low surrogate that completes a
+// surrogate pair, if it follows.
+func peekLowSurrogate(r *bufio.Reader) (rune, bool) {
+	next, err := r.Peek(6)
+	if err != nil || next[0] != '\\' || next[1] != 'u' {
+		return 0, false
+	}
+	codePoint, err := strconv.ParseUint(string(next[2:]), 16, 16)
+	if err != nil || codePoint < 0xdc00 || codePoint > 0xdfff {
+		return 0, false
+	}
+	if _, err := r.Discard(6); err != nil {
+		return 0, false
+	}
+	return rune(codePoint), true
+}
+
+/*
+decodeValue reads a JSON value and unmarshals it into v. It is used for fields
+other than the payload, which are small.
+*/
+func decodeValue(r *bufio.Reader, v any) error {
+	raw := &bytes.Buffer{}
+	if err := scanValue(r, raw); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw.Bytes(), v); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidEnvelope, err)
+	}
+	return nil
+}
+
+// scanValue copies a JSON value from r to w without interpreting it.
+func scanValue(r *bufio.Reader, w *bytes.Buffer) error {
+	c, err := nextNonSpace(r)
+	if err != nil {
+		return err
+	}
+
+	depth := 0
+	for {
+		switch c {
+		case '"':
+			w.WriteByte(c)
+			if err := scanString(r, w); err != nil {
+				return err
+			}
+		case '{', '[':
+			w.WriteByte(c)
+			depth++
+		case '}', ']':
+			if depth == 0 {
+				// The end of the enclosing object
+				return r.UnreadByte()
+			}
+			w.WriteByte(c)
+			depth--
+		case ',':
+			if depth == 0 {
+				return r.UnreadByte()
+			}
+			w.WriteByte(c)
+		default:
+			w.WriteByte(c)
+		}
+
+		if depth == 0 && (c == '"' || c == '}' || c == ']') {
+			return nil
+		}
+
+		c, err = r.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("%w: %w", ErrInvalidEnvelope, io.ErrUnexpectedEOF)
+			}
+			return err
+		}
+	}
+}
+
+// scanString copies the rest of a JSON string from r to w without unescaping
+// it.
+func scanString(r *bufio.Reader, w *bytes.Buffer) error {
+	escaped := false
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("%w: unterminated string", ErrInvalidEnvelope)
+		}
+		w.WriteByte(c)
+
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			return nil
+		}
+	}
+}
+
+/*
+base64Writer decodes base64 written to it, writing the decoded bytes to w. Both
+standard and URL encodings are accepted, with or without padding, as for
+Envelope.DecodeB64Payload. Like it, encodings that mix the characters of both
+alphabets are rejected.
+*/
+type base64Writer struct {
+	w       io.Writer
+	buf     []byte
+	decoded []byte
+	padded  bool
+	n       int64
+	// standard and urlSafe record if characters only used by the standard
+	// and URL alphabets were decoded
+	standard bool
+	urlSafe  bool
+}
+
+func (b *base64Writer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+
+	// Only complete quanta of four characters are decoded
+	complete := len(b.buf) / 4 * 4
+	if complete == 0 {
+		return len(p), nil
+	}
+	if err := b.decode(b.buf[:complete]); err != nil {
+		return 0, err
+	}
+	b.buf = b.buf[:copy(b.buf, b.buf[complete:])]
+
+	return len(p), nil
+}
+
+// Close decodes the final characters of an unpadded encoding, and checks that
+// the encoding was complete.
+func (b *base64Writer) Close() error {
+	switch len(b.buf) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("%w: unable to base64 decode payload (is payload in the right format?)", ErrInvalidEnvelope)
+	}
+	return b.decode(b.buf)
+}
+
+func (b *base64Writer) decode(encoded []byte) error {
+	// Padding may only appear at the end of the encoding
+	if b.padded {
+		return fmt.Errorf("%w: unable to base64 decode payload (is payload in the right format?)", ErrInvalidEnvelope)
+	}
+	b.padded = encoded[len(encoded)-1] == '=' || len(encoded)%4 != 0
+
+	// Only the final characters of unpadded encodings are not a complete
+	// quantum
+	encoding := base64.StdEncoding
+	if len(encoded)%4 != 0 {
+		encoding = base64.RawStdEncoding
+	}
+
+	for i, c := range encoded {
+		switch c {
+		case '+', '/':
+			b.standard = true
+		case '-':
+			b.urlSafe = true
+			encoded[i] = '+'
+		case '_':
+			b.urlSafe = true
+			encoded[i] = '/'
+		}
+	}
+	if b.standard && b.urlSafe {
+		return fmt.Errorf("%w: unable to base64 decode payload (is payload in the right format?)", ErrInvalidEnvelope)
+	}
+
+	if decodedLen := encoding.DecodedLen(len(encoded)); cap(b.decoded) < decodedLen {
+		b.decoded = make([]byte, decodedLen)
+	}
+	n, err := encoding.Decode(b.decoded[:cap(b.decoded)], encoded)
+	if err != nil {
+		return fmt.Errorf("%w: unable to base64 decode payload (is payload in the right format?)", ErrInvalidEnvelope)
+	}
+	if _, err := b.w.Write(b.decoded[:n]); err != nil {
+		return err
+	}
+	b.n += int64(n)
+
+	return nil
+}
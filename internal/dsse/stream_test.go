@@ -0,0 +1,239 @@
+package dsse
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const benchmarkPayloadSize = 64 << 20
+
+// streamSignerVerifier signs and verifies the SHA-256 digest of messages
+// using an ECDSA key, hashing streamed messages incrementally.
+type streamSignerVerifier struct {
+	key *ecdsa.PrivateKey
+}
+
+func newStreamSignerVerifier(t testing.TB) *streamSignerVerifier {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &streamSignerVerifier{key: key}
+}
+
+func (s *streamSignerVerifier) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	return s.SignStream(ctx, bytes.NewReader(data))
+}
+
+func (s *streamSignerVerifier) SignStream(_ context.Context, r io.Reader) ([]byte, error) {
+	digest, err := hashStream(r)
+	if err != nil {
+		return nil, err
+	}
+	return ecdsa.SignASN1(rand.Reader, s.key, digest)
+}
+
+func (s *streamSignerVerifier) Verify(ctx context.Context, data, sig []byte) error {
+	return s.VerifyStream(ctx, bytes.NewReader(data), sig)
+}
+
+func (s *streamSignerVerifier) VerifyStream(_ context.Context, r io.Reader, sig []byte) error {
+	digest, err := hashStream(r)
+	if err != nil {
+		return err
+	}
+	if !ecdsa.VerifyASN1(&s.key.PublicKey, digest, sig) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+func (s *streamSignerVerifier) KeyID() (string, error) {
+	return "test", nil
+}
+
+func (s *streamSignerVerifier) Public() crypto.PublicKey {
+	return &s.key.PublicKey
+}
+
+func hashStream(r io.Reader) ([]byte, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// writePayload writes a payload of the size to a file, and returns the open
+// file.
+func writePayload(b *testing.B, size int) *os.File {
+	b.Helper()
+	payload, err := os.Create(filepath.Join(b.TempDir(), "payload"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { payload.Close() }) //nolint:errcheck
+	if _, err := io.CopyN(payload, rand.Reader, int64(size)); err != nil {
+		b.Fatal(err)
+	}
+	return payload
+}
+
+// BenchmarkSignStream signs and encodes an envelope with a large payload.
+// Memory allocated per operation should not grow with the payload size.
+func BenchmarkSignStream(b *testing.B) {
+	signer := newStreamSignerVerifier(b)
+	payload := writePayload(b, benchmarkPayloadSize)
+
+	b.ReportAllocs()
+	b.SetBytes(benchmarkPayloadSize)
+	for b.Loop() {
+		env := &StreamedEnvelope{PayloadType: "application/octet-stream", Payload: payload, PayloadSize: benchmarkPayloadSize}
+		if err := env.AddSignature(context.Background(), signer); err != nil {
+			b.Fatal(err)
+		}
+		if err := env.Encode(io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkVerifyStream decodes and verifies an envelope with a large
+// payload. Memory allocated per operation should not grow with the payload
+// size.
+func BenchmarkVerifyStream(b *testing.B) {
+	signerVerifier := newStreamSignerVerifier(b)
+	payload := writePayload(b, benchmarkPayloadSize)
+
+	env := &StreamedEnvelope{PayloadType: "application/octet-stream", Payload: payload, PayloadSize: benchmarkPayloadSize}
+	if err := env.AddSignature(context.Background(), signerVerifier); err != nil {
+		b.Fatal(err)
+	}
+	encoded, err := os.Create(filepath.Join(b.TempDir(), "envelope.json"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer encoded.Close() //nolint:errcheck
+	if err := env.Encode(encoded); err != nil {
+		b.Fatal(err)
+	}
+
+	verifier, err := NewEnvelopeVerifier(signerVerifier)
+	if err != nil {
+		b.Fatal(err)
+	}
+	decoded, err := os.Create(filepath.Join(b.TempDir(), "payload"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer decoded.Close() //nolint:errcheck
+
+	b.ReportAllocs()
+	b.SetBytes(benchmarkPayloadSize)
+	for b.Loop() {
+		if _, err := encoded.Seek(0, io.SeekStart); err != nil {
+			b.Fatal(err)
+		}
+		if err := decoded.Truncate(0); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := decoded.Seek(0, io.SeekStart); err != nil {
+			b.Fatal(err)
+		}
+
+		decodedEnv, err := DecodeEnvelope(encoded, decoded)
+		if err != nil {
+			b.Fatal(err)
+		}
+		decodedEnv.Payload = decoded
+		if _, err := verifier.VerifyStream(context.Background(), decodedEnv); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDecodeEnvelopeBase64(t *testing.T) {
+	payload := []byte("payload\xfb\xff")
+
+	tests := map[string]string{
+		"standard":          base64.StdEncoding.EncodeToString(payload),
+		"url":               base64.URLEncoding.EncodeToString(payload),
+		"standard unpadded": base64.RawStdEncoding.EncodeToString(payload),
+		"url unpadded":      base64.RawURLEncoding.EncodeToString(payload),
+	}
+	for name, encoded := range tests {
+		t.Run(name, func(t *testing.T) {
+			// The streaming decoder accepts the same encodings as b64Decode
+			expected, err := b64Decode(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(expected, payload) {
+				t.Fatalf("b64Decode returned %q, expected %q", expected, payload)
+			}
+
+			decoded := &bytes.Buffer{}
+			env, err := DecodeEnvelope(strings.NewReader(`{"payloadType":"text/plain","payload":"`+encoded+`","signatures":[]}`), decoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decoded.Bytes(), payload) {
+				t.Fatalf("decoded payload %q, expected %q", decoded.Bytes(), payload)
+			}
+			if env.PayloadSize != int64(len(payload)) {
+				t.Fatalf("payload size %d, expected %d", env.PayloadSize, len(payload))
+			}
+		})
+	}
+
+	// Encodings that mix the standard and URL alphabets are also rejected,
+	// including when the characters are in different quanta
+	invalid := []string{"cGF5bG9hZA=x", "cGF5b", "cGF5bG9hZA=cGF5", "+-/_", "++++____", "AAA+AAA_"}
+	for _, encoded := range invalid {
+		t.Run("invalid "+encoded, func(t *testing.T) {
+			if _, err := b64Decode(encoded); err == nil {
+				t.Fatal("expected b64Decode to reject encoding")
+			}
+			_, err := DecodeEnvelope(strings.NewReader(`{"payload":"`+encoded+`"}`), io.Discard)
+			if !errors.Is(err, ErrInvalidEnvelope) {
+				t.Fatalf("expected ErrInvalidEnvelope, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDecodeEnvelopeEscapes(t *testing.T) {
+	tests := map[string]string{
+		`text\/plain\n`:      "text/plain\n",
+		`\u00e9`:             "\u00e9",
+		`\ud83d\ude00`:       "\U0001f600",
+		`\ud83dx`:            "\ufffdx",
+		`\ude00\ud83d`:       "\ufffd\ufffd",
+		`\ud83d\u0041`:       "\ufffdA",
+		`\ud83d\ud83d\ude00`: "\ufffd\U0001f600",
+	}
+	for escaped, expected := range tests {
+		t.Run(escaped, func(t *testing.T) {
+			env, err := DecodeEnvelope(strings.NewReader(`{"payloadType":"`+escaped+`","payload":""}`), io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if env.PayloadType != expected {
+				t.Fatalf("decoded %q, expected %q", env.PayloadType, expected)
+			}
+		})
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"crypto"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -12,6 +14,10 @@ import (
 // ErrNoSignature indicates that an envelope did not contain any signatures.
 var ErrNoSignature = errors.New("no signature found")
 
+// ErrThresholdNotMet indicates that fewer signatures than the threshold were
+// verified.
+var ErrThresholdNotMet = errors.New("accepted signatures do not match threshold")
+
 type EnvelopeVerifier struct {
 	providers []Verifier
 	threshold int
@@ -40,12 +46,54 @@ func (ev *EnvelopeVerifier) Verify(ctx context.Context, e *Envelope) ([]Accepted
 	// Generate PAE(payloadtype, serialized body)
 	paeEnc := PAE(e.PayloadType, body)
 
+	return ev.verify(e.PayloadType, e.Signatures, func(v Verifier, sig []byte) error {
+		return v.Verify(ctx, paeEnc, sig)
+	})
+}
+
+/*
+VerifyStream verifies the envelope like Verify, without holding its payload in
+memory. Verifiers that implement StreamVerifier are passed the PAE encoding as
+it is read, other verifiers are passed the encoding in memory.
+*/
+func (ev *EnvelopeVerifier) VerifyStream(ctx context.Context, e *StreamedEnvelope) ([]AcceptedKey, error) {
+	if e == nil {
+		return nil, errors.New("cannot verify a nil envelope")
+	}
+
+	if len(e.Signatures) == 0 {
+		return nil, ErrNoSignature
+	}
+
+	// The encoding is only read into memory if a verifier needs it
+	var paeEnc []byte
+	return ev.verify(e.PayloadType, e.Signatures, func(v Verifier, sig []byte) error {
+		if streamVerifier, ok := v.(StreamVerifier); ok {
+			return streamVerifier.VerifyStream(ctx, e.PAEReader(), sig)
+		}
+
+		if paeEnc == nil {
+			var err error
+			paeEnc, err = io.ReadAll(e.PAEReader())
+			if err != nil {
+				return err
+			}
+		}
+		return v.Verify(ctx, paeEnc, sig)
+	})
+}
+
+// verify checks the signatures using verifySig, which verifies a signature
+// over the envelope's PAE encoding using a verifier. Each step is logged at the
+// debug level.
+func (ev *EnvelopeVerifier) verify(payloadType string, signatures []Signature, verifySig func(v Verifier, sig []byte) error) ([]AcceptedKey, error) {
+	logger := slog.With(slog.String("payloadType", payloadType))
 	// If *any* signature is found to be incorrect, it is skipped
 	var acceptedKeys []AcceptedKey
 	usedKeyids := make(map[string]string)
 	unverified_providers := make([]Verifier, len(ev.providers))
 	copy(unverified_providers, ev.providers)
-	for _, s := range e.Signatures {
+	for _, s := range signatures {
 		sig, err := b64Decode(s.Sig)
 		if err != nil {
 			return nil, err
@@ -67,21 +115,26 @@ func (ev *EnvelopeVerifier) Verify(ctx context.Context, e *Envelope) ([]Accepted
 				}
 			}
 
+			verifierLogger := logger.With(slog.String("keyid", keyID), slog.String("backend", backend(v)))
 			if s.KeyID != "" && keyID != "" && err == nil && s.KeyID != keyID {
+				verifierLogger.Debug("Skipping verifier, key ID does not match signature", slog.String("signatureKeyid", s.KeyID))
 				continue
 			}
 
 			if v, supportsSignatureExtension := v.(SupportsSignatureExtension); supportsSignatureExtension {
 				if s.Extension == nil || s.Extension.Kind != v.ExpectedExtensionKind() {
+					verifierLogger.Debug("Skipping verifier, signature does not have the expected extension", slog.String("extensionKind", v.ExpectedExtensionKind()))
 					continue
 				}
 				v.SetExtension(s.Extension.Ext)
 			}
 
-			err = v.Verify(ctx, paeEnc, sig)
+			err = verifySig(v, sig)
 			if err != nil {
+				verifierLogger.Debug("Signature not verified", slog.Any("error", err))
 				continue
 			}
+			verifierLogger.Debug("Signature verified")
 
 			acceptedKey := AcceptedKey{
 				Public: v.Public(),
@@ -92,7 +145,7 @@ func (ev *EnvelopeVerifier) Verify(ctx context.Context, e *Envelope) ([]Accepted
 
 			// See https://github.com/in-toto/in-toto/pull/251
 			if _, ok := usedKeyids[keyID]; ok {
-				fmt.Printf("Found envelope signed by different subkeys of the same main key, Only one of them is counted towards the step threshold, KeyID=%s\n", keyID)
+				verifierLogger.Warn("Found envelope signed by different subkeys of the same main key, only one of them is counted towards the threshold")
 				continue
 			}
 
@@ -107,8 +160,9 @@ func (ev *EnvelopeVerifier) Verify(ctx context.Context, e *Envelope) ([]Accepted
 		return nil, errors.New("invalid threshold")
 	}
 
+	logger.Debug("Checked envelope signatures against threshold", slog.Int("accepted", len(acceptedKeys)), slog.Int("threshold", ev.threshold))
 	if len(usedKeyids) < ev.threshold {
-		return acceptedKeys, fmt.Errorf("accepted signatures do not match threshold, Found: %d, Expected %d", len(acceptedKeys), ev.threshold)
+		return acceptedKeys, fmt.Errorf("%w, Found: %d, Expected %d", ErrThresholdNotMet, len(acceptedKeys), ev.threshold)
 	}
 
 	return acceptedKeys, nil
@@ -141,6 +195,15 @@ func SHA256KeyID(pub crypto.PublicKey) (string, error) {
 	return fingerprint, nil
 }
 
+// backend returns the backend the verifier verifies signatures with, for
+// diagnostics.
+func backend(v Verifier) string {
+	if v, ok := v.(BackendVerifier); ok {
+		return v.Backend()
+	}
+	return fmt.Sprintf("%T", v)
+}
+
 func removeIndex(v []Verifier, index int) []Verifier {
 	return append(v[:index], v[index+1:]...)
 }
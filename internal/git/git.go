@@ -0,0 +1,199 @@
+// Package git attaches DSSE envelopes to git objects and retrieves them. The
+// envelopes are stored as git notes on the objects they are attached to, one
+// envelope per line, and git is invoked to read and write the notes.
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	ita1 "github.com/in-toto/attestation/go/v1"
+)
+
+// DefaultNotesRef is the notes ref envelopes are stored under by default.
+const DefaultNotesRef = "refs/notes/essd"
+
+var (
+	ErrUnsupportedObjectFormat = errors.New("only repositories using SHA-1 object IDs are supported")
+	ErrUnsupportedObjectType   = errors.New("unsupported git object type")
+)
+
+// digestAlgorithms maps git object types to the in-toto digest set keys used
+// for them.
+var digestAlgorithms = map[string]string{
+	"commit": string(ita1.AlgorithmGitCommit),
+	"tag":    string(ita1.AlgorithmGitTag),
+	"tree":   string(ita1.AlgorithmGitTree),
+	"blob":   string(ita1.AlgorithmGitBlob),
+}
+
+// Repository is a git repository, which may be bare.
+type Repository struct {
+	dir string
+}
+
+// Object is a git object a revision resolved to.
+type Object struct {
+	ID   string
+	Type string
+	// RefName is the full name of the ref the revision named, if any.
+	RefName string
+}
+
+// Subject returns the in-toto resource descriptor for the object. It is named
+// using the ref the object was resolved from, or the object ID otherwise.
+func (o *Object) Subject() *ita1.ResourceDescriptor {
+	name := o.RefName
+	if name == "" {
+		name = o.ID
+	}
+	return &ita1.ResourceDescriptor{
+		Name:   name,
+		Digest: map[string]string{digestAlgorithms[o.Type]: o.ID},
+	}
+}
+
+// Matches indicates if the resource descriptor records the object's ID.
+func (o *Object) Matches(subject *ita1.ResourceDescriptor) bool {
+	return subject.GetDigest()[digestAlgorithms[o.Type]] == o.ID
+}
+
+// Open returns the repository at dir, which may be a worktree or a bare
+// repository.
+func Open(dir string) (*Repository, error) {
+	r := &Repository{dir: dir}
+
+	objectFormat, err := r.git(nil, "rev-parse", "--show-object-format")
+	if err != nil {
+		return nil, err
+	}
+	if objectFormat != "sha1" {
+		return nil, ErrUnsupportedObjectFormat
+	}
+
+	return r, nil
+}
+
+// ResolveObject resolves the revision to the object it names. Annotated tags
+// resolve to the tag object rather than the tagged commit.
+func (r *Repository) ResolveObject(rev string) (*Object, error) {
+	objectID, err := r.git(nil, "rev-parse", "--verify", "--end-of-options", rev+"^{object}")
+	if err != nil {
+		return nil, err
+	}
+
+	objectType, err := r.git(nil, "cat-file", "-t", objectID)
+	if err != nil {
+		return nil, err
+	}
+	if _, supported := digestAlgorithms[objectType]; !supported {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedObjectType, objectType)
+	}
+
+	// Ambiguous and non-ref revisions have no symbolic name. Older versions
+	// of git print --end-of-options rather than accepting it here, so it is
+	// not used, which is safe as revisions that verified are not options.
+	refName := ""
+	if !strings.HasPrefix(rev, "-") {
+		refName, err = r.git(nil, "rev-parse", "--symbolic-full-name", rev)
+		if err != nil || !strings.HasPrefix(refName, "refs/") {
+			refName = ""
+		}
+	}
+
+	return &Object{ID: objectID, Type: objectType, RefName: refName}, nil
+}
+
+// Envelopes returns the envelopes attached to the object under the notes ref.
+func (r *Repository) Envelopes(notesRef, objectID string) ([]*dsse.Envelope, error) {
+	// git notes show fails when there is no note for the object, which is
+	// only reported as such by git notes list
+	if _, err := r.git(nil, "notes", "--ref", notesRef, "list", objectID); err != nil {
+		if isNoNote(err) {
+			return []*dsse.Envelope{}, nil
+		}
+		return nil, err
+	}
+
+	note, err := r.git(nil, "notes", "--ref", notesRef, "show", objectID)
+	if err != nil {
+		return nil, err
+	}
+
+	envs := []*dsse.Envelope{}
+	scanner := bufio.NewScanner(strings.NewReader(note))
+	scanner.Buffer(nil, 64*1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		env := &dsse.Envelope{}
+		if err := json.Unmarshal([]byte(line), env); err != nil {
+			return nil, fmt.Errorf("unable to parse envelope at line %d of note for '%s': %w", lineNumber, objectID, err)
+		}
+		envs = append(envs, env)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return envs, nil
+}
+
+// AddEnvelope attaches the envelope to the object under the notes ref,
+// retaining envelopes already attached to it.
+func (r *Repository) AddEnvelope(notesRef, objectID string, env *dsse.Envelope) error {
+	envs, err := r.Envelopes(notesRef, objectID)
+	if err != nil {
+		return err
+	}
+	envs = append(envs, env)
+
+	var note bytes.Buffer
+	for _, env := range envs {
+		envBytes, err := json.Marshal(env)
+		if err != nil {
+			return err
+		}
+		note.Write(envBytes)
+		note.WriteString("\n")
+	}
+
+	_, err = r.git(&note, "notes", "--ref", notesRef, "add", "--force", "--file", "-", objectID)
+	return err
+}
+
+func (r *Repository) git(stdin *bytes.Buffer, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", r.dir}, args...)...) //nolint:gosec
+	// Messages are matched by isNoNote, so they must not be translated
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run command %v: %w %s", cmd, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// isNoNote returns true if the error is git notes list reporting that the
+// object has no note, rather than failing to read the notes.
+func isNoNote(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == 1 && strings.Contains(err.Error(), "no note found")
+}
@@ -0,0 +1,155 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adityasaky/essd/internal/dsse"
+)
+
+// newRepository creates a bare repository holding a commit on main, which is
+// tagged by the annotated tag v1, and returns the repository and the commit's
+// ID.
+func newRepository(t *testing.T) (*Repository, string) {
+	t.Helper()
+	t.Setenv("GIT_AUTHOR_NAME", "essd")
+	t.Setenv("GIT_AUTHOR_EMAIL", "essd@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "essd")
+	t.Setenv("GIT_COMMITTER_EMAIL", "essd@example.com")
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	dir := t.TempDir()
+	run := func(stdin string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Stdin = strings.NewReader(stdin)
+		output, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	run("", "init", "--quiet", "--bare")
+	blob := run("contents\n", "hash-object", "-w", "--stdin")
+	tree := run("100644 blob "+blob+"\tfile\n", "mktree")
+	commit := run("", "commit-tree", "-m", "commit", tree)
+	run("", "update-ref", "refs/heads/main", commit)
+	run("", "tag", "-a", "-m", "tag", "v1", commit)
+
+	r, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, commit
+}
+
+func TestResolveObject(t *testing.T) {
+	r, commit := newRepository(t)
+
+	object, err := r.ResolveObject("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object.ID != commit || object.Type != "commit" || object.RefName != "refs/heads/main" {
+		t.Fatalf("unexpected object %+v", object)
+	}
+	if !object.Matches(object.Subject()) {
+		t.Fatal("object does not match its subject")
+	}
+
+	// Annotated tags resolve to the tag object
+	tag, err := r.ResolveObject("v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.ID == commit || tag.Type != "tag" || tag.RefName != "refs/tags/v1" {
+		t.Fatalf("unexpected tag object %+v", tag)
+	}
+	if subject := tag.Subject(); subject.GetDigest()["gitTag"] != tag.ID {
+		t.Fatalf("unexpected tag subject %v", subject)
+	}
+
+	if _, err := r.ResolveObject("missing"); err == nil {
+		t.Fatal("expected error resolving missing revision")
+	}
+}
+
+func TestEnvelopes(t *testing.T) {
+	r, commit := newRepository(t)
+
+	// Objects without notes have no envelopes
+	envs, err := r.Envelopes(DefaultNotesRef, commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(envs) != 0 {
+		t.Fatalf("expected no envelopes, got %d", len(envs))
+	}
+
+	first := &dsse.Envelope{PayloadType: "text/plain", Payload: "Zmlyc3Q=", Signatures: []dsse.Signature{{KeyID: "a", Sig: "c2ln"}}}
+	second := &dsse.Envelope{PayloadType: "text/plain", Payload: "c2Vjb25k", Signatures: []dsse.Signature{{KeyID: "b", Sig: "c2ln"}}}
+	for _, env := range []*dsse.Envelope{first, second} {
+		if err := r.AddEnvelope(DefaultNotesRef, commit, env); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	envs, err = r.Envelopes(DefaultNotesRef, commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(envs) != 2 || envs[0].Payload != first.Payload || envs[1].Payload != second.Payload {
+		t.Fatalf("unexpected envelopes %+v", envs)
+	}
+
+	// Other notes refs are separate
+	envs, err = r.Envelopes("refs/notes/other", commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(envs) != 0 {
+		t.Fatalf("expected no envelopes under other notes ref, got %d", len(envs))
+	}
+}
+
+func TestEnvelopesUnreadableNotes(t *testing.T) {
+	r, commit := newRepository(t)
+
+	// A notes ref that does not point to a notes tree cannot be read, which
+	// must not be mistaken for the object having no note
+	if err := os.MkdirAll(filepath.Join(r.dir, "refs", "notes"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(r.dir, "refs", "notes", "essd"), []byte(strings.Repeat("1", 40)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Envelopes(DefaultNotesRef, commit); err == nil {
+		t.Fatal("expected error reading unreadable notes")
+	}
+	if err := r.AddEnvelope(DefaultNotesRef, commit, &dsse.Envelope{PayloadType: "text/plain"}); err == nil {
+		t.Fatal("expected error adding envelope to unreadable notes")
+	}
+}
+
+func TestEnvelopesInvalidNote(t *testing.T) {
+	r, commit := newRepository(t)
+
+	if _, err := r.git(nil, "notes", "--ref", DefaultNotesRef, "add", "-m", "not an envelope", commit); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Envelopes(DefaultNotesRef, commit); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Fatalf("expected error parsing note, got %v", err)
+	}
+}
+
+func TestOpenNotRepository(t *testing.T) {
+	t.Setenv("GIT_CEILING_DIRECTORIES", os.TempDir())
+	if _, err := Open(t.TempDir()); err == nil {
+		t.Fatal("expected error opening directory that is not a repository")
+	}
+}
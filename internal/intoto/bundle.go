@@ -0,0 +1,155 @@
+package intoto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/adityasaky/essd/internal/dsse"
+)
+
+// BundleExtension is the file extension of in-toto attestation bundles.
+const BundleExtension = ".intoto.jsonl"
+
+var ErrEmptyBundle = errors.New("bundle does not contain any envelopes")
+
+// IsBundlePath returns true if the path has the extension of an in-toto
+// attestation bundle, or the extension of JSON Lines files.
+func IsBundlePath(path string) bool {
+	return strings.HasSuffix(path, BundleExtension) || strings.HasSuffix(path, ".jsonl")
+}
+
+// ParseBundle parses an in-toto attestation bundle, a JSON Lines file with one
+// DSSE envelope per line. See
+// https://github.com/in-toto/attestation/blob/main/spec/v1/bundle.md. Empty
+// lines are skipped.
+func ParseBundle(data []byte) ([]*dsse.Envelope, error) {
+	envelopes := []*dsse.Envelope{}
+
+	reader := bufio.NewReader(bytes.NewReader(data))
+	for lineNumber := 1; ; lineNumber++ {
+		// Envelopes can be larger than the line limits of bufio.Scanner
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			env, err := parseBundleLine(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse envelope on line %d of bundle: %w", lineNumber, err)
+			}
+			envelopes = append(envelopes, env)
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+
+	if len(envelopes) == 0 {
+		return nil, ErrEmptyBundle
+	}
+	return envelopes, nil
+}
+
+// parseBundleLine parses a line of a bundle. Lines must be envelopes with a
+// payload type and no other fields, so that other JSON Lines files are not
+// mistaken for bundles.
+func parseBundleLine(line []byte) (*dsse.Envelope, error) {
+	env := &dsse.Envelope{}
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(env); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("%w: line contains more than one JSON value", dsse.ErrNotEnvelope)
+	}
+	if env.PayloadType == "" {
+		return nil, fmt.Errorf("%w: payload type is not set", dsse.ErrNotEnvelope)
+	}
+	return env, nil
+}
+
+// MarshalBundle encodes the envelopes as an in-toto attestation bundle.
+func MarshalBundle(envelopes []*dsse.Envelope) ([]byte, error) {
+	var bundle bytes.Buffer
+	for _, env := range envelopes {
+		envBytes, err := json.Marshal(env)
+		if err != nil {
+			return nil, err
+		}
+		bundle.Write(envBytes)
+		bundle.WriteByte('\n')
+	}
+	return bundle.Bytes(), nil
+}
+
+// AppendToBundle appends the envelope to the bundle at path, creating the
+// bundle if it does not exist.
+func AppendToBundle(path string, env *dsse.Envelope) error {
+	envBytes, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close() //nolint:errcheck
+
+	// The last line of the bundle may not be terminated
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > 0 {
+		lastByte := make([]byte, 1)
+		if _, err := file.ReadAt(lastByte, info.Size()-1); err != nil {
+			return err
+		}
+		if lastByte[0] != '\n' {
+			envBytes = append([]byte{'\n'}, envBytes...)
+		}
+	}
+
+	if _, err := file.Write(append(envBytes, '\n')); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// BundleFilter selects envelopes of a bundle by their payload types and the
+// predicate types of the in-toto Statements they carry. Envelopes must match
+// each criterion that is set.
+type BundleFilter struct {
+	PayloadTypes   []string
+	PredicateTypes []string
+}
+
+// Match returns true if the envelope is selected by the filter.
+func (f *BundleFilter) Match(env *dsse.Envelope) bool {
+	if len(f.PayloadTypes) > 0 && !slices.Contains(f.PayloadTypes, env.PayloadType) {
+		return false
+	}
+
+	if len(f.PredicateTypes) > 0 {
+		statement, err := StatementFromEnvelope(env)
+		if err != nil {
+			return false
+		}
+		if !slices.Contains(f.PredicateTypes, statement.GetPredicateType()) {
+			return false
+		}
+	}
+
+	return true
+}
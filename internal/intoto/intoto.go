@@ -0,0 +1,191 @@
+// Package intoto builds and inspects in-toto attestation Statements carried in
+// DSSE envelopes. See https://github.com/in-toto/attestation.
+package intoto
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	ita1 "github.com/in-toto/attestation/go/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// PayloadType is the DSSE payload type for in-toto Statements.
+	PayloadType = "application/vnd.in-toto+json"
+
+	DigestSHA256 = "sha256"
+	DigestSHA512 = "sha512"
+)
+
+var (
+	ErrNotStatement           = errors.New("envelope payload is not an in-toto Statement")
+	ErrUnsupportedDigest      = errors.New("unsupported digest algorithm")
+	ErrSubjectNotFound        = errors.New("artifact does not match any subject of the statement")
+	ErrNoComparableDigest     = errors.New("statement subjects do not record a supported digest")
+	ErrUnexpectedPayloadType  = errors.New("envelope payload type is not application/vnd.in-toto+json")
+	ErrSubjectDigestsRequired = errors.New("at least one digest algorithm must be specified")
+)
+
+// NewStatement creates an in-toto v1 Statement for the subjects and predicate.
+func NewStatement(subjects []*ita1.ResourceDescriptor, predicateType string, predicate *structpb.Struct) (*ita1.Statement, error) {
+	statement := &ita1.Statement{
+		Type:          ita1.StatementTypeUri,
+		Subject:       subjects,
+		PredicateType: predicateType,
+		Predicate:     predicate,
+	}
+
+	if err := statement.Validate(); err != nil {
+		return nil, err
+	}
+
+	return statement, nil
+}
+
+// NewSubjectFromFile creates a resource descriptor for the file at path, named
+// using the path, with its digests computed using the specified algorithms.
+func NewSubjectFromFile(path string, algorithms []string) (*ita1.ResourceDescriptor, error) {
+	digests, err := DigestFile(path, algorithms)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ita1.ResourceDescriptor{
+		Name:   filepath.ToSlash(path),
+		Digest: digests,
+	}, nil
+}
+
+// DigestFile returns the hex encoded digests of the file at path for each of
+// the specified algorithms, reading the file once.
+func DigestFile(path string, algorithms []string) (map[string]string, error) {
+	if len(algorithms) == 0 {
+		return nil, ErrSubjectDigestsRequired
+	}
+
+	hashers := map[string]hash.Hash{}
+	writers := []io.Writer{}
+	for _, algorithm := range algorithms {
+		var h hash.Hash
+		switch algorithm {
+		case DigestSHA256:
+			h = sha256.New()
+		case DigestSHA512:
+			h = sha512.New()
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedDigest, algorithm)
+		}
+		hashers[algorithm] = h
+		writers = append(writers, h)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() //nolint:errcheck
+
+	if _, err := io.Copy(io.MultiWriter(writers...), file); err != nil {
+		return nil, err
+	}
+
+	digests := map[string]string{}
+	for algorithm, h := range hashers {
+		digests[algorithm] = hex.EncodeToString(h.Sum(nil))
+	}
+	return digests, nil
+}
+
+// LoadPredicate reads a JSON predicate from the file at path.
+func LoadPredicate(path string) (*structpb.Struct, error) {
+	predicateBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	predicate := &structpb.Struct{}
+	if err := protojson.Unmarshal(predicateBytes, predicate); err != nil {
+		return nil, fmt.Errorf("unable to parse predicate '%s': %w", path, err)
+	}
+	return predicate, nil
+}
+
+// StatementFromEnvelope decodes and validates the in-toto Statement in the
+// envelope's payload.
+func StatementFromEnvelope(env *dsse.Envelope) (*ita1.Statement, error) {
+	if env.PayloadType != PayloadType {
+		return nil, ErrUnexpectedPayloadType
+	}
+
+	payload, err := env.DecodeB64Payload()
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &ita1.Statement{}
+	if err := protojson.Unmarshal(payload, statement); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNotStatement, err)
+	}
+	if err := statement.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNotStatement, err)
+	}
+
+	return statement, nil
+}
+
+// MatchSubject checks that the file at path matches one of the statement's
+// subjects. Every supported digest recorded for a subject must match the file
+// for the subject to be considered a match, regardless of the case of its hex
+// encoding. The matching subject is returned.
+func MatchSubject(statement *ita1.Statement, path string) (*ita1.ResourceDescriptor, error) {
+	algorithms := []string{}
+	for _, algorithm := range []string{DigestSHA256, DigestSHA512} {
+		for _, subject := range statement.GetSubject() {
+			if _, has := subject.GetDigest()[algorithm]; has {
+				algorithms = append(algorithms, algorithm)
+				break
+			}
+		}
+	}
+	if len(algorithms) == 0 {
+		return nil, ErrNoComparableDigest
+	}
+
+	digests, err := DigestFile(path, algorithms)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, subject := range statement.GetSubject() {
+		matched := false
+		for algorithm, digest := range digests {
+			expected, has := subject.GetDigest()[algorithm]
+			if !has {
+				continue
+			}
+			// Hex encoded digests may be recorded in either case
+			if !strings.EqualFold(expected, digest) {
+				matched = false
+				break
+			}
+			matched = true
+		}
+
+		if matched {
+			return subject, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrSubjectNotFound, path)
+}
@@ -0,0 +1,65 @@
+package intoto
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ita1 "github.com/in-toto/attestation/go/v1"
+)
+
+func TestMatchSubject(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "artifact")
+	if err := os.WriteFile(path, []byte("artifact"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sha256Digest := sha256.Sum256([]byte("artifact"))
+	sha512Digest := sha512.Sum512([]byte("artifact"))
+	sha256Hex := hex.EncodeToString(sha256Digest[:])
+	sha512Hex := hex.EncodeToString(sha512Digest[:])
+	otherHex := strings.Repeat("0", 64)
+
+	tests := map[string]struct {
+		digests []map[string]string
+		err     error
+	}{
+		"sha256":           {digests: []map[string]string{{DigestSHA256: sha256Hex}}},
+		"sha512":           {digests: []map[string]string{{DigestSHA512: sha512Hex}}},
+		"uppercase digest": {digests: []map[string]string{{DigestSHA256: strings.ToUpper(sha256Hex)}}},
+		"second subject":   {digests: []map[string]string{{DigestSHA256: otherHex}, {DigestSHA256: sha256Hex}}},
+		"every digest":     {digests: []map[string]string{{DigestSHA256: sha256Hex, DigestSHA512: sha512Hex, "md5": "00"}}},
+		"one digest differs": {
+			digests: []map[string]string{{DigestSHA256: sha256Hex, DigestSHA512: strings.Repeat("0", 128)}},
+			err:     ErrSubjectNotFound,
+		},
+		"different digest":      {digests: []map[string]string{{DigestSHA256: otherHex}}, err: ErrSubjectNotFound},
+		"unsupported algorithm": {digests: []map[string]string{{"md5": "00"}}, err: ErrNoComparableDigest},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			statement := &ita1.Statement{}
+			for i, digest := range test.digests {
+				statement.Subject = append(statement.Subject, &ita1.ResourceDescriptor{Name: string(rune('a' + i)), Digest: digest})
+			}
+
+			subject, err := MatchSubject(statement, path)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("expected %v, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if subject != statement.Subject[len(statement.Subject)-1] {
+				t.Fatalf("unexpected subject %v", subject)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+// Package jws implements the JWS JSON and compact serializations of RFC 7515
+// for signing payloads with the keys used for DSSE envelopes.
+package jws
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Format is a JWS serialization.
+type Format string
+
+const (
+	// FormatJSON is the general JWS JSON serialization, which holds any number
+	// of signatures.
+	FormatJSON Format = "jws"
+	// FormatCompact is the JWS compact serialization, which holds a single
+	// signature.
+	FormatCompact Format = "jws-compact"
+)
+
+// Formats lists the supported JWS serializations.
+var Formats = []Format{FormatJSON, FormatCompact}
+
+var (
+	// ErrNotJWS indicates that data is not a JWS.
+	ErrNotJWS = errors.New("data is not a JWS")
+	// ErrInvalidJWS indicates that a JWS is malformed.
+	ErrInvalidJWS = errors.New("invalid JWS")
+	// ErrUnknownFormat indicates that a JWS serialization is not supported.
+	ErrUnknownFormat = errors.New("unknown JWS format")
+	// ErrCompactSigned indicates that a signature was added to a JWS using the
+	// compact serialization that is already signed.
+	ErrCompactSigned = errors.New("JWS compact serialization can only hold a single signature, use the JSON serialization for multiple signatures")
+)
+
+var compactPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+$`)
+
+/*
+Message is a JWS. The content type header of its signatures records the payload
+type of the equivalent DSSE envelope. The protected headers of parsed
+signatures are kept as they were encoded, as signatures are computed over their
+encoding.
+*/
+type Message struct {
+	Format      Format
+	PayloadType string
+	Payload     []byte
+	Signatures  []Signature
+
+	encodedPayload string
+}
+
+// Signature is a signature of a JWS.
+type Signature struct {
+	Algorithm string
+	KeyID     string
+
+	raw rawSignature
+}
+
+type rawSignature struct {
+	Protected string         `json:"protected,omitempty"`
+	Header    map[string]any `json:"header,omitempty"`
+	Signature string         `json:"signature"`
+}
+
+type rawMessage struct {
+	Payload    *string        `json:"payload"`
+	Signatures []rawSignature `json:"signatures,omitempty"`
+
+	// The flattened JSON serialization holds a single signature's members
+	// at the top level
+	Protected string         `json:"protected,omitempty"`
+	Header    map[string]any `json:"header,omitempty"`
+	Signature string         `json:"signature,omitempty"`
+}
+
+type header struct {
+	Algorithm   string `json:"alg"`
+	KeyID       string `json:"kid,omitempty"`
+	ContentType string `json:"cty,omitempty"`
+	Type        string `json:"typ,omitempty"`
+}
+
+// NewMessage creates an unsigned JWS of the format for the payload.
+func NewMessage(format Format, payloadType string, payload []byte) (*Message, error) {
+	if format != FormatJSON && format != FormatCompact {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownFormat, format)
+	}
+
+	return &Message{
+		Format:         format,
+		PayloadType:    payloadType,
+		Payload:        payload,
+		Signatures:     []Signature{},
+		encodedPayload: base64.RawURLEncoding.EncodeToString(payload),
+	}, nil
+}
+
+// IsJWS returns true if data is a JWS using the compact serialization, or a
+// JSON object with the members of the JWS JSON serialization. DSSE envelopes
+// are not JWS, as they have a payload type.
+func IsJWS(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	if compactPattern.Match(trimmed) {
+		return true
+	}
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return false
+	}
+
+	members := map[string]json.RawMessage{}
+	if err := json.Unmarshal(trimmed, &members); err != nil {
+		return false
+	}
+	_, hasPayload := members["payload"]
+	_, hasPayloadType := members["payloadType"]
+	_, hasSignature := members["signature"]
+	_, hasSignatures := members["signatures"]
+	if !hasPayload || hasPayloadType || !(hasSignature || hasSignatures) {
+		return false
+	}
+	if hasSignature {
+		return true
+	}
+
+	// DSSE signatures have a sig member rather than a signature member
+	signatures := []map[string]json.RawMessage{}
+	if err := json.Unmarshal(members["signatures"], &signatures); err != nil || len(signatures) == 0 {
+		return false
+	}
+	_, isJWSSignature := signatures[0]["signature"]
+	return isJWSSignature
+}
+
+// Marshal encodes the signed JWS. The JSON serialization always uses the
+// general syntax, with a signatures member.
+func Marshal(m *Message) ([]byte, error) {
+	if len(m.Signatures) == 0 {
+		return nil, fmt.Errorf("%w: JWS is not signed", ErrInvalidJWS)
+	}
+
+	switch m.Format {
+	case FormatJSON:
+		raw := rawMessage{Payload: &m.encodedPayload, Signatures: []rawSignature{}}
+		for _, s := range m.Signatures {
+			raw.Signatures = append(raw.Signatures, s.raw)
+		}
+		return json.Marshal(raw)
+	case FormatCompact:
+		s := m.Signatures[0]
+		if len(s.raw.Header) > 0 {
+			return nil, fmt.Errorf("%w: unprotected headers cannot use the compact serialization", ErrInvalidJWS)
+		}
+		return []byte(strings.Join([]string{s.raw.Protected, m.encodedPayload, s.raw.Signature}, ".")), nil
+	}
+
+	return nil, fmt.Errorf("%w: '%s'", ErrUnknownFormat, m.Format)
+}
+
+/*
+Unmarshal decodes a JWS using the compact serialization, or the general or
+flattened JSON serialization. The payload type is read from the content type
+header of the signatures, or their type header if it is not set, which must be
+the same for all signatures. Detached and unencoded payloads are not supported.
+*/
+func Unmarshal(data []byte) (*Message, error) {
+	if !IsJWS(data) {
+		return nil, ErrNotJWS
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	m := &Message{Signatures: []Signature{}}
+	rawSignatures := []rawSignature{}
+	if trimmed[0] != '{' {
+		parts := strings.Split(string(trimmed), ".")
+		m.Format = FormatCompact
+		m.encodedPayload = parts[1]
+		rawSignatures = append(rawSignatures, rawSignature{Protected: parts[0], Signature: parts[2]})
+	} else {
+		raw := rawMessage{}
+		if err := json.Unmarshal(trimmed, &raw); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidJWS, err)
+		}
+		if raw.Payload == nil {
+			return nil, fmt.Errorf("%w: detached payloads are not supported", ErrInvalidJWS)
+		}
+
+		m.Format = FormatJSON
+		m.encodedPayload = *raw.Payload
+		rawSignatures = raw.Signatures
+		if raw.Signature != "" {
+			if len(raw.Signatures) > 0 {
+				return nil, fmt.Errorf("%w: both flattened and general syntax used", ErrInvalidJWS)
+			}
+			rawSignatures = []rawSignature{{Protected: raw.Protected, Header: raw.Header, Signature: raw.Signature}}
+		}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(m.encodedPayload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to decode payload: %w", ErrInvalidJWS, err)
+	}
+	m.Payload = payload
+
+	for i, rawSig := range rawSignatures {
+		h, err := parseHeaders(rawSig)
+		if err != nil {
+			return nil, err
+		}
+
+		payloadType := mediaType(h.ContentType)
+		if payloadType == "" {
+			payloadType = mediaType(h.Type)
+		}
+		if i == 0 {
+			m.PayloadType = payloadType
+		} else if payloadType != m.PayloadType {
+			return nil, fmt.Errorf("%w: signatures declare different content types", ErrInvalidJWS)
+		}
+
+		m.Signatures = append(m.Signatures, Signature{Algorithm: h.Algorithm, KeyID: h.KeyID, raw: rawSig})
+	}
+
+	return m, nil
+}
+
+// parseHeaders merges the protected and unprotected headers of the signature.
+// Protected headers take precedence.
+func parseHeaders(rawSig rawSignature) (*header, error) {
+	h := &header{}
+	if rawSig.Header != nil {
+		unprotected, err := json.Marshal(rawSig.Header)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(unprotected, h); err != nil {
+			return nil, fmt.Errorf("%w: unable to decode header: %w", ErrInvalidJWS, err)
+		}
+	}
+
+	protected, err := base64.RawURLEncoding.DecodeString(rawSig.Protected)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to decode protected header: %w", ErrInvalidJWS, err)
+	}
+	if len(protected) > 0 {
+		protectedHeader := &header{}
+		if err := json.Unmarshal(protected, protectedHeader); err != nil {
+			return nil, fmt.Errorf("%w: unable to decode protected header: %w", ErrInvalidJWS, err)
+		}
+		if protectedHeader.Algorithm != "" {
+			h.Algorithm = protectedHeader.Algorithm
+		}
+		if protectedHeader.KeyID != "" {
+			h.KeyID = protectedHeader.KeyID
+		}
+		if protectedHeader.ContentType != "" {
+			h.ContentType = protectedHeader.ContentType
+		}
+		if protectedHeader.Type != "" {
+			h.Type = protectedHeader.Type
+		}
+	}
+
+	if h.Algorithm == "" {
+		return nil, fmt.Errorf("%w: algorithm is not set", ErrInvalidJWS)
+	}
+	return h, nil
+}
+
+// mediaType expands media types without a slash, which RFC 7515 allows to
+// omit the "application/" prefix.
+func mediaType(value string) string {
+	if value == "" || strings.Contains(value, "/") {
+		return value
+	}
+	return "application/" + value
+}
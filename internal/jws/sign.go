@@ -0,0 +1,133 @@
+package jws
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/go-jose/go-jose/v4"
+)
+
+var (
+	// ErrIncompatibleSigner indicates that a signer cannot create signatures
+	// using standard algorithms.
+	ErrIncompatibleSigner = errors.New("signer cannot create JWS signatures")
+	// ErrUnsupportedAlgorithm indicates that a key uses an algorithm that is
+	// not supported.
+	ErrUnsupportedAlgorithm = errors.New("unsupported JWS algorithm")
+)
+
+// Signer signs JWS using the private key of a DSSE signer.
+type Signer struct {
+	key       any
+	keyID     string
+	algorithm jose.SignatureAlgorithm
+}
+
+// NewSigner creates a JWS signer for the DSSE signer, which must implement
+// dsse.PrivateKeySigner with a key whose algorithm JOSE supports.
+func NewSigner(signer dsse.Signer) (*Signer, error) {
+	privateKeySigner, ok := signer.(dsse.PrivateKeySigner)
+	if !ok {
+		return nil, ErrIncompatibleSigner
+	}
+
+	key, err := privateKeySigner.PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := AlgorithmForKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := signer.KeyID()
+	if err != nil {
+		return nil, err
+	}
+
+	// go-jose expects Ed25519 private keys as values
+	var signingKey any = key
+	if edKey, isPointer := key.(*ed25519.PrivateKey); isPointer {
+		signingKey = *edKey
+	}
+
+	return &Signer{key: signingKey, keyID: keyID, algorithm: algorithm}, nil
+}
+
+// AlgorithmForKey returns the JOSE algorithm used to sign with the public
+// key's private key. ECDSA keys are used with the hash matching their curve,
+// and RSA keys with RSASSA-PKCS1-v1_5 using SHA-256, which JWS consumers
+// support most widely.
+func AlgorithmForKey(pub crypto.PublicKey) (jose.SignatureAlgorithm, error) {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return jose.ES256, nil
+		case elliptic.P384():
+			return jose.ES384, nil
+		case elliptic.P521():
+			return jose.ES512, nil
+		}
+		return "", fmt.Errorf("%w: ECDSA curve %s", ErrUnsupportedAlgorithm, k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return jose.EdDSA, nil
+	case *rsa.PublicKey:
+		return jose.RS256, nil
+	}
+	return "", fmt.Errorf("%w: key type %T", ErrUnsupportedAlgorithm, pub)
+}
+
+// Algorithm returns the algorithm the signer signs with.
+func (s *Signer) Algorithm() jose.SignatureAlgorithm {
+	return s.algorithm
+}
+
+// Sign adds a signature to the JWS. The algorithm, key ID, and payload type,
+// as the content type, are recorded in the signature's protected header.
+func (m *Message) Sign(s *Signer) error {
+	if m.Format == FormatCompact && len(m.Signatures) > 0 {
+		return ErrCompactSigned
+	}
+
+	opts := &jose.SignerOptions{}
+	if s.keyID != "" {
+		opts = opts.WithHeader("kid", s.keyID)
+	}
+	if m.PayloadType != "" {
+		opts = opts.WithContentType(jose.ContentType(m.PayloadType))
+	}
+
+	joseSigner, err := jose.NewSigner(jose.SigningKey{Algorithm: s.algorithm, Key: s.key}, opts)
+	if err != nil {
+		return err
+	}
+	signed, err := joseSigner.Sign(m.Payload)
+	if err != nil {
+		return err
+	}
+	compact, err := signed.CompactSerialize()
+	if err != nil {
+		return err
+	}
+
+	// The payload of parsed messages is kept as it was encoded, which must
+	// match the payload that was signed
+	parts := strings.Split(compact, ".")
+	if parts[1] != m.encodedPayload {
+		return fmt.Errorf("%w: payload is not encoded canonically", ErrInvalidJWS)
+	}
+
+	m.Signatures = append(m.Signatures, Signature{
+		Algorithm: string(s.algorithm),
+		KeyID:     s.keyID,
+		raw:       rawSignature{Protected: parts[0], Signature: parts[2]},
+	})
+	return nil
+}
@@ -0,0 +1,77 @@
+package jws
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/go-jose/go-jose/v4"
+)
+
+// verificationAlgorithms are the algorithms accepted when verifying. Symmetric
+// algorithms are never accepted.
+var verificationAlgorithms = []jose.SignatureAlgorithm{
+	jose.ES256, jose.ES384, jose.ES512, jose.EdDSA, jose.RS256, jose.PS256,
+}
+
+/*
+Verify verifies the JWS's signatures using the public keys of the verifiers,
+which are DSSE verifiers such as those for SSH keys, and returns the keys that
+verified a signature. Like DSSE envelopes, signatures with a key ID are only
+verified using verifiers with the same key ID, and at least threshold verifiers
+must each verify a signature. Verifiers without public keys, such as those for
+Sigstore identities, cannot verify JWS signatures.
+*/
+func Verify(m *Message, threshold int, verifiers ...dsse.Verifier) ([]dsse.AcceptedKey, error) {
+	if threshold <= 0 || threshold > len(verifiers) {
+		return nil, errors.New("invalid threshold")
+	}
+	if len(m.Signatures) == 0 {
+		return nil, dsse.ErrNoSignature
+	}
+
+	acceptedKeys := []dsse.AcceptedKey{}
+	unverified := append([]dsse.Verifier{}, verifiers...)
+	for _, s := range m.Signatures {
+		// Unprotected headers are not signed, so each signature is verified
+		// using its compact serialization
+		compact := strings.Join([]string{s.raw.Protected, m.encodedPayload, s.raw.Signature}, ".")
+		signed, err := jose.ParseSignedCompact(compact, verificationAlgorithms)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidJWS, err)
+		}
+
+		for i, v := range unverified {
+			pub := v.Public()
+			if pub == nil {
+				continue
+			}
+
+			keyID, err := v.KeyID()
+			if err != nil || keyID == "" {
+				keyID, _ = dsse.SHA256KeyID(pub) //nolint:errcheck
+			}
+			if s.KeyID != "" && keyID != "" && s.KeyID != keyID {
+				continue
+			}
+
+			if _, err := signed.Verify(pub); err != nil {
+				continue
+			}
+
+			acceptedKeys = append(acceptedKeys, dsse.AcceptedKey{
+				Public: pub,
+				KeyID:  keyID,
+				Sig:    dsse.Signature{KeyID: s.KeyID},
+			})
+			unverified = append(unverified[:i], unverified[i+1:]...)
+			break
+		}
+	}
+
+	if len(acceptedKeys) < threshold {
+		return acceptedKeys, fmt.Errorf("%w, Found: %d, Expected %d", dsse.ErrThresholdNotMet, len(acceptedKeys), threshold)
+	}
+	return acceptedKeys, nil
+}
@@ -0,0 +1,172 @@
+package key
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"slices"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newPrivateKeys(t *testing.T) map[string]crypto.Signer {
+	t.Helper()
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]crypto.Signer{"ed25519": ed25519Key, "ecdsa": ecdsaKey, "rsa": rsaKey}
+}
+
+func equalPublic(a, b crypto.PublicKey) bool {
+	equal, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && equal.Equal(b)
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	for keyType, private := range newPrivateKeys(t) {
+		k := &Key{Format: FormatPEM, Public: private.Public(), Private: private}
+		ids, err := k.IDs()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, format := range []Format{FormatOpenSSH, FormatPEM, FormatSSLib} {
+			t.Run(keyType+" "+string(format), func(t *testing.T) {
+				contents, err := k.Marshal(format)
+				if err != nil {
+					t.Fatal(err)
+				}
+				parsed, err := Parse(contents)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if parsed.Format != format {
+					t.Fatalf("parsed format %s, expected %s", parsed.Format, format)
+				}
+				if parsed.Private == nil || !equalPublic(parsed.Private.Public(), private.Public()) || !equalPublic(parsed.Public, private.Public()) {
+					t.Fatal("private key was not preserved")
+				}
+				parsedIDs, err := parsed.IDs()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !slices.Equal(parsedIDs, ids) {
+					t.Fatalf("key IDs %v, expected %v", parsedIDs, ids)
+				}
+			})
+		}
+
+		for _, format := range []Format{FormatOpenSSH, FormatRFC4716, FormatPEM, FormatSSLib} {
+			t.Run(keyType+" public "+string(format), func(t *testing.T) {
+				contents, err := k.MarshalPublic(format)
+				if err != nil {
+					t.Fatal(err)
+				}
+				parsed, err := Parse(contents)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if parsed.Format != format {
+					t.Fatalf("parsed format %s, expected %s", parsed.Format, format)
+				}
+				if parsed.Private != nil || !equalPublic(parsed.Public, private.Public()) {
+					t.Fatal("public key was not preserved")
+				}
+			})
+		}
+	}
+}
+
+func TestMarshalComment(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &Key{Format: FormatOpenSSH, Public: private.Public(), Comment: "alice@example.com"}
+
+	contents, err := k.MarshalPublic(FormatOpenSSH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Comment != k.Comment {
+		t.Fatalf("comment '%s', expected '%s'", parsed.Comment, k.Comment)
+	}
+
+	if _, err := k.MarshalPublic(Format("der")); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+func TestMarshalEncrypted(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(private, "", []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := Parse(pem.EncodeToMemory(block))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !k.Encrypted || k.Private != nil || !equalPublic(k.Public, private.Public()) {
+		t.Fatal("expected public portion of encrypted key")
+	}
+
+	// Only RFC 4716, which holds public keys, can be converted to
+	for _, format := range []Format{FormatOpenSSH, FormatPEM, FormatSSLib} {
+		if _, err := k.Marshal(format); !errors.Is(err, ErrNoPrivateKey) {
+			t.Fatalf("expected ErrNoPrivateKey for %s, got %v", format, err)
+		}
+	}
+	contents, err := k.Marshal(FormatRFC4716)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalPublic(parsed.Public, private.Public()) {
+		t.Fatal("public key was not preserved")
+	}
+}
+
+func TestMarshalSigstore(t *testing.T) {
+	k, err := Load(SigstorePrefix + "alice@example.com::https://accounts.google.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Marshal(FormatPEM); !errors.Is(err, ErrNotConvertible) {
+		t.Fatalf("expected ErrNotConvertible, got %v", err)
+	}
+	if _, err := k.MarshalPublic(Format("der")); !errors.Is(err, ErrNotConvertible) {
+		t.Fatalf("expected ErrNotConvertible, got %v", err)
+	}
+
+	for _, spec := range []string{"alice@example.com", "::https://accounts.google.com", "alice@example.com::"} {
+		if _, err := Load(SigstorePrefix + spec); !errors.Is(err, ErrInvalidSigstoreSpec) {
+			t.Fatalf("expected ErrInvalidSigstoreSpec for '%s', got %v", spec, err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package key
+
+import (
+	"time"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/sigstore"
+)
+
+// VerifiedSigner describes a signer whose signature on an envelope was
+// verified.
+type VerifiedSigner struct {
+	KeyID string
+	// Name is how the signer was referred to when verifying, e.g. the name of
+	// the signer in a policy.
+	Name string
+	// Identity and Issuer are only set for Sigstore signers.
+	Identity string
+	Issuer   string
+	// Timestamps are the times the signature was recorded in the transparency
+	// log. They are set for Sigstore signatures, and for other signatures
+	// whose log entries were verified.
+	Timestamps []time.Time
+}
+
+// VerifiedSigners describes the signers of the accepted keys. The verifiers
+// are those used to verify the envelope, each named by the corresponding entry
+// of names.
+func VerifiedSigners(acceptedKeys []dsse.AcceptedKey, verifiers []dsse.Verifier, names []string) ([]VerifiedSigner, error) {
+	known := map[string]VerifiedSigner{}
+	for i, verifier := range verifiers {
+		keyID, err := verifier.KeyID()
+		if err != nil {
+			return nil, err
+		}
+
+		signer := VerifiedSigner{KeyID: keyID, Name: names[i]}
+		if sigstoreVerifier, isSigstore := verifier.(*sigstore.Verifier); isSigstore {
+			signer.Identity = sigstoreVerifier.Identity()
+			signer.Issuer = sigstoreVerifier.Issuer()
+		}
+		known[keyID] = signer
+	}
+
+	signers := []VerifiedSigner{}
+	for _, acceptedKey := range acceptedKeys {
+		signer := known[acceptedKey.KeyID]
+		if signer.Identity != "" {
+			timestamps, err := sigstore.IntegratedTimes(acceptedKey.Sig.Extension)
+			if err != nil {
+				return nil, err
+			}
+			signer.Timestamps = timestamps
+		}
+		signers = append(signers, signer)
+	}
+
+	return signers, nil
+}
@@ -0,0 +1,75 @@
+package key
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/sigstore"
+	essdssh "github.com/adityasaky/essd/internal/ssh"
+	"github.com/secure-systems-lab/go-securesystemslib/signerverifier"
+	"golang.org/x/crypto/ssh"
+)
+
+// SigstoreKeyType is the securesystemslib key type used for Sigstore
+// identities, whose key values record the identity and issuer.
+const SigstoreKeyType = "sigstore-oidc"
+
+// NewVerifier creates a verifier for the specified reference, which is either
+// a Sigstore identity in the form fulcio:<identity>::<issuer> or the path to
+// an SSH key in a format supported by ssh-keygen.
+func NewVerifier(ref string) (dsse.Verifier, error) {
+	ref = strings.TrimSpace(ref)
+	if strings.HasPrefix(ref, SigstorePrefix) {
+		k, err := parseSigstore(strings.TrimPrefix(ref, SigstorePrefix))
+		if err != nil {
+			return nil, err
+		}
+		return sigstore.NewVerifierFromIdentityAndIssuer(k.Identity, k.Issuer), nil
+	}
+
+	sslibKey, err := essdssh.NewKeyFromFile(ref)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load '%s': %w", ref, err)
+	}
+	verifier, err := essdssh.NewVerifierFromKey(sslibKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load '%s': %w", ref, err)
+	}
+	return verifier, nil
+}
+
+// NewVerifierFromSSLib creates a verifier for a key in the securesystemslib
+// format, as used in in-toto layouts. Keys of type sigstore-oidc are verified
+// as Sigstore identities, other keys as SSH keys identified by their SSH
+// fingerprint, matching the key IDs essd records when signing.
+func NewVerifierFromSSLib(sslibKey *signerverifier.SSLibKey) (dsse.Verifier, error) {
+	if sslibKey.KeyType == SigstoreKeyType {
+		if sslibKey.KeyVal.Identity == "" || sslibKey.KeyVal.Issuer == "" {
+			return nil, ErrInvalidSigstoreSpec
+		}
+		return sigstore.NewVerifierFromIdentityAndIssuer(sslibKey.KeyVal.Identity, sslibKey.KeyVal.Issuer), nil
+	}
+
+	contents, err := json.Marshal(sslibKey)
+	if err != nil {
+		return nil, err
+	}
+	k, err := parseSSLib(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	sshKey, err := ssh.NewPublicKey(k.Public)
+	if err != nil {
+		return nil, err
+	}
+	return essdssh.NewVerifierFromKey(&signerverifier.SSLibKey{
+		KeyID:   ssh.FingerprintSHA256(sshKey),
+		KeyType: essdssh.KeyType,
+		Scheme:  sshKey.Type(),
+		KeyVal:  signerverifier.KeyVal{Public: base64.StdEncoding.EncodeToString(sshKey.Marshal())},
+	})
+}
@@ -0,0 +1,264 @@
+// Package layout verifies software supply chains described by in-toto
+// layouts. A layout declares the steps of the supply chain, the functionaries
+// trusted to perform each step, and rules the artifacts consumed and produced
+// by each step must follow. See
+// https://github.com/in-toto/docs/blob/master/in-toto-spec.md.
+package layout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/intoto"
+	ita1 "github.com/in-toto/attestation/go/v1"
+	"github.com/secure-systems-lab/go-securesystemslib/signerverifier"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	LayoutType = "layout"
+	LinkType   = "link"
+	StepType   = "step"
+
+	// LinkPredicateType is the in-toto attestation predicate type for links.
+	LinkPredicateType = "https://in-toto.io/attestation/link/v0.3"
+)
+
+var (
+	ErrInvalidLayout  = errors.New("invalid layout")
+	ErrInvalidLink    = errors.New("invalid link")
+	ErrLayoutNotValid = errors.New("supply chain does not satisfy layout")
+)
+
+// Layout is an in-toto layout.
+type Layout struct {
+	Type    string `json:"_type"`
+	Expires string `json:"expires"`
+	Readme  string `json:"readme,omitempty"`
+	// Keys maps the key IDs of functionaries to their public keys.
+	Keys  map[string]*signerverifier.SSLibKey `json:"keys"`
+	Steps []*Step                             `json:"steps"`
+	// Inspect lists inspections, which essd does not run.
+	Inspect []json.RawMessage `json:"inspect,omitempty"`
+}
+
+// Step is a step of the supply chain.
+type Step struct {
+	Type string `json:"_type"`
+	Name string `json:"name"`
+	// Threshold is the number of functionaries that must provide links for
+	// the step. It defaults to 1.
+	Threshold int `json:"threshold,omitempty"`
+	// PubKeys lists the key IDs of the functionaries trusted to perform the
+	// step.
+	PubKeys           []string   `json:"pubkeys"`
+	ExpectedMaterials [][]string `json:"expected_materials"`
+	ExpectedProducts  [][]string `json:"expected_products"`
+	ExpectedCommand   []string   `json:"expected_command,omitempty"`
+}
+
+// Link records the artifacts a functionary consumed and produced when
+// performing a step. Artifacts are identified by their paths and recorded with
+// their digest sets.
+type Link struct {
+	Name      string
+	Command   []string
+	Materials map[string]map[string]string
+	Products  map[string]map[string]string
+}
+
+// classicLink is the link metadata format of the in-toto specification.
+type classicLink struct {
+	Type      string                       `json:"_type"`
+	Name      string                       `json:"name"`
+	Command   []string                     `json:"command"`
+	Materials map[string]map[string]string `json:"materials"`
+	Products  map[string]map[string]string `json:"products"`
+}
+
+// linkPredicate is the predicate of in-toto link attestations, whose
+// products are recorded as the statement's subjects.
+type linkPredicate struct {
+	Name      string            `json:"name"`
+	Command   []string          `json:"command"`
+	Materials []json.RawMessage `json:"materials"`
+}
+
+// FromEnvelope decodes and validates the layout in the envelope's payload. The
+// envelope's signatures are not verified.
+func FromEnvelope(env *dsse.Envelope) (*Layout, error) {
+	if env.PayloadType != intoto.PayloadType {
+		return nil, fmt.Errorf("%w: unexpected payload type '%s'", ErrInvalidLayout, env.PayloadType)
+	}
+
+	payload, err := env.DecodeB64Payload()
+	if err != nil {
+		return nil, err
+	}
+
+	layout := &Layout{}
+	if err := json.Unmarshal(payload, layout); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidLayout, err)
+	}
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+
+	return layout, nil
+}
+
+// Validate checks that the layout is well formed.
+func (l *Layout) Validate() error {
+	if l.Type != LayoutType {
+		return fmt.Errorf("%w: expected _type '%s', found '%s'", ErrInvalidLayout, LayoutType, l.Type)
+	}
+
+	if _, err := time.Parse(time.RFC3339, l.Expires); err != nil {
+		return fmt.Errorf("%w: expires must be an RFC 3339 timestamp", ErrInvalidLayout)
+	}
+
+	// Verify loads every key, so keys that are not used by steps must also be
+	// well formed
+	for _, keyID := range slices.Sorted(maps.Keys(l.Keys)) {
+		k := l.Keys[keyID]
+		if k == nil {
+			return fmt.Errorf("%w: key '%s' is not set", ErrInvalidLayout, keyID)
+		}
+		if k.KeyID != keyID {
+			return fmt.Errorf("%w: key '%s' records key ID '%s'", ErrInvalidLayout, keyID, k.KeyID)
+		}
+	}
+
+	stepNames := map[string]bool{}
+	for _, step := range l.Steps {
+		if step.Name == "" {
+			return fmt.Errorf("%w: steps must be named", ErrInvalidLayout)
+		}
+		if stepNames[step.Name] {
+			return fmt.Errorf("%w: step '%s' is declared more than once", ErrInvalidLayout, step.Name)
+		}
+		stepNames[step.Name] = true
+	}
+
+	for _, step := range l.Steps {
+		if step.Type != StepType {
+			return fmt.Errorf("%w: step '%s' must have _type '%s'", ErrInvalidLayout, step.Name, StepType)
+		}
+
+		if len(step.PubKeys) == 0 {
+			return fmt.Errorf("%w: no functionaries declared for step '%s'", ErrInvalidLayout, step.Name)
+		}
+		for _, keyID := range step.PubKeys {
+			if _, has := l.Keys[keyID]; !has {
+				return fmt.Errorf("%w: unknown key '%s' for step '%s'", ErrInvalidLayout, keyID, step.Name)
+			}
+		}
+
+		if step.Threshold < 0 || step.Threshold > len(step.PubKeys) {
+			return fmt.Errorf("%w: threshold %d for step '%s' must be between 1 and the number of functionaries", ErrInvalidLayout, step.Threshold, step.Name)
+		}
+
+		for _, rules := range [][][]string{step.ExpectedMaterials, step.ExpectedProducts} {
+			for _, rule := range rules {
+				parsed, err := parseRule(rule)
+				if err != nil {
+					return fmt.Errorf("%w: step '%s': %w", ErrInvalidLayout, step.Name, err)
+				}
+				if parsed.kind == ruleMatch && !stepNames[parsed.dstStep] {
+					return fmt.Errorf("%w: step '%s': rule '%s' refers to unknown step '%s'", ErrInvalidLayout, step.Name, parsed, parsed.dstStep)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// LinkFromEnvelope decodes the link in the envelope's payload, which is either
+// link metadata as defined by the in-toto specification or an in-toto
+// attestation with the link predicate type. The envelope's signatures are not
+// verified.
+func LinkFromEnvelope(env *dsse.Envelope) (*Link, error) {
+	if env.PayloadType != intoto.PayloadType {
+		return nil, fmt.Errorf("%w: unexpected payload type '%s'", ErrInvalidLink, env.PayloadType)
+	}
+
+	payload, err := env.DecodeB64Payload()
+	if err != nil {
+		return nil, err
+	}
+
+	header := struct {
+		Type string `json:"_type"`
+	}{}
+	if err := json.Unmarshal(payload, &header); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidLink, err)
+	}
+
+	if header.Type == LinkType {
+		link := &classicLink{}
+		if err := json.Unmarshal(payload, link); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidLink, err)
+		}
+		if link.Name == "" {
+			return nil, fmt.Errorf("%w: link does not name its step", ErrInvalidLink)
+		}
+		return &Link{
+			Name:      link.Name,
+			Command:   link.Command,
+			Materials: nonNil(link.Materials),
+			Products:  nonNil(link.Products),
+		}, nil
+	}
+
+	statement, err := intoto.StatementFromEnvelope(env)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidLink, err)
+	}
+	if statement.GetPredicateType() != LinkPredicateType {
+		return nil, fmt.Errorf("%w: unexpected predicate type '%s'", ErrInvalidLink, statement.GetPredicateType())
+	}
+
+	predicateBytes, err := protojson.Marshal(statement.GetPredicate())
+	if err != nil {
+		return nil, err
+	}
+	predicate := &linkPredicate{}
+	if err := json.Unmarshal(predicateBytes, predicate); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidLink, err)
+	}
+	if predicate.Name == "" {
+		return nil, fmt.Errorf("%w: link does not name its step", ErrInvalidLink)
+	}
+
+	link := &Link{
+		Name:      predicate.Name,
+		Command:   predicate.Command,
+		Materials: map[string]map[string]string{},
+		Products:  map[string]map[string]string{},
+	}
+	for i, rawMaterial := range predicate.Materials {
+		material := &ita1.ResourceDescriptor{}
+		if err := protojson.Unmarshal(rawMaterial, material); err != nil {
+			return nil, fmt.Errorf("%w: materials[%d]: %w", ErrInvalidLink, i, err)
+		}
+		link.Materials[material.GetName()] = material.GetDigest()
+	}
+	for _, subject := range statement.GetSubject() {
+		link.Products[subject.GetName()] = subject.GetDigest()
+	}
+
+	return link, nil
+}
+
+func nonNil(artifacts map[string]map[string]string) map[string]map[string]string {
+	if artifacts == nil {
+		return map[string]map[string]string{}
+	}
+	return artifacts
+}
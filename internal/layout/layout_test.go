@@ -0,0 +1,61 @@
+package layout
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/intoto"
+)
+
+func TestFromEnvelope(t *testing.T) {
+	tests := map[string]struct {
+		layout string
+		valid  bool
+	}{
+		"valid": {
+			layout: `{"_type":"layout","expires":"2030-01-01T00:00:00Z","keys":{"a":{"keyid":"a","keytype":"ed25519","scheme":"ed25519","keyval":{"public":"00"}}},"steps":[{"_type":"step","name":"build","pubkeys":["a"],"expected_products":[["ALLOW","*"]]}]}`,
+			valid:  true,
+		},
+		"unset key": {
+			layout: `{"_type":"layout","expires":"2030-01-01T00:00:00Z","keys":{"a":null},"steps":[{"_type":"step","name":"build","pubkeys":["a"]}]}`,
+		},
+		"mismatched key ID": {
+			layout: `{"_type":"layout","expires":"2030-01-01T00:00:00Z","keys":{"a":{"keyid":"b","keytype":"ed25519","scheme":"ed25519","keyval":{"public":"00"}}},"steps":[{"_type":"step","name":"build","pubkeys":["a"]}]}`,
+		},
+		"unused unset key": {
+			layout: `{"_type":"layout","expires":"2030-01-01T00:00:00Z","keys":{"a":{"keyid":"a","keytype":"ed25519","scheme":"ed25519","keyval":{"public":"00"}},"b":null},"steps":[{"_type":"step","name":"build","pubkeys":["a"]}]}`,
+		},
+		"unknown key": {
+			layout: `{"_type":"layout","expires":"2030-01-01T00:00:00Z","keys":{},"steps":[{"_type":"step","name":"build","pubkeys":["a"]}]}`,
+		},
+		"threshold above functionaries": {
+			layout: `{"_type":"layout","expires":"2030-01-01T00:00:00Z","keys":{"a":{"keyid":"a","keytype":"ed25519","scheme":"ed25519","keyval":{"public":"00"}}},"steps":[{"_type":"step","name":"build","threshold":2,"pubkeys":["a"]}]}`,
+		},
+		"duplicate step": {
+			layout: `{"_type":"layout","expires":"2030-01-01T00:00:00Z","keys":{"a":{"keyid":"a","keytype":"ed25519","scheme":"ed25519","keyval":{"public":"00"}}},"steps":[{"_type":"step","name":"build","pubkeys":["a"]},{"_type":"step","name":"build","pubkeys":["a"]}]}`,
+		},
+		"match unknown step": {
+			layout: `{"_type":"layout","expires":"2030-01-01T00:00:00Z","keys":{"a":{"keyid":"a","keytype":"ed25519","scheme":"ed25519","keyval":{"public":"00"}}},"steps":[{"_type":"step","name":"build","pubkeys":["a"],"expected_materials":[["MATCH","*","WITH","PRODUCTS","FROM","fetch"]]}]}`,
+		},
+		"invalid expiry": {
+			layout: `{"_type":"layout","expires":"tomorrow","keys":{},"steps":[]}`,
+		},
+		"not a layout": {
+			layout: `{"_type":"link","expires":"2030-01-01T00:00:00Z","keys":{},"steps":[]}`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			env := &dsse.Envelope{PayloadType: intoto.PayloadType, Payload: base64.StdEncoding.EncodeToString([]byte(test.layout))}
+			_, err := FromEnvelope(env)
+			if test.valid && err != nil {
+				t.Fatal(err)
+			}
+			if !test.valid && !errors.Is(err, ErrInvalidLayout) {
+				t.Fatalf("expected ErrInvalidLayout, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package layout
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	ruleMatch    = "MATCH"
+	ruleAllow    = "ALLOW"
+	ruleDisallow = "DISALLOW"
+	ruleRequire  = "REQUIRE"
+	ruleCreate   = "CREATE"
+	ruleDelete   = "DELETE"
+	ruleModify   = "MODIFY"
+
+	artifactMaterials = "MATERIALS"
+	artifactProducts  = "PRODUCTS"
+)
+
+var ErrInvalidRule = errors.New("invalid artifact rule")
+
+// artifactRule is a parsed artifact rule. Rules take one of the forms:
+//
+//	MATCH <pattern> [IN <prefix>] WITH (MATERIALS|PRODUCTS) [IN <prefix>] FROM <step>
+//	(ALLOW|DISALLOW|REQUIRE|CREATE|DELETE|MODIFY) <pattern>
+type artifactRule struct {
+	kind    string
+	pattern string
+
+	// The remaining fields are only set for MATCH rules.
+	srcPrefix string
+	dstType   string
+	dstPrefix string
+	dstStep   string
+
+	raw []string
+}
+
+func (r *artifactRule) String() string {
+	return strings.Join(r.raw, " ")
+}
+
+func parseRule(rule []string) (*artifactRule, error) {
+	if len(rule) == 0 {
+		return nil, fmt.Errorf("%w: empty rule", ErrInvalidRule)
+	}
+
+	parsed := &artifactRule{kind: strings.ToUpper(rule[0]), raw: rule}
+	switch parsed.kind {
+	case ruleAllow, ruleDisallow, ruleRequire, ruleCreate, ruleDelete, ruleModify:
+		if len(rule) != 2 {
+			return nil, fmt.Errorf("%w '%s': expected %s <pattern>", ErrInvalidRule, parsed, parsed.kind)
+		}
+		parsed.pattern = rule[1]
+		return parsed, nil
+
+	case ruleMatch:
+		usage := fmt.Errorf("%w '%s': expected MATCH <pattern> [IN <prefix>] WITH (MATERIALS|PRODUCTS) [IN <prefix>] FROM <step>", ErrInvalidRule, parsed)
+
+		tokens := rule[1:]
+		next := func() (string, bool) {
+			if len(tokens) == 0 {
+				return "", false
+			}
+			token := tokens[0]
+			tokens = tokens[1:]
+			return token, true
+		}
+		keyword := func(expected string) bool {
+			if len(tokens) > 0 && strings.ToUpper(tokens[0]) == expected {
+				tokens = tokens[1:]
+				return true
+			}
+			return false
+		}
+
+		var ok bool
+		if parsed.pattern, ok = next(); !ok {
+			return nil, usage
+		}
+		if keyword("IN") {
+			if parsed.srcPrefix, ok = next(); !ok {
+				return nil, usage
+			}
+		}
+		if !keyword("WITH") {
+			return nil, usage
+		}
+		dstType, ok := next()
+		parsed.dstType = strings.ToUpper(dstType)
+		if !ok || (parsed.dstType != artifactMaterials && parsed.dstType != artifactProducts) {
+			return nil, usage
+		}
+		if keyword("IN") {
+			if parsed.dstPrefix, ok = next(); !ok {
+				return nil, usage
+			}
+		}
+		if !keyword("FROM") {
+			return nil, usage
+		}
+		if parsed.dstStep, ok = next(); !ok || len(tokens) != 0 {
+			return nil, usage
+		}
+		return parsed, nil
+
+	default:
+		return nil, fmt.Errorf("%w '%s': unknown rule type '%s'", ErrInvalidRule, parsed, rule[0])
+	}
+}
+
+// applyRules checks the artifacts of a step's link against its artifact rules.
+// Rules are applied in order, each consuming the artifacts it matches from a
+// queue; artifacts that remain once all rules are applied are allowed. The
+// links of the layout's steps are used to resolve MATCH rules.
+func applyRules(rules [][]string, artifacts map[string]map[string]string, link *Link, links map[string]*Link) error {
+	queue := map[string]bool{}
+	for path := range artifacts {
+		queue[path] = true
+	}
+
+	for _, rawRule := range rules {
+		rule, err := parseRule(rawRule)
+		if err != nil {
+			return err
+		}
+
+		matcher, err := compilePattern(rule.pattern)
+		if err != nil {
+			return fmt.Errorf("%w '%s': %w", ErrInvalidRule, rule, err)
+		}
+
+		consumed := []string{}
+		switch rule.kind {
+		case ruleRequire:
+			// Artifacts consumed by earlier rules do not satisfy the rule,
+			// which does not consume the artifacts it matches
+			if !slices.ContainsFunc(slices.Collect(maps.Keys(queue)), matcher.MatchString) {
+				return fmt.Errorf("no artifact required by rule '%s' remains", rule)
+			}
+			continue
+
+		case ruleMatch:
+			consumed = matchArtifacts(rule, matcher, queue, artifacts, links)
+
+		default:
+			for _, path := range slices.Sorted(maps.Keys(queue)) {
+				if !matcher.MatchString(path) {
+					continue
+				}
+
+				material, isMaterial := link.Materials[path]
+				product, isProduct := link.Products[path]
+				switch rule.kind {
+				case ruleDisallow:
+					return fmt.Errorf("artifact '%s' disallowed by rule '%s'", path, rule)
+				case ruleCreate:
+					if isMaterial || !isProduct {
+						continue
+					}
+				case ruleDelete:
+					if !isMaterial || isProduct {
+						continue
+					}
+				case ruleModify:
+					if !isMaterial || !isProduct || maps.Equal(material, product) {
+						continue
+					}
+				}
+				consumed = append(consumed, path)
+			}
+		}
+
+		for _, path := range consumed {
+			delete(queue, path)
+		}
+	}
+
+	return nil
+}
+
+// matchArtifacts returns the artifacts in the queue matched by the MATCH rule,
+// i.e. those with identical digests in the destination step's link.
+func matchArtifacts(rule *artifactRule, matcher *regexp.Regexp, queue map[string]bool, artifacts map[string]map[string]string, links map[string]*Link) []string {
+	dstLink, has := links[rule.dstStep]
+	if !has {
+		return nil
+	}
+	dstArtifacts := dstLink.Materials
+	if rule.dstType == artifactProducts {
+		dstArtifacts = dstLink.Products
+	}
+
+	srcPrefix := normalizePrefix(rule.srcPrefix)
+	dstPrefix := normalizePrefix(rule.dstPrefix)
+
+	consumed := []string{}
+	for _, path := range slices.Sorted(maps.Keys(queue)) {
+		if !strings.HasPrefix(path, srcPrefix) {
+			continue
+		}
+		relativePath := strings.TrimPrefix(path, srcPrefix)
+		if !matcher.MatchString(relativePath) {
+			continue
+		}
+
+		dstDigests, has := dstArtifacts[dstPrefix+relativePath]
+		if !has || !maps.Equal(artifacts[path], dstDigests) {
+			continue
+		}
+		consumed = append(consumed, path)
+	}
+
+	return consumed
+}
+
+func normalizePrefix(prefix string) string {
+	if prefix == "" || strings.HasSuffix(prefix, "/") {
+		return prefix
+	}
+	return prefix + "/"
+}
+
+// compilePattern translates a shell style pattern, as used by in-toto, into a
+// regular expression. Unlike path.Match, wildcards also match path separators.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end == -1 {
+				expr.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			set := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(set, "!") {
+				set = "^" + set[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(set, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
@@ -0,0 +1,115 @@
+package layout
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestApplyRules(t *testing.T) {
+	original := map[string]string{"sha256": "1111"}
+	changed := map[string]string{"sha256": "2222"}
+
+	// unchanged is kept, modified is changed, deleted is removed and created
+	// is added by the step
+	link := &Link{
+		Name: "build",
+		Materials: map[string]map[string]string{
+			"unchanged": original,
+			"modified":  original,
+			"deleted":   original,
+		},
+		Products: map[string]map[string]string{
+			"unchanged":   original,
+			"modified":    changed,
+			"created":     original,
+			"src/lib/a.c": original,
+		},
+	}
+	links := map[string]*Link{
+		"build": link,
+		"fetch": {
+			Name:      "fetch",
+			Materials: map[string]map[string]string{},
+			Products: map[string]map[string]string{
+				"vendor/unchanged": original,
+				"vendor/modified":  changed,
+				"vendor/lib/a.c":   original,
+			},
+		},
+	}
+
+	tests := map[string]struct {
+		rules     [][]string
+		materials bool
+		valid     bool
+	}{
+		"no rules":                {valid: true},
+		"allow":                   {rules: [][]string{{"ALLOW", "*"}}, valid: true},
+		"disallow":                {rules: [][]string{{"DISALLOW", "*"}}},
+		"disallow unmatched":      {rules: [][]string{{"DISALLOW", "missing"}}, valid: true},
+		"allow then disallow":     {rules: [][]string{{"ALLOW", "*"}, {"DISALLOW", "*"}}, valid: true},
+		"disallow glob":           {rules: [][]string{{"ALLOW", "unchanged"}, {"DISALLOW", "*ed"}}},
+		"wildcard spans dirs":     {rules: [][]string{{"ALLOW", "src/*"}, {"ALLOW", "?n*"}, {"ALLOW", "[cm]*"}, {"DISALLOW", "*"}}, valid: true},
+		"negated character class": {rules: [][]string{{"ALLOW", "[!u]*"}, {"DISALLOW", "*"}}},
+		"case insensitive kind":   {rules: [][]string{{"allow", "*"}, {"disallow", "*"}}, valid: true},
+
+		"create":              {rules: [][]string{{"CREATE", "created"}, {"CREATE", "src/*"}, {"MODIFY", "modified"}, {"ALLOW", "unchanged"}, {"DISALLOW", "*"}}, valid: true},
+		"create only created": {rules: [][]string{{"CREATE", "*"}, {"DISALLOW", "*"}}},
+		"modify only changed": {rules: [][]string{{"MODIFY", "*"}, {"DISALLOW", "modified"}}, valid: true},
+		"modify unchanged":    {rules: [][]string{{"MODIFY", "unchanged"}, {"DISALLOW", "unchanged"}}},
+		"delete":              {rules: [][]string{{"DELETE", "deleted"}, {"ALLOW", "*modified"}, {"ALLOW", "unchanged"}, {"DISALLOW", "*"}}, materials: true, valid: true},
+		"delete only deleted": {rules: [][]string{{"DELETE", "*"}, {"DISALLOW", "unchanged"}}, materials: true},
+
+		"require":                  {rules: [][]string{{"REQUIRE", "created"}}, valid: true},
+		"require glob":             {rules: [][]string{{"REQUIRE", "src/*.c"}}, valid: true},
+		"require missing":          {rules: [][]string{{"REQUIRE", "deleted"}}},
+		"require consumed":         {rules: [][]string{{"ALLOW", "created"}, {"REQUIRE", "created"}}},
+		"require does not consume": {rules: [][]string{{"REQUIRE", "created"}, {"DISALLOW", "created"}}},
+
+		"match":                   {rules: [][]string{{"MATCH", "unchanged", "WITH", "PRODUCTS", "IN", "vendor", "FROM", "fetch"}, {"DISALLOW", "unchanged"}}, materials: true, valid: true},
+		"match different digests": {rules: [][]string{{"MATCH", "*", "WITH", "PRODUCTS", "IN", "vendor", "FROM", "fetch"}, {"DISALLOW", "modified"}}, materials: true},
+		"match missing artifact":  {rules: [][]string{{"MATCH", "*", "WITH", "PRODUCTS", "IN", "vendor", "FROM", "fetch"}, {"DISALLOW", "deleted"}}, materials: true},
+		"match with prefix":       {rules: [][]string{{"MATCH", "*", "IN", "src", "WITH", "PRODUCTS", "IN", "vendor", "FROM", "fetch"}, {"DISALLOW", "src/*"}}, valid: true},
+		"match step without link": {rules: [][]string{{"MATCH", "*", "WITH", "PRODUCTS", "FROM", "test"}, {"DISALLOW", "*"}}, materials: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			artifacts := link.Products
+			if test.materials {
+				artifacts = link.Materials
+			}
+			err := applyRules(test.rules, artifacts, link, links)
+			if test.valid && err != nil {
+				t.Fatal(err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("expected rules to reject artifacts")
+			}
+		})
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	for _, rule := range [][]string{
+		{},
+		{"ALLOW"},
+		{"ALLOW", "a", "b"},
+		{"PERMIT", "a"},
+		{"MATCH", "a", "FROM", "build"},
+		{"MATCH", "a", "WITH", "ARTIFACTS", "FROM", "build"},
+		{"MATCH", "a", "WITH", "PRODUCTS", "FROM"},
+		{"MATCH", "a", "WITH", "PRODUCTS", "FROM", "build", "extra"},
+	} {
+		if _, err := parseRule(rule); !errors.Is(err, ErrInvalidRule) {
+			t.Fatalf("expected ErrInvalidRule for %v, got %v", rule, err)
+		}
+	}
+
+	rule, err := parseRule([]string{"match", "*", "IN", "src", "with", "materials", "IN", "dst", "from", "build"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.kind != ruleMatch || rule.pattern != "*" || rule.srcPrefix != "src" || rule.dstType != artifactMaterials || rule.dstPrefix != "dst" || rule.dstStep != "build" {
+		t.Fatalf("unexpected rule %+v", rule)
+	}
+}
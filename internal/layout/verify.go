@@ -0,0 +1,239 @@
+package layout
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/key"
+)
+
+const (
+	RuleExpires           = "expires"
+	RuleInspections       = "inspections"
+	RuleThreshold         = "threshold"
+	RuleConsistency       = "consistency"
+	RuleExpectedMaterials = "expected-materials"
+	RuleExpectedProducts  = "expected-products"
+)
+
+// Report records the outcome of verifying a supply chain against a layout.
+type Report struct {
+	// Checks are the checks that apply to the layout as a whole.
+	Checks []Check
+	Steps  []*StepReport
+}
+
+// StepReport records the outcome of verifying a step of the layout.
+type StepReport struct {
+	Name   string
+	Checks []Check
+	// Functionaries lists the key IDs of the functionaries whose links for the
+	// step were verified.
+	Functionaries []string
+}
+
+// Check is the outcome of evaluating a single rule of the layout.
+type Check struct {
+	Rule    string
+	Passed  bool
+	Message string
+}
+
+// Passed indicates if every check of the layout and its steps passed.
+func (r *Report) Passed() bool {
+	return r.Err() == nil
+}
+
+// Err returns an error describing the failed checks, if any.
+func (r *Report) Err() error {
+	failed := []string{}
+	for _, check := range r.Checks {
+		if !check.Passed {
+			failed = append(failed, fmt.Sprintf("%s: %s", check.Rule, check.Message))
+		}
+	}
+	for _, step := range r.Steps {
+		for _, check := range step.Checks {
+			if !check.Passed {
+				failed = append(failed, fmt.Sprintf("step '%s': %s: %s", step.Name, check.Rule, check.Message))
+			}
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrLayoutNotValid, strings.Join(failed, "; "))
+}
+
+func addCheck(checks *[]Check, rule string, passed bool, format string, a ...any) {
+	*checks = append(*checks, Check{Rule: rule, Passed: passed, Message: fmt.Sprintf(format, a...)})
+}
+
+// Verify verifies the links, provided as signed envelopes, against the layout.
+// Envelopes whose signatures cannot be verified using the keys of the
+// functionaries of their step are disregarded. An error is returned only if
+// verification could not be performed; whether the supply chain satisfies the
+// layout is recorded in the report.
+func (l *Layout) Verify(ctx context.Context, envelopes []*dsse.Envelope) (*Report, error) {
+	report := &Report{}
+
+	// Validate ensures the layout's expiry is well formed
+	expires, _ := time.Parse(time.RFC3339, l.Expires) //nolint:errcheck
+	if time.Now().After(expires) {
+		addCheck(&report.Checks, RuleExpires, false, "layout expired on %s", l.Expires)
+	} else {
+		addCheck(&report.Checks, RuleExpires, true, "layout expires on %s", l.Expires)
+	}
+
+	if len(l.Inspect) > 0 {
+		addCheck(&report.Checks, RuleInspections, false, "layout declares %d inspections, which are not supported", len(l.Inspect))
+	}
+
+	verifiers := map[string]dsse.Verifier{}
+	// functionaries maps the key IDs of verifiers to the key IDs the layout
+	// uses for the functionaries
+	functionaries := map[string]string{}
+	for _, keyID := range slices.Sorted(maps.Keys(l.Keys)) {
+		verifier, err := key.NewVerifierFromSSLib(l.Keys[keyID])
+		if err != nil {
+			return nil, fmt.Errorf("unable to load layout key '%s': %w", keyID, err)
+		}
+		verifierKeyID, err := verifier.KeyID()
+		if err != nil {
+			return nil, err
+		}
+		verifiers[keyID] = verifier
+		functionaries[verifierKeyID] = keyID
+	}
+
+	linkEnvelopes := map[string][]*dsse.Envelope{}
+	links := map[string]*Link{}
+	for _, env := range envelopes {
+		link, err := LinkFromEnvelope(env)
+		if err != nil {
+			slog.Debug("Skipping envelope that is not a link", slog.Any("error", err))
+			continue
+		}
+		linkEnvelopes[link.Name] = append(linkEnvelopes[link.Name], env)
+	}
+
+	stepReports := map[string]*StepReport{}
+	for _, step := range l.Steps {
+		stepReport := &StepReport{Name: step.Name}
+		report.Steps = append(report.Steps, stepReport)
+		stepReports[step.Name] = stepReport
+
+		link, err := verifyStep(ctx, step, linkEnvelopes[step.Name], verifiers, functionaries, stepReport)
+		if err != nil {
+			return nil, err
+		}
+		if link != nil {
+			links[step.Name] = link
+		}
+	}
+
+	for _, step := range l.Steps {
+		link, verified := links[step.Name]
+		if !verified {
+			continue
+		}
+		stepReport := stepReports[step.Name]
+
+		if len(step.ExpectedCommand) > 0 && !slices.Equal(step.ExpectedCommand, link.Command) {
+			slog.Warn("Command for step does not match expected command", slog.String("step", step.Name), slog.String("expected", strings.Join(step.ExpectedCommand, " ")), slog.String("found", strings.Join(link.Command, " ")))
+		}
+
+		if err := applyRules(step.ExpectedMaterials, link.Materials, link, links); err != nil {
+			addCheck(&stepReport.Checks, RuleExpectedMaterials, false, "%s", err)
+		} else {
+			addCheck(&stepReport.Checks, RuleExpectedMaterials, true, "%d materials satisfy %d rules", len(link.Materials), len(step.ExpectedMaterials))
+		}
+
+		if err := applyRules(step.ExpectedProducts, link.Products, link, links); err != nil {
+			addCheck(&stepReport.Checks, RuleExpectedProducts, false, "%s", err)
+		} else {
+			addCheck(&stepReport.Checks, RuleExpectedProducts, true, "%d products satisfy %d rules", len(link.Products), len(step.ExpectedProducts))
+		}
+	}
+
+	return report, nil
+}
+
+// verifyStep verifies the link envelopes for the step, and checks that enough
+// functionaries provided links that agree with each other. The link is
+// returned if the step's threshold is met.
+func verifyStep(ctx context.Context, step *Step, envelopes []*dsse.Envelope, verifiers map[string]dsse.Verifier, functionaries map[string]string, stepReport *StepReport) (*Link, error) {
+	threshold := step.Threshold
+	if threshold == 0 {
+		threshold = 1
+	}
+
+	stepVerifiers := []dsse.Verifier{}
+	for _, keyID := range step.PubKeys {
+		stepVerifiers = append(stepVerifiers, verifiers[keyID])
+	}
+	envVerifier, err := dsse.NewMultiEnvelopeVerifier(1, stepVerifiers...)
+	if err != nil {
+		return nil, err
+	}
+
+	verifiedLinks := map[string]*Link{}
+	for _, env := range envelopes {
+		acceptedKeys, err := envVerifier.Verify(ctx, env)
+		if err != nil {
+			slog.Debug("Skipping link for step that is not signed by its functionaries", slog.String("step", step.Name), slog.Any("error", err))
+			continue
+		}
+
+		// The envelope was decoded as a link before verifying it
+		link, _ := LinkFromEnvelope(env) //nolint:errcheck
+		for _, acceptedKey := range acceptedKeys {
+			functionary := functionaries[acceptedKey.KeyID]
+			if _, seen := verifiedLinks[functionary]; !seen {
+				verifiedLinks[functionary] = link
+			}
+		}
+	}
+
+	stepReport.Functionaries = slices.Sorted(maps.Keys(verifiedLinks))
+	if len(verifiedLinks) < threshold {
+		addCheck(&stepReport.Checks, RuleThreshold, false, "%d of %d required functionaries provided links (verified: %s)", len(verifiedLinks), threshold, formatKeyIDs(stepReport.Functionaries))
+		return nil, nil
+	}
+	addCheck(&stepReport.Checks, RuleThreshold, true, "%d of %d required functionaries provided links (verified: %s)", len(verifiedLinks), threshold, formatKeyIDs(stepReport.Functionaries))
+
+	// Links of different functionaries must record the same artifacts for
+	// their artifacts to be checked as one
+	link := verifiedLinks[stepReport.Functionaries[0]]
+	for _, functionary := range stepReport.Functionaries[1:] {
+		other := verifiedLinks[functionary]
+		if !artifactsEqual(link.Materials, other.Materials) || !artifactsEqual(link.Products, other.Products) {
+			addCheck(&stepReport.Checks, RuleConsistency, false, "links of %s and %s record different artifacts", stepReport.Functionaries[0], functionary)
+			return nil, nil
+		}
+	}
+	if len(stepReport.Functionaries) > 1 {
+		addCheck(&stepReport.Checks, RuleConsistency, true, "links of %d functionaries record the same artifacts", len(stepReport.Functionaries))
+	}
+
+	return link, nil
+}
+
+func artifactsEqual(a, b map[string]map[string]string) bool {
+	return maps.EqualFunc(a, b, func(x, y map[string]string) bool {
+		return maps.Equal(x, y)
+	})
+}
+
+func formatKeyIDs(keyIDs []string) string {
+	if len(keyIDs) == 0 {
+		return "none"
+	}
+	return strings.Join(keyIDs, ", ")
+}
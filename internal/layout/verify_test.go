@@ -0,0 +1,177 @@
+package layout
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/intoto"
+	essdssh "github.com/adityasaky/essd/internal/ssh"
+	"github.com/secure-systems-lab/go-securesystemslib/signerverifier"
+)
+
+// signLink returns an envelope of the classic link for the step, signed by
+// the signer.
+func signLink(t *testing.T, signer *essdssh.Signer, name string, materials, products map[string]map[string]string) *dsse.Envelope {
+	t.Helper()
+	payload, err := json.Marshal(&classicLink{Type: LinkType, Name: name, Materials: materials, Products: products})
+	if err != nil {
+		t.Fatal(err)
+	}
+	envSigner, err := dsse.NewEnvelopeSigner(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := envSigner.SignPayload(context.Background(), intoto.PayloadType, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	alice := essdssh.NewSignerForTest(t, dir, "alice")
+	bob := essdssh.NewSignerForTest(t, dir, "bob")
+	carol := essdssh.NewSignerForTest(t, dir, "carol")
+	aliceKey := alice.MetadataKey()
+	bobKey := bob.MetadataKey()
+
+	source := map[string]map[string]string{"main.go": {"sha256": "1111"}}
+	app := map[string]map[string]string{"app": {"sha256": "2222"}}
+	otherApp := map[string]map[string]string{"app": {"sha256": "3333"}}
+	archive := map[string]map[string]string{"app.tar": {"sha256": "4444"}}
+
+	layout := func(expires time.Time) *Layout {
+		return &Layout{
+			Type:    LayoutType,
+			Expires: expires.UTC().Format(time.RFC3339),
+			Keys:    map[string]*signerverifier.SSLibKey{aliceKey.KeyID: aliceKey, bobKey.KeyID: bobKey},
+			Steps: []*Step{
+				{
+					Type:              StepType,
+					Name:              "build",
+					Threshold:         2,
+					PubKeys:           []string{aliceKey.KeyID, bobKey.KeyID},
+					ExpectedMaterials: [][]string{{"ALLOW", "*.go"}, {"DISALLOW", "*"}},
+					ExpectedProducts:  [][]string{{"CREATE", "app"}, {"DISALLOW", "*"}},
+				},
+				{
+					Type:              StepType,
+					Name:              "package",
+					PubKeys:           []string{aliceKey.KeyID},
+					ExpectedMaterials: [][]string{{"MATCH", "app", "WITH", "PRODUCTS", "FROM", "build"}, {"DISALLOW", "*"}},
+					ExpectedProducts:  [][]string{{"CREATE", "app.tar"}, {"DISALLOW", "*"}},
+				},
+			},
+		}
+	}
+	valid := layout(time.Now().Add(time.Hour))
+	if err := valid.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		layout    *Layout
+		envelopes []*dsse.Envelope
+		// failed is the rule of the first failed check, if any
+		failed string
+	}{
+		"valid": {
+			layout: valid,
+			envelopes: []*dsse.Envelope{
+				signLink(t, alice, "build", source, app),
+				signLink(t, bob, "build", source, app),
+				signLink(t, alice, "package", app, archive),
+			},
+		},
+		"expired": {
+			layout: layout(time.Now().Add(-time.Hour)),
+			envelopes: []*dsse.Envelope{
+				signLink(t, alice, "build", source, app),
+				signLink(t, bob, "build", source, app),
+				signLink(t, alice, "package", app, archive),
+			},
+			failed: RuleExpires,
+		},
+		"threshold not met": {
+			layout: valid,
+			envelopes: []*dsse.Envelope{
+				signLink(t, alice, "build", source, app),
+				signLink(t, alice, "build", source, app),
+				signLink(t, alice, "package", app, archive),
+			},
+			failed: RuleThreshold,
+		},
+		"link of other signer": {
+			layout: valid,
+			envelopes: []*dsse.Envelope{
+				signLink(t, alice, "build", source, app),
+				signLink(t, carol, "build", source, app),
+				signLink(t, alice, "package", app, archive),
+			},
+			failed: RuleThreshold,
+		},
+		"links disagree": {
+			layout: valid,
+			envelopes: []*dsse.Envelope{
+				signLink(t, alice, "build", source, app),
+				signLink(t, bob, "build", source, otherApp),
+				signLink(t, alice, "package", app, archive),
+			},
+			failed: RuleConsistency,
+		},
+		"unexpected product": {
+			layout: valid,
+			envelopes: []*dsse.Envelope{
+				signLink(t, alice, "build", source, app),
+				signLink(t, bob, "build", source, app),
+				signLink(t, alice, "package", app, map[string]map[string]string{"app.tar": {"sha256": "4444"}, "app.zip": {"sha256": "5555"}}),
+			},
+			failed: RuleExpectedProducts,
+		},
+		"material does not match": {
+			layout: valid,
+			envelopes: []*dsse.Envelope{
+				signLink(t, alice, "build", source, app),
+				signLink(t, bob, "build", source, app),
+				signLink(t, alice, "package", otherApp, archive),
+			},
+			failed: RuleExpectedMaterials,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			report, err := test.layout.Verify(context.Background(), test.envelopes)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			failed := []string{}
+			for _, check := range report.Checks {
+				if !check.Passed {
+					failed = append(failed, check.Rule)
+				}
+			}
+			for _, step := range report.Steps {
+				for _, check := range step.Checks {
+					if !check.Passed {
+						failed = append(failed, check.Rule)
+					}
+				}
+			}
+
+			if test.failed == "" {
+				if err := report.Err(); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if len(failed) == 0 || failed[0] != test.failed {
+				t.Fatalf("expected %s check to fail, failed checks: %v", test.failed, failed)
+			}
+		})
+	}
+}
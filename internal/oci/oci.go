@@ -0,0 +1,229 @@
+// Package oci attaches DSSE envelopes to artifacts in OCI registries and
+// discovers them. Envelopes are pushed as OCI artifacts whose subject is the
+// artifact they are attached to, and discovered using the referrers API. For
+// registries that do not support the referrers API, the referrers tag schema
+// is used instead. See
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md#listing-referrers.
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/intoto"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// ArtifactType is the artifact type of the OCI artifacts envelopes are pushed
+// as, and the media type of the layer holding the envelope.
+const ArtifactType = "application/vnd.dsse.envelope.v1+json"
+
+var (
+	ErrSubjectMismatch = errors.New("artifact's subject does not match the referenced artifact")
+	ErrNoEnvelope      = errors.New("artifact does not contain an envelope")
+	ErrSubjectNotFound = errors.New("no subject of the statement matches the artifact")
+	ErrNotStatement    = errors.New("payload is not an in-toto statement, so it is not bound to the artifact")
+)
+
+// Client interacts with OCI registries, authenticating using the credentials
+// configured for docker and other container tools.
+type Client struct {
+	nameOptions   []name.Option
+	remoteOptions []remote.Option
+}
+
+// NewClient creates a client. If insecure is set, registries can be accessed
+// over plain HTTP.
+func NewClient(ctx context.Context, insecure bool) *Client {
+	c := &Client{
+		remoteOptions: []remote.Option{
+			remote.WithContext(ctx),
+			remote.WithAuthFromKeychain(authn.DefaultKeychain),
+		},
+	}
+	if insecure {
+		c.nameOptions = append(c.nameOptions, name.Insecure)
+	}
+	return c
+}
+
+// Attached is an envelope attached to an artifact.
+type Attached struct {
+	// Digest is the digest of the OCI artifact holding the envelope.
+	Digest   name.Digest
+	Envelope *dsse.Envelope
+	// Err records why the envelope could not be fetched, in which case
+	// Envelope is nil.
+	Err error
+}
+
+// Resolve returns the digest of the artifact the reference refers to.
+func (c *Client) Resolve(ref string) (name.Digest, error) {
+	parsedRef, err := name.ParseReference(ref, c.nameOptions...)
+	if err != nil {
+		return name.Digest{}, err
+	}
+
+	descriptor, err := remote.Head(parsedRef, c.remoteOptions...)
+	if err != nil {
+		return name.Digest{}, err
+	}
+
+	return parsedRef.Context().Digest(descriptor.Digest.String()), nil
+}
+
+// Attach pushes the envelope as an OCI artifact whose subject is the artifact
+// the reference refers to, and returns the digest of the pushed artifact.
+func (c *Client) Attach(ref string, env *dsse.Envelope) (name.Digest, error) {
+	parsedRef, err := name.ParseReference(ref, c.nameOptions...)
+	if err != nil {
+		return name.Digest{}, err
+	}
+
+	subject, err := remote.Head(parsedRef, c.remoteOptions...)
+	if err != nil {
+		return name.Digest{}, err
+	}
+
+	envBytes, err := json.Marshal(env)
+	if err != nil {
+		return name.Digest{}, err
+	}
+
+	// The config's media type is reported as the artifact type
+	artifact, err := mutate.Append(empty.Image, mutate.Addendum{Layer: static.NewLayer(envBytes, ArtifactType)})
+	if err != nil {
+		return name.Digest{}, err
+	}
+	artifact = mutate.MediaType(artifact, types.OCIManifestSchema1)
+	artifact = mutate.ConfigMediaType(artifact, ArtifactType)
+	artifact = mutate.Subject(artifact, v1.Descriptor{
+		MediaType: subject.MediaType,
+		Size:      subject.Size,
+		Digest:    subject.Digest,
+	}).(v1.Image)
+
+	artifactDigest, err := artifact.Digest()
+	if err != nil {
+		return name.Digest{}, err
+	}
+	artifactRef := parsedRef.Context().Digest(artifactDigest.String())
+
+	// Registries that do not support the referrers API have the referrers tag
+	// for the subject updated
+	if err := remote.Write(artifactRef, artifact, c.remoteOptions...); err != nil {
+		return name.Digest{}, err
+	}
+
+	return artifactRef, nil
+}
+
+// Envelopes discovers the envelopes attached to the artifact with the digest.
+// Each artifact's subject is checked to be the artifact with the digest.
+// Artifacts whose envelopes cannot be fetched are returned with the error, so
+// that one malformed artifact does not prevent the others from being used.
+func (c *Client) Envelopes(subject name.Digest) ([]*Attached, error) {
+	referrers, err := remote.Referrers(subject, append(c.remoteOptions, remote.WithFilter("artifactType", ArtifactType))...)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := referrers.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	attached := []*Attached{}
+	for _, descriptor := range manifest.Manifests {
+		artifactRef := subject.Context().Digest(descriptor.Digest.String())
+		env, err := c.fetchEnvelope(artifactRef, subject)
+		if err != nil {
+			attached = append(attached, &Attached{Digest: artifactRef, Err: fmt.Errorf("unable to fetch envelope: %w", err)})
+			continue
+		}
+		attached = append(attached, &Attached{Digest: artifactRef, Envelope: env})
+	}
+
+	return attached, nil
+}
+
+func (c *Client) fetchEnvelope(artifactRef, subject name.Digest) (*dsse.Envelope, error) {
+	artifact, err := remote.Image(artifactRef, c.remoteOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := artifact.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Subject == nil || manifest.Subject.Digest.String() != subject.DigestStr() {
+		return nil, ErrSubjectMismatch
+	}
+
+	layers, err := artifact.Layers()
+	if err != nil {
+		return nil, err
+	}
+	for _, layer := range layers {
+		mediaType, err := layer.MediaType()
+		if err != nil {
+			return nil, err
+		}
+		if mediaType != ArtifactType {
+			continue
+		}
+
+		contents, err := layer.Uncompressed()
+		if err != nil {
+			return nil, err
+		}
+		defer contents.Close() //nolint:errcheck
+
+		envBytes, err := io.ReadAll(contents)
+		if err != nil {
+			return nil, err
+		}
+		env := &dsse.Envelope{}
+		if err := json.Unmarshal(envBytes, env); err != nil {
+			return nil, err
+		}
+		return env, nil
+	}
+
+	return nil, ErrNoEnvelope
+}
+
+// CheckSubject checks that the envelope holds an in-toto statement that
+// records the artifact as a subject. Envelopes with other payload types are
+// rejected, as nothing prevents them from being copied to other artifacts.
+func CheckSubject(env *dsse.Envelope, subject name.Digest) error {
+	if env.PayloadType != intoto.PayloadType {
+		return fmt.Errorf("%w: payload type '%s'", ErrNotStatement, env.PayloadType)
+	}
+
+	statement, err := intoto.StatementFromEnvelope(env)
+	if err != nil {
+		return err
+	}
+
+	algorithm, digest, _ := strings.Cut(subject.DigestStr(), ":")
+	for _, statementSubject := range statement.GetSubject() {
+		if statementSubject.GetDigest()[algorithm] == digest {
+			return nil
+		}
+	}
+
+	return ErrSubjectNotFound
+}
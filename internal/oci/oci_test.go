@@ -0,0 +1,219 @@
+package oci
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/intoto"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	ita1 "github.com/in-toto/attestation/go/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// pushImage starts an in-process registry, which supports the referrers API if
+// referrers is set, pushes a random image to it, and returns the image's
+// reference and digest.
+func pushImage(t *testing.T, referrers bool) (string, name.Digest) {
+	t.Helper()
+	server := httptest.NewServer(registry.New(registry.WithReferrersSupport(referrers), registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+
+	image, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := strings.TrimPrefix(server.URL, "http://") + "/app:v1"
+	parsedRef, err := name.ParseReference(ref, name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(parsedRef, image); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := image.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref, parsedRef.Context().Digest(digest.String())
+}
+
+// statementEnvelope returns an unsigned envelope holding an in-toto statement
+// whose subject has the digest.
+func statementEnvelope(t *testing.T, digest name.Digest) *dsse.Envelope {
+	t.Helper()
+	algorithm, encoded, _ := strings.Cut(digest.DigestStr(), ":")
+	statement, err := intoto.NewStatement(
+		[]*ita1.ResourceDescriptor{{Name: "app", Digest: map[string]string{algorithm: encoded}}},
+		"https://example.com/predicate/v1",
+		&structpb.Struct{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := protojson.Marshal(statement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &dsse.Envelope{
+		PayloadType: intoto.PayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []dsse.Signature{},
+	}
+}
+
+// pushReferrer pushes an artifact of the envelope artifact type whose subject
+// is the image, holding the layer with the contents and media type.
+func pushReferrer(t *testing.T, subject name.Digest, contents []byte, mediaType types.MediaType) {
+	t.Helper()
+	descriptor, err := remote.Head(subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	artifact, err := mutate.Append(empty.Image, mutate.Addendum{Layer: static.NewLayer(contents, mediaType)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifact = mutate.MediaType(artifact, types.OCIManifestSchema1)
+	artifact = mutate.ConfigMediaType(artifact, ArtifactType)
+	artifact = mutate.Subject(artifact, v1.Descriptor{
+		MediaType: descriptor.MediaType,
+		Size:      descriptor.Size,
+		Digest:    descriptor.Digest,
+	}).(v1.Image)
+
+	artifactDigest, err := artifact.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(subject.Context().Digest(artifactDigest.String()), artifact); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAttachEnvelopes(t *testing.T) {
+	t.Run("referrers API", func(t *testing.T) {
+		testAttachEnvelopes(t, true)
+	})
+	// Registries without the referrers API use the referrers tag schema
+	t.Run("referrers tag", func(t *testing.T) {
+		testAttachEnvelopes(t, false)
+	})
+}
+
+func testAttachEnvelopes(t *testing.T, referrers bool) {
+	ref, subject := pushImage(t, referrers)
+	c := NewClient(context.Background(), true)
+
+	resolved, err := c.Resolve(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.String() != subject.String() {
+		t.Fatalf("resolved '%s', expected '%s'", resolved, subject)
+	}
+
+	attached, err := c.Envelopes(subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attached) != 0 {
+		t.Fatalf("expected no envelopes, got %d", len(attached))
+	}
+
+	env := statementEnvelope(t, subject)
+	artifactRef, err := c.Attach(ref, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attached, err = c.Envelopes(subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attached) != 1 || attached[0].Err != nil || attached[0].Digest.String() != artifactRef.String() {
+		t.Fatalf("unexpected envelopes %+v", attached)
+	}
+	if attached[0].Envelope.Payload != env.Payload {
+		t.Fatal("attached envelope does not match")
+	}
+	if err := CheckSubject(attached[0].Envelope, subject); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnvelopesInvalidReferrers(t *testing.T) {
+	ref, subject := pushImage(t, true)
+	c := NewClient(context.Background(), true)
+
+	if _, err := c.Attach(ref, statementEnvelope(t, subject)); err != nil {
+		t.Fatal(err)
+	}
+	// Referrers without an envelope, or whose envelope cannot be parsed, are
+	// reported without preventing the others from being used
+	pushReferrer(t, subject, []byte("{}"), "application/octet-stream")
+	pushReferrer(t, subject, []byte("not json"), ArtifactType)
+
+	attached, err := c.Envelopes(subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attached) != 3 {
+		t.Fatalf("expected 3 referrers, got %d", len(attached))
+	}
+
+	valid, noEnvelope, invalid := 0, 0, 0
+	for _, artifact := range attached {
+		switch {
+		case artifact.Err == nil && artifact.Envelope != nil:
+			valid++
+		case errors.Is(artifact.Err, ErrNoEnvelope):
+			noEnvelope++
+		case artifact.Err != nil && artifact.Envelope == nil:
+			invalid++
+		}
+	}
+	if valid != 1 || noEnvelope != 1 || invalid != 1 {
+		t.Fatalf("unexpected referrers %+v", attached)
+	}
+}
+
+func TestCheckSubject(t *testing.T) {
+	digest, err := name.NewDigest("registry.example.com/app@sha256:" + strings.Repeat("a", 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := name.NewDigest("registry.example.com/app@sha256:" + strings.Repeat("b", 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckSubject(statementEnvelope(t, digest), digest); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSubject(statementEnvelope(t, other), digest); !errors.Is(err, ErrSubjectNotFound) {
+		t.Fatalf("expected ErrSubjectNotFound, got %v", err)
+	}
+
+	// Other payloads are not bound to the artifact
+	unbound := &dsse.Envelope{PayloadType: "text/plain", Payload: base64.StdEncoding.EncodeToString([]byte(digest.DigestStr()))}
+	if err := CheckSubject(unbound, digest); !errors.Is(err, ErrNotStatement) {
+		t.Fatalf("expected ErrNotStatement, got %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+// Package opa evaluates Rego policies against verified DSSE envelopes using
+// the Open Policy Agent. See https://www.openpolicyagent.org.
+//
+// Policies are evaluated over an input document with the following schema,
+// which is versioned using its version field:
+//
+//	{
+//	  "version": 1,
+//	  "payloadType": "<payload type of the envelope>",
+//	  "payload": <decoded payload, structured if JSON, a string otherwise>,
+//	  "verification": {
+//	    "signers": [
+//	      {
+//	        "keyid": "<key ID of the verified signer>",
+//	        "name": "<name of the signer in the policy or the key reference>",
+//	        "identity": "<Sigstore certificate identity, if any>",
+//	        "issuer": "<Sigstore OIDC issuer, if any>",
+//	        "timestamps": ["<RFC 3339 time recorded in the transparency log>"]
+//	      }
+//	    ]
+//	  }
+//	}
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/adityasaky/essd/internal/key"
+	"github.com/open-policy-agent/opa/v1/rego"
+)
+
+const (
+	// InputVersion is the version of the input document schema.
+	InputVersion = 1
+
+	// DefaultQuery is the query evaluated by default, which collects the deny
+	// messages of policies in the essd package.
+	DefaultQuery = "data.essd.deny"
+)
+
+var (
+	ErrDenied           = errors.New("envelope denied by Rego policy")
+	ErrUndefinedQuery   = errors.New("query is undefined")
+	ErrUnexpectedResult = errors.New("unexpected query result")
+)
+
+// Input is the input document policies are evaluated over.
+type Input struct {
+	Version      int          `json:"version"`
+	PayloadType  string       `json:"payloadType"`
+	Payload      any          `json:"payload"`
+	Verification Verification `json:"verification"`
+}
+
+// Verification records the results of verifying the envelope's signatures.
+type Verification struct {
+	Signers []Signer `json:"signers"`
+}
+
+// Signer describes a signer whose signature was verified.
+type Signer struct {
+	KeyID      string   `json:"keyid"`
+	Name       string   `json:"name"`
+	Identity   string   `json:"identity,omitempty"`
+	Issuer     string   `json:"issuer,omitempty"`
+	Timestamps []string `json:"timestamps,omitempty"`
+}
+
+// NewInput creates the input document for an envelope with the payload type
+// and payload, whose signatures were verified for the signers.
+func NewInput(payloadType string, payload []byte, signers []key.VerifiedSigner) *Input {
+	input := &Input{
+		Version:      InputVersion,
+		PayloadType:  payloadType,
+		Verification: Verification{Signers: []Signer{}},
+	}
+
+	if err := json.Unmarshal(payload, &input.Payload); err != nil {
+		input.Payload = string(payload)
+	}
+
+	for _, signer := range signers {
+		timestamps := []string{}
+		for _, timestamp := range signer.Timestamps {
+			timestamps = append(timestamps, timestamp.Format(time.RFC3339))
+		}
+		input.Verification.Signers = append(input.Verification.Signers, Signer{
+			KeyID:      signer.KeyID,
+			Name:       signer.Name,
+			Identity:   signer.Identity,
+			Issuer:     signer.Issuer,
+			Timestamps: timestamps,
+		})
+	}
+
+	return input
+}
+
+// Evaluate evaluates the query against the input using the Rego policy at
+// policyPath, and returns the deny messages. The query must produce either a
+// collection of deny messages, or a boolean where false denies the envelope.
+func Evaluate(ctx context.Context, policyPath, query string, input *Input) ([]string, error) {
+	module, err := os.ReadFile(policyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// The input is passed to OPA in its JSON representation
+	inputBytes, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	var inputDoc any
+	if err := json.Unmarshal(inputBytes, &inputDoc); err != nil {
+		return nil, err
+	}
+
+	prepared, err := rego.New(
+		rego.Query(query),
+		rego.Module(policyPath, string(module)),
+	).PrepareForEval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load Rego policy '%s': %w", policyPath, err)
+	}
+
+	results, err := prepared.Eval(ctx, rego.EvalInput(inputDoc))
+	if err != nil {
+		return nil, fmt.Errorf("unable to evaluate Rego policy '%s': %w", policyPath, err)
+	}
+	if len(results) == 0 || len(results[0].Expressions) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUndefinedQuery, query)
+	}
+
+	switch value := results[0].Expressions[0].Value.(type) {
+	case bool:
+		if !value {
+			return []string{fmt.Sprintf("%s is false", query)}, nil
+		}
+		return nil, nil
+	case []any:
+		messages := []string{}
+		for _, message := range value {
+			if messageString, isString := message.(string); isString {
+				messages = append(messages, messageString)
+				continue
+			}
+			messageBytes, err := json.Marshal(message)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, string(messageBytes))
+		}
+		return messages, nil
+	default:
+		return nil, fmt.Errorf("%w '%s': expected deny messages or a boolean", ErrUnexpectedResult, query)
+	}
+}
@@ -0,0 +1,474 @@
+package payload
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/adityasaky/essd/internal/intoto"
+	"github.com/adityasaky/essd/internal/layout"
+	"github.com/adityasaky/essd/internal/slsa"
+	ita1 "github.com/in-toto/attestation/go/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	InTotoPayloadType    = intoto.PayloadType
+	TUFPayloadType       = "application/vnd.tuf+json"
+	CycloneDXPayloadType = "application/vnd.cyclonedx+json"
+	SPDXPayloadType      = "application/spdx+json"
+
+	InTotoStatementV01 = "https://in-toto.io/Statement/v0.1"
+	InTotoStatementV1  = ita1.StatementTypeUri
+
+	SLSAProvenancePredicateType = slsa.PredicateType
+	CycloneDXPredicateType      = "https://cyclonedx.org/bom"
+	SPDXPredicateType           = "https://spdx.dev/Document"
+)
+
+// validateInTotoStatement validates in-toto Statements of versions v0.1 and v1,
+// and their predicates if a validator is known for the predicate type. in-toto
+// layouts and links, which share the payload type, are also validated.
+func (r *Registry) validateInTotoStatement(doc any) error {
+	statement, err := requireObject(doc, "")
+	if err != nil {
+		return err
+	}
+
+	statementType, err := requireString(statement, "", "_type")
+	if err != nil {
+		return err
+	}
+	switch statementType {
+	case InTotoStatementV01, InTotoStatementV1:
+	case layout.LayoutType:
+		return validateInTotoLayout(doc)
+	case layout.LinkType:
+		return validateInTotoLink(statement)
+	default:
+		return &FieldError{Field: "_type", Reason: fmt.Sprintf("unknown statement type '%s'", statementType)}
+	}
+
+	subjects, err := requireArray(statement, "", "subject")
+	if err != nil {
+		return err
+	}
+	if len(subjects) == 0 {
+		return &FieldError{Field: "subject", Reason: "at least one subject is required"}
+	}
+	for i, subjectDoc := range subjects {
+		field := fmt.Sprintf("subject[%d]", i)
+		subject, err := requireObject(subjectDoc, field)
+		if err != nil {
+			return err
+		}
+
+		if statementType == InTotoStatementV01 {
+			if _, err := requireString(subject, field, "name"); err != nil {
+				return err
+			}
+		}
+
+		if err := validateDigestSet(subject, field); err != nil {
+			return err
+		}
+	}
+
+	predicateType, err := requireString(statement, "", "predicateType")
+	if err != nil {
+		return err
+	}
+
+	predicate, hasPredicate := statement["predicate"]
+	if !hasPredicate {
+		if statementType == InTotoStatementV1 {
+			return &FieldError{Field: "predicate", Reason: "required field is missing"}
+		}
+		return nil
+	}
+	if _, err := requireObject(predicate, "predicate"); err != nil {
+		return err
+	}
+
+	validator, known := r.predicateValidator(predicateType)
+	if !known {
+		return nil
+	}
+	if err := validator(predicate); err != nil {
+		return prefixField("predicate", err)
+	}
+
+	return nil
+}
+
+func validateInTotoLayout(doc any) error {
+	docBytes, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	supplyChainLayout := &layout.Layout{}
+	if err := json.Unmarshal(docBytes, supplyChainLayout); err != nil {
+		return &FieldError{Reason: err.Error()}
+	}
+
+	if err := supplyChainLayout.Validate(); err != nil {
+		return &FieldError{Reason: err.Error()}
+	}
+	return nil
+}
+
+func validateInTotoLink(link map[string]any) error {
+	if _, err := requireString(link, "", "name"); err != nil {
+		return err
+	}
+
+	for _, field := range []string{"materials", "products"} {
+		if _, has := link[field]; !has {
+			continue
+		}
+		artifacts, err := requireObjectField(link, "", field)
+		if err != nil {
+			return err
+		}
+		for _, path := range slices.Sorted(maps.Keys(artifacts)) {
+			artifact := map[string]any{"digest": artifacts[path]}
+			if err := validateDigestSet(artifact, fmt.Sprintf("%s[%s]", field, path)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateDigestSet checks the digest set of a resource descriptor. Digests
+// for algorithms known to in-toto must be hex encoded and of the right length.
+func validateDigestSet(descriptor map[string]any, field string) error {
+	digests, err := requireObjectField(descriptor, field, "digest")
+	if err != nil {
+		return err
+	}
+	if len(digests) == 0 {
+		return &FieldError{Field: joinField(field, "digest"), Reason: "at least one digest is required"}
+	}
+
+	for _, algorithm := range slices.Sorted(maps.Keys(digests)) {
+		digest, err := requireString(digests, joinField(field, "digest"), algorithm)
+		if err != nil {
+			return err
+		}
+
+		// HexLength returns the size of the digest in bytes
+		size := ita1.HashAlgorithm(algorithm).HexLength()
+		if size == 0 {
+			continue
+		}
+		digestBytes, err := hex.DecodeString(digest)
+		if err != nil || len(digestBytes) != size {
+			return &FieldError{
+				Field:  joinField(joinField(field, "digest"), algorithm),
+				Reason: fmt.Sprintf("expected %d hex characters", 2*size),
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateSLSAProvenance(doc any) error {
+	docBytes, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	predicate := &structpb.Struct{}
+	if err := protojson.Unmarshal(docBytes, predicate); err != nil {
+		return &FieldError{Reason: err.Error()}
+	}
+
+	if err := slsa.Validate(predicate); err != nil {
+		return &FieldError{Reason: err.Error()}
+	}
+	return nil
+}
+
+// validateTUFMetadata validates the signed portion of TUF metadata. See
+// https://theupdateframework.github.io/specification/latest/.
+func validateTUFMetadata(doc any) error {
+	metadata, err := requireObject(doc, "")
+	if err != nil {
+		return err
+	}
+
+	role, err := requireString(metadata, "", "_type")
+	if err != nil {
+		return err
+	}
+	if _, err := requireString(metadata, "", "spec_version"); err != nil {
+		return err
+	}
+	if err := requirePositiveInteger(metadata, "", "version"); err != nil {
+		return err
+	}
+	if err := requireTimestamp(metadata, "", "expires"); err != nil {
+		return err
+	}
+
+	switch role {
+	case "root":
+		if _, err := requireObjectField(metadata, "", "keys"); err != nil {
+			return err
+		}
+		roles, err := requireObjectField(metadata, "", "roles")
+		if err != nil {
+			return err
+		}
+		for _, topLevelRole := range []string{"root", "targets", "snapshot", "timestamp"} {
+			field := joinField("roles", topLevelRole)
+			roleDef, err := requireObjectField(roles, "roles", topLevelRole)
+			if err != nil {
+				return err
+			}
+			if _, err := requireArray(roleDef, field, "keyids"); err != nil {
+				return err
+			}
+			if err := requirePositiveInteger(roleDef, field, "threshold"); err != nil {
+				return err
+			}
+		}
+	case "targets":
+		if _, err := requireObjectField(metadata, "", "targets"); err != nil {
+			return err
+		}
+	case "snapshot", "timestamp":
+		if _, err := requireObjectField(metadata, "", "meta"); err != nil {
+			return err
+		}
+	default:
+		return &FieldError{Field: "_type", Reason: fmt.Sprintf("unknown TUF role '%s'", role)}
+	}
+
+	return nil
+}
+
+// validateCycloneDX validates CycloneDX JSON documents. See
+// https://cyclonedx.org/specification/overview/.
+func validateCycloneDX(doc any) error {
+	bom, err := requireObject(doc, "")
+	if err != nil {
+		return err
+	}
+
+	bomFormat, err := requireString(bom, "", "bomFormat")
+	if err != nil {
+		return err
+	}
+	if bomFormat != "CycloneDX" {
+		return &FieldError{Field: "bomFormat", Reason: "expected 'CycloneDX'"}
+	}
+
+	specVersion, err := requireString(bom, "", "specVersion")
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(specVersion, "1.") {
+		return &FieldError{Field: "specVersion", Reason: fmt.Sprintf("unsupported spec version '%s'", specVersion)}
+	}
+
+	if serialNumber, has := bom["serialNumber"]; has {
+		serialNumber, isString := serialNumber.(string)
+		if !isString || !strings.HasPrefix(serialNumber, "urn:uuid:") {
+			return &FieldError{Field: "serialNumber", Reason: "expected a urn:uuid: URN"}
+		}
+	}
+	if _, has := bom["version"]; has {
+		if err := requirePositiveInteger(bom, "", "version"); err != nil {
+			return err
+		}
+	}
+
+	if _, has := bom["components"]; has {
+		components, err := requireArray(bom, "", "components")
+		if err != nil {
+			return err
+		}
+		for i, componentDoc := range components {
+			field := fmt.Sprintf("components[%d]", i)
+			component, err := requireObject(componentDoc, field)
+			if err != nil {
+				return err
+			}
+			if _, err := requireString(component, field, "type"); err != nil {
+				return err
+			}
+			if _, err := requireString(component, field, "name"); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateSPDX validates SPDX 2.x JSON documents. See https://spdx.dev.
+func validateSPDX(doc any) error {
+	document, err := requireObject(doc, "")
+	if err != nil {
+		return err
+	}
+
+	spdxVersion, err := requireString(document, "", "spdxVersion")
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(spdxVersion, "SPDX-2.") {
+		return &FieldError{Field: "spdxVersion", Reason: fmt.Sprintf("unsupported SPDX version '%s'", spdxVersion)}
+	}
+
+	spdxID, err := requireString(document, "", "SPDXID")
+	if err != nil {
+		return err
+	}
+	if spdxID != "SPDXRef-DOCUMENT" {
+		return &FieldError{Field: "SPDXID", Reason: "expected 'SPDXRef-DOCUMENT'"}
+	}
+
+	for _, key := range []string{"dataLicense", "name", "documentNamespace"} {
+		if _, err := requireString(document, "", key); err != nil {
+			return err
+		}
+	}
+
+	creationInfo, err := requireObjectField(document, "", "creationInfo")
+	if err != nil {
+		return err
+	}
+	if err := requireTimestamp(creationInfo, "creationInfo", "created"); err != nil {
+		return err
+	}
+	creators, err := requireArray(creationInfo, "creationInfo", "creators")
+	if err != nil {
+		return err
+	}
+	if len(creators) == 0 {
+		return &FieldError{Field: "creationInfo.creators", Reason: "at least one creator is required"}
+	}
+
+	if _, has := document["packages"]; has {
+		packages, err := requireArray(document, "", "packages")
+		if err != nil {
+			return err
+		}
+		for i, packageDoc := range packages {
+			field := fmt.Sprintf("packages[%d]", i)
+			pkg, err := requireObject(packageDoc, field)
+			if err != nil {
+				return err
+			}
+			if _, err := requireString(pkg, field, "SPDXID"); err != nil {
+				return err
+			}
+			if _, err := requireString(pkg, field, "name"); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func requireObject(doc any, field string) (map[string]any, error) {
+	object, isObject := doc.(map[string]any)
+	if !isObject {
+		return nil, &FieldError{Field: field, Reason: "expected an object"}
+	}
+	return object, nil
+}
+
+func requireObjectField(object map[string]any, parent, key string) (map[string]any, error) {
+	value, has := object[key]
+	if !has {
+		return nil, &FieldError{Field: joinField(parent, key), Reason: "required field is missing"}
+	}
+	return requireObject(value, joinField(parent, key))
+}
+
+func requireArray(object map[string]any, parent, key string) ([]any, error) {
+	value, has := object[key]
+	if !has {
+		return nil, &FieldError{Field: joinField(parent, key), Reason: "required field is missing"}
+	}
+	array, isArray := value.([]any)
+	if !isArray {
+		return nil, &FieldError{Field: joinField(parent, key), Reason: "expected an array"}
+	}
+	return array, nil
+}
+
+func requireString(object map[string]any, parent, key string) (string, error) {
+	value, has := object[key]
+	if !has {
+		return "", &FieldError{Field: joinField(parent, key), Reason: "required field is missing"}
+	}
+	str, isString := value.(string)
+	if !isString || str == "" {
+		return "", &FieldError{Field: joinField(parent, key), Reason: "expected a non-empty string"}
+	}
+	return str, nil
+}
+
+func requirePositiveInteger(object map[string]any, parent, key string) error {
+	value, has := object[key]
+	if !has {
+		return &FieldError{Field: joinField(parent, key), Reason: "required field is missing"}
+	}
+	number, isNumber := value.(json.Number)
+	if !isNumber {
+		return &FieldError{Field: joinField(parent, key), Reason: "expected an integer"}
+	}
+	integer, err := number.Int64()
+	if err != nil || integer < 1 {
+		return &FieldError{Field: joinField(parent, key), Reason: "expected a positive integer"}
+	}
+	return nil
+}
+
+func requireTimestamp(object map[string]any, parent, key string) error {
+	timestamp, err := requireString(object, parent, key)
+	if err != nil {
+		return err
+	}
+	if _, err := time.Parse(time.RFC3339, timestamp); err != nil {
+		return &FieldError{Field: joinField(parent, key), Reason: "expected an RFC 3339 timestamp"}
+	}
+	return nil
+}
+
+func joinField(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+// prefixField qualifies the field of a FieldError returned when validating a
+// nested document.
+func prefixField(prefix string, err error) error {
+	fieldErr, isFieldErr := err.(*FieldError)
+	if !isFieldErr {
+		return err
+	}
+
+	field := prefix
+	if fieldErr.Field != "" {
+		field = joinField(prefix, fieldErr.Field)
+		if strings.HasPrefix(fieldErr.Field, "[") {
+			field = prefix + fieldErr.Field
+		}
+	}
+	return &FieldError{Field: field, Reason: fieldErr.Reason}
+}
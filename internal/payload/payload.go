@@ -0,0 +1,215 @@
+// Package payload validates the structure of DSSE payloads based on their
+// payload type. A registry of known payload types is provided, which can be
+// extended with JSON Schemas for other payload types and in-toto predicate
+// types.
+package payload
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+var (
+	ErrUnknownPayloadType = errors.New("no validator known for payload type")
+	ErrInvalidJSON        = errors.New("payload is not valid JSON")
+)
+
+// Validator checks the structure of a decoded JSON document. Numbers in the
+// document are represented using json.Number.
+type Validator func(doc any) error
+
+// FieldError indicates that a specific field of a payload is invalid. The
+// field is identified using a JSON path like expression, e.g.
+// subject[0].digest.
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("invalid payload: %s", e.Reason)
+	}
+	return fmt.Sprintf("invalid payload field '%s': %s", e.Field, e.Reason)
+}
+
+// Registry maps payload types and in-toto predicate types to the validators
+// used for them.
+type Registry struct {
+	payloadTypes   map[string]Validator
+	predicateTypes map[string]Validator
+}
+
+// NewRegistry returns a registry populated with the payload types and
+// predicate types essd knows about.
+func NewRegistry() *Registry {
+	r := &Registry{
+		payloadTypes:   map[string]Validator{},
+		predicateTypes: map[string]Validator{},
+	}
+
+	r.RegisterPayloadType(InTotoPayloadType, r.validateInTotoStatement)
+	r.RegisterPayloadType(TUFPayloadType, validateTUFMetadata)
+	r.RegisterPayloadType(CycloneDXPayloadType, validateCycloneDX)
+	r.RegisterPayloadType(SPDXPayloadType, validateSPDX)
+
+	r.RegisterPredicateType(SLSAProvenancePredicateType, validateSLSAProvenance)
+
+	return r
+}
+
+// RegisterPayloadType sets the validator for the payload type, replacing any
+// existing validator.
+func (r *Registry) RegisterPayloadType(payloadType string, validator Validator) {
+	r.payloadTypes[payloadType] = validator
+}
+
+// RegisterPredicateType sets the validator for predicates of the in-toto
+// predicate type, replacing any existing validator.
+func (r *Registry) RegisterPredicateType(predicateType string, validator Validator) {
+	r.predicateTypes[predicateType] = validator
+}
+
+// RegisterPayloadSchema registers the JSON Schema at schemaPath as the
+// validator for the payload type.
+func (r *Registry) RegisterPayloadSchema(payloadType, schemaPath string) error {
+	validator, err := loadSchema(schemaPath)
+	if err != nil {
+		return err
+	}
+	r.RegisterPayloadType(payloadType, validator)
+	return nil
+}
+
+// RegisterPredicateSchema registers the JSON Schema at schemaPath as the
+// validator for predicates of the in-toto predicate type.
+func (r *Registry) RegisterPredicateSchema(predicateType, schemaPath string) error {
+	validator, err := loadSchema(schemaPath)
+	if err != nil {
+		return err
+	}
+	r.RegisterPredicateType(predicateType, validator)
+	return nil
+}
+
+// IsKnown indicates if a validator exists for the payload type.
+func (r *Registry) IsKnown(payloadType string) bool {
+	_, known := r.payloadTypes[payloadType]
+	return known
+}
+
+// Validate checks the payload against the validator for its payload type. An
+// error wrapping ErrUnknownPayloadType is returned if there is no validator
+// for the payload type.
+func (r *Registry) Validate(payloadType string, payload []byte) error {
+	validator, known := r.payloadTypes[payloadType]
+	if !known {
+		return fmt.Errorf("%w '%s'", ErrUnknownPayloadType, payloadType)
+	}
+
+	doc, err := decodeJSON(payload)
+	if err != nil {
+		return err
+	}
+
+	return validator(doc)
+}
+
+// predicateValidator returns the validator for the predicate type. Versioned
+// SBOM predicate types such as https://spdx.dev/Document/v2.3 are matched to
+// the validator for their document format.
+func (r *Registry) predicateValidator(predicateType string) (Validator, bool) {
+	if validator, known := r.predicateTypes[predicateType]; known {
+		return validator, true
+	}
+
+	switch {
+	case predicateType == CycloneDXPredicateType || strings.HasPrefix(predicateType, CycloneDXPredicateType+"/v"):
+		return validateCycloneDX, true
+	case predicateType == SPDXPredicateType || strings.HasPrefix(predicateType, SPDXPredicateType+"/v"):
+		return validateSPDX, true
+	}
+
+	return nil, false
+}
+
+func loadSchema(schemaPath string) (Validator, error) {
+	schemaFile, err := os.Open(schemaPath)
+	if err != nil {
+		return nil, err
+	}
+	defer schemaFile.Close() //nolint:errcheck
+
+	schemaDoc, err := jsonschema.UnmarshalJSON(schemaFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse schema '%s': %w", schemaPath, err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(schemaPath, schemaDoc); err != nil {
+		return nil, fmt.Errorf("unable to load schema '%s': %w", schemaPath, err)
+	}
+	schema, err := compiler.Compile(schemaPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to compile schema '%s': %w", schemaPath, err)
+	}
+
+	return func(doc any) error {
+		if err := schema.Validate(doc); err != nil {
+			var validationErr *jsonschema.ValidationError
+			if errors.As(err, &validationErr) {
+				return schemaFieldError(validationErr)
+			}
+			return err
+		}
+		return nil
+	}, nil
+}
+
+// schemaFieldError reports the most specific location at which the document
+// failed schema validation.
+func schemaFieldError(err *jsonschema.ValidationError) error {
+	leaf := err
+	for len(leaf.Causes) > 0 {
+		leaf = leaf.Causes[0]
+	}
+
+	field := ""
+	for _, token := range leaf.InstanceLocation {
+		if _, err := strconv.Atoi(token); err == nil {
+			field += fmt.Sprintf("[%s]", token)
+		} else {
+			field = joinField(field, token)
+		}
+	}
+
+	return &FieldError{
+		Field:  field,
+		Reason: fmt.Sprintf("does not match schema: %s", leaf.ErrorKind.LocalizedString(message.NewPrinter(language.English))),
+	}
+}
+
+func decodeJSON(payload []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidJSON, err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("%w: unexpected data after top-level value", ErrInvalidJSON)
+	}
+
+	return doc, nil
+}
@@ -0,0 +1,341 @@
+// Package policy evaluates DSSE envelopes against verification policies. A
+// policy names the keys and Sigstore identities that are trusted, and declares
+// for each allowed payload type which of them must sign envelopes, how many
+// signatures are required, and which in-toto predicate types are accepted.
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/adityasaky/essd/internal/assertion"
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/intoto"
+	"github.com/adityasaky/essd/internal/key"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// Version is the policy file format version supported.
+	Version = 1
+
+	RulePayloadType   = "payload-type"
+	RuleThreshold     = "threshold"
+	RulePredicateType = "predicate-type"
+	RuleAssertion     = "assertion"
+)
+
+var (
+	ErrInvalidPolicy      = errors.New("invalid policy")
+	ErrPolicyNotSatisfied = errors.New("envelope does not satisfy policy")
+)
+
+// Policy is the verification policy as declared in a policy file.
+type Policy struct {
+	Version int `json:"version"`
+
+	// Keys maps key names to paths of key files. Relative paths are resolved
+	// from the directory of the policy file.
+	Keys map[string]string `json:"keys,omitempty"`
+	// Identities maps names to Sigstore identities.
+	Identities map[string]Identity `json:"identities,omitempty"`
+
+	// PayloadTypes maps each allowed payload type to the rule envelopes of
+	// that payload type must satisfy.
+	PayloadTypes map[string]*Rule `json:"payloadTypes"`
+
+	// dir is the directory relative key paths are resolved from.
+	dir string
+	// keyVerifiers holds the verifiers of the keys, once preloaded.
+	keyVerifiers map[string]dsse.Verifier
+}
+
+// Identity is a Sigstore identity, identified by the certificate's subject
+// and the OIDC issuer.
+type Identity struct {
+	Identity string `json:"identity"`
+	Issuer   string `json:"issuer"`
+}
+
+// Rule declares the requirements for envelopes of a payload type.
+type Rule struct {
+	// Signers lists the names of keys and identities that are trusted to sign
+	// envelopes of the payload type.
+	Signers []string `json:"signers"`
+	// Threshold is the number of signers whose signatures are required. It
+	// defaults to 1.
+	Threshold int `json:"threshold,omitempty"`
+	// PredicateTypes, if set, lists the in-toto predicate types the envelope's
+	// statement may have. It only applies to in-toto payloads.
+	PredicateTypes []string `json:"predicateTypes,omitempty"`
+	// Assertions lists CEL expressions that must hold for the envelope once
+	// its signatures are verified. They are only evaluated if the threshold is
+	// met.
+	Assertions []string `json:"assertions,omitempty"`
+}
+
+// Result records the outcome of evaluating an envelope against a policy.
+type Result struct {
+	PayloadType string
+	Checks      []Check
+	// Signers lists the signers whose signatures were verified, named as in
+	// the policy.
+	Signers      []key.VerifiedSigner
+	AcceptedKeys []dsse.AcceptedKey
+}
+
+// Check is the outcome of evaluating a single rule of the policy.
+type Check struct {
+	Rule    string
+	Passed  bool
+	Message string
+}
+
+// Passed indicates if every check passed.
+func (r *Result) Passed() bool {
+	for _, check := range r.Checks {
+		if !check.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// Err returns an error describing the failed checks, if any.
+func (r *Result) Err() error {
+	failed := []string{}
+	for _, check := range r.Checks {
+		if !check.Passed {
+			failed = append(failed, fmt.Sprintf("%s: %s", check.Rule, check.Message))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrPolicyNotSatisfied, strings.Join(failed, "; "))
+}
+
+func (r *Result) add(rule string, passed bool, format string, a ...any) {
+	check := Check{Rule: rule, Passed: passed, Message: fmt.Sprintf(format, a...)}
+	r.Checks = append(r.Checks, check)
+	slog.Debug("Evaluated policy rule", slog.String("payloadType", r.PayloadType), slog.String("rule", check.Rule), slog.Bool("passed", check.Passed), slog.String("message", check.Message))
+}
+
+// Load reads a policy from a YAML or JSON file.
+func Load(path string) (*Policy, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(contents, policy); err != nil {
+		return nil, fmt.Errorf("%w: unable to parse '%s': %w", ErrInvalidPolicy, path, err)
+	}
+	policy.dir = filepath.Dir(path)
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// Validate checks that the policy is well formed.
+func (p *Policy) Validate() error {
+	if p.Version != Version {
+		return fmt.Errorf("%w: unsupported version %d, expected %d", ErrInvalidPolicy, p.Version, Version)
+	}
+
+	if len(p.PayloadTypes) == 0 {
+		return fmt.Errorf("%w: no payload types are allowed", ErrInvalidPolicy)
+	}
+
+	for name, identity := range p.Identities {
+		if _, isKey := p.Keys[name]; isKey {
+			return fmt.Errorf("%w: '%s' is declared as both a key and an identity", ErrInvalidPolicy, name)
+		}
+		if identity.Identity == "" || identity.Issuer == "" {
+			return fmt.Errorf("%w: identity '%s' must set identity and issuer", ErrInvalidPolicy, name)
+		}
+	}
+
+	for payloadType, rule := range p.PayloadTypes {
+		if rule == nil || len(rule.Signers) == 0 {
+			return fmt.Errorf("%w: no signers declared for payload type '%s'", ErrInvalidPolicy, payloadType)
+		}
+
+		for _, signer := range rule.Signers {
+			_, isKey := p.Keys[signer]
+			_, isIdentity := p.Identities[signer]
+			if !isKey && !isIdentity {
+				return fmt.Errorf("%w: unknown signer '%s' for payload type '%s'", ErrInvalidPolicy, signer, payloadType)
+			}
+		}
+
+		if rule.Threshold < 0 || rule.Threshold > len(rule.Signers) {
+			return fmt.Errorf("%w: threshold %d for payload type '%s' must be between 1 and the number of signers", ErrInvalidPolicy, rule.Threshold, payloadType)
+		}
+
+		for _, expression := range rule.Assertions {
+			if _, err := assertion.Compile(expression); err != nil {
+				return fmt.Errorf("%w: payload type '%s': %w", ErrInvalidPolicy, payloadType, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Verify evaluates the envelope against the policy. An error is returned only
+// if the evaluation could not be performed; whether the envelope satisfies
+// the policy is recorded in the result.
+func (p *Policy) Verify(ctx context.Context, env *dsse.Envelope) (*Result, error) {
+	result := &Result{PayloadType: env.PayloadType}
+
+	rule, allowed := p.PayloadTypes[env.PayloadType]
+	if !allowed {
+		result.add(RulePayloadType, false, "payload type '%s' is not allowed", env.PayloadType)
+		return result, nil
+	}
+	result.add(RulePayloadType, true, "payload type '%s' is allowed", env.PayloadType)
+
+	threshold := rule.Threshold
+	if threshold == 0 {
+		threshold = 1
+	}
+
+	verifiers := []dsse.Verifier{}
+	for _, name := range rule.Signers {
+		verifier, err := p.verifier(name)
+		if err != nil {
+			return nil, err
+		}
+		verifiers = append(verifiers, verifier)
+	}
+
+	envVerifier, err := dsse.NewMultiEnvelopeVerifier(threshold, verifiers...)
+	if err != nil {
+		return nil, err
+	}
+
+	acceptedKeys, verifyErr := envVerifier.Verify(ctx, env)
+	result.AcceptedKeys = acceptedKeys
+	result.Signers, err = key.VerifiedSigners(acceptedKeys, verifiers, rule.Signers)
+	if err != nil {
+		return nil, err
+	}
+	acceptedNames := []string{}
+	for _, signer := range result.Signers {
+		acceptedNames = append(acceptedNames, signer.Name)
+	}
+	slices.Sort(acceptedNames)
+
+	if verifyErr != nil && !errors.Is(verifyErr, dsse.ErrThresholdNotMet) {
+		result.add(RuleThreshold, false, "%s", verifyErr)
+	} else {
+		result.add(RuleThreshold, verifyErr == nil, "%d of %d required signatures verified (accepted: %s)", len(acceptedKeys), threshold, formatNames(acceptedNames))
+	}
+
+	if len(rule.PredicateTypes) > 0 {
+		statement, err := intoto.StatementFromEnvelope(env)
+		if err != nil {
+			result.add(RulePredicateType, false, "%s", err)
+		} else if slices.Contains(rule.PredicateTypes, statement.GetPredicateType()) {
+			result.add(RulePredicateType, true, "predicate type '%s' is allowed", statement.GetPredicateType())
+		} else {
+			result.add(RulePredicateType, false, "predicate type '%s' is not one of %s", statement.GetPredicateType(), formatNames(rule.PredicateTypes))
+		}
+	}
+
+	if verifyErr == nil && len(rule.Assertions) > 0 {
+		payload, err := env.DecodeB64Payload()
+		if err != nil {
+			return nil, err
+		}
+		input := &assertion.Input{PayloadType: env.PayloadType, Payload: payload, Signers: result.Signers}
+
+		for _, expression := range rule.Assertions {
+			compiled, err := assertion.Compile(expression)
+			if err != nil {
+				return nil, err
+			}
+			if err := compiled.Evaluate(input); err != nil {
+				result.add(RuleAssertion, false, "%s", err)
+			} else {
+				result.add(RuleAssertion, true, "'%s' holds", expression)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+/*
+Preload loads the policy's keys, so that they are not loaded again each time an
+envelope is verified, and so that the policy can be used to verify envelopes
+concurrently. Sigstore identities are not preloaded, as their verifiers hold
+the state of the signature being verified.
+*/
+func (p *Policy) Preload() error {
+	keyVerifiers := map[string]dsse.Verifier{}
+	for name := range p.Keys {
+		verifier, err := p.loadKey(name)
+		if err != nil {
+			return err
+		}
+		keyVerifiers[name] = verifier
+	}
+	p.keyVerifiers = keyVerifiers
+	return nil
+}
+
+// KeyPaths returns the paths of the policy's key files.
+func (p *Policy) KeyPaths() []string {
+	paths := []string{}
+	for name := range p.Keys {
+		paths = append(paths, p.keyPath(name))
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func (p *Policy) verifier(name string) (dsse.Verifier, error) {
+	if identity, isIdentity := p.Identities[name]; isIdentity {
+		return key.NewVerifier(fmt.Sprintf("%s%s::%s", key.SigstorePrefix, identity.Identity, identity.Issuer))
+	}
+
+	if verifier, preloaded := p.keyVerifiers[name]; preloaded {
+		return verifier, nil
+	}
+	return p.loadKey(name)
+}
+
+func (p *Policy) loadKey(name string) (dsse.Verifier, error) {
+	verifier, err := key.NewVerifier(p.keyPath(name))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load key '%s': %w", name, err)
+	}
+	return verifier, nil
+}
+
+func (p *Policy) keyPath(name string) string {
+	keyPath := p.Keys[name]
+	if !filepath.IsAbs(keyPath) {
+		keyPath = filepath.Join(p.dir, keyPath)
+	}
+	return keyPath
+}
+
+func formatNames(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,257 @@
+// Package remote implements a DSSE signer that requests signatures from an
+// essd signing service, so that the signing key is not held by the client.
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/signapi"
+	essdssh "github.com/adityasaky/essd/internal/ssh"
+	"github.com/secure-systems-lab/go-securesystemslib/signerverifier"
+	"golang.org/x/crypto/ssh"
+)
+
+// Prefix is the prefix of references to signing services.
+const Prefix = "remote://"
+
+const requestTimeout = time.Minute
+
+var (
+	ErrInvalidReference = errors.New("invalid signing service reference")
+	ErrRequestFailed    = errors.New("signing service request failed")
+	ErrInvalidSignature = errors.New("signing service returned a signature that does not match its public key")
+)
+
+// Options configures how the signer connects and authenticates to the
+// signing service.
+type Options struct {
+	// CAPath is the path of the PEM encoded certificates the service's
+	// certificate is verified with. The system's certificates are used if it
+	// is not set.
+	CAPath string
+	// CertPath and KeyPath are the paths of the client certificate and key,
+	// for services that authenticate clients using mTLS.
+	CertPath string
+	KeyPath  string
+	// TokenPath is the path of the file holding the bearer token, for
+	// services that authenticate clients using tokens.
+	TokenPath string
+}
+
+/*
+Signer requests signatures from a signing service. Messages passed to Sign are
+sent to the service, while messages passed to SignStream are hashed and only
+their digest is sent to the service, which must allow the client to sign
+digests. Signatures returned by the service are verified using its public key.
+*/
+type Signer struct {
+	baseURL         string
+	client          *http.Client
+	token           string
+	keyID           string
+	digestAlgorithm string
+	verifier        *essdssh.Verifier
+}
+
+// NewSigner creates a signer for the signing service at ref, in the form
+// remote://<host>[:<port>][/<path>], which is connected to using HTTPS. The
+// service's key ID and public key are requested when the signer is created.
+func NewSigner(ctx context.Context, ref string, opts *Options) (*Signer, error) {
+	address, found := strings.CutPrefix(ref, Prefix)
+	if !found || address == "" {
+		return nil, fmt.Errorf("%w '%s', expected %s<host>[:<port>]", ErrInvalidReference, ref, Prefix)
+	}
+	baseURL, err := url.Parse("https://" + strings.TrimSuffix(address, "/"))
+	if err != nil || baseURL.Host == "" || baseURL.RawQuery != "" || baseURL.Fragment != "" {
+		return nil, fmt.Errorf("%w '%s'", ErrInvalidReference, ref)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.CAPath != "" {
+		caBytes, err := os.ReadFile(opts.CAPath)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("no certificates found in '%s'", opts.CAPath)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if opts.CertPath != "" || opts.KeyPath != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertPath, opts.KeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	s := &Signer{
+		baseURL: baseURL.String(),
+		client: &http.Client{
+			Timeout:   requestTimeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		},
+	}
+	if opts.TokenPath != "" {
+		token, err := os.ReadFile(opts.TokenPath)
+		if err != nil {
+			return nil, err
+		}
+		s.token = strings.TrimSpace(string(token))
+	}
+
+	signer := &signapi.SignerResponse{}
+	if err := s.do(ctx, http.MethodGet, "/v1/signer", nil, signer); err != nil {
+		return nil, err
+	}
+	s.keyID = signer.KeyID
+	s.digestAlgorithm = signer.DigestAlgorithm
+	s.verifier, err = newVerifier(signer)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// newVerifier creates a verifier for the public key of the service's signer.
+func newVerifier(signer *signapi.SignerResponse) (*essdssh.Verifier, error) {
+	if signer.PublicKey == "" {
+		return nil, fmt.Errorf("%w: signing service does not publish its public key", ErrRequestFailed)
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(signer.PublicKey))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid public key: %w", ErrRequestFailed, err)
+	}
+	return essdssh.NewVerifierFromKey(&signerverifier.SSLibKey{
+		KeyID:   signer.KeyID,
+		KeyType: essdssh.KeyType,
+		Scheme:  pub.Type(),
+		KeyVal:  signerverifier.KeyVal{Public: base64.StdEncoding.EncodeToString(pub.Marshal())},
+	})
+}
+
+// KeyID implements the dsse.Signer interface, returning the key ID of the
+// service's key.
+func (s *Signer) KeyID() (string, error) {
+	return s.keyID, nil
+}
+
+// Sign implements the dsse.Signer interface. The payload type and payload are
+// decoded from the PAE encoding and sent to the service.
+func (s *Signer) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	payloadType, payload, err := dsse.ParsePAE(data)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := s.sign(ctx, &signapi.SignRequest{PayloadType: payloadType, Payload: payload})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.verifier.Verify(ctx, data, sig); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+	return sig, nil
+}
+
+// SignStream implements the dsse.StreamSigner interface. The PAE encoding is
+// hashed as it is read, and only its digest and the payload type are sent to
+// the service.
+func (s *Signer) SignStream(ctx context.Context, r io.Reader) ([]byte, error) {
+	hash, supported := signapi.DigestAlgorithms[s.digestAlgorithm]
+	if !supported || hash != s.verifier.DigestAlgorithm() {
+		return nil, fmt.Errorf("%w: signing service cannot sign digests", ErrRequestFailed)
+	}
+
+	// Everything read, including the prefix, is hashed
+	h := hash.New()
+	reader := bufio.NewReader(io.TeeReader(r, h))
+	payloadType, _, err := dsse.ReadPAEPrefix(reader)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return nil, err
+	}
+
+	digest := h.Sum(nil)
+	sig, err := s.sign(ctx, &signapi.SignRequest{
+		PayloadType: payloadType,
+		Digest:      map[string]string{s.digestAlgorithm: hex.EncodeToString(digest)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.verifier.VerifyDigest(ctx, digest, sig); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+	return sig, nil
+}
+
+func (s *Signer) sign(ctx context.Context, request *signapi.SignRequest) ([]byte, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &signapi.SignResponse{}
+	if err := s.do(ctx, http.MethodPost, "/v1/sign", body, response); err != nil {
+		return nil, err
+	}
+	if response.KeyID != s.keyID {
+		return nil, fmt.Errorf("%w: signing service signed using key '%s', expected '%s'", ErrRequestFailed, response.KeyID, s.keyID)
+	}
+	return base64.StdEncoding.DecodeString(response.Sig)
+}
+
+// do sends a request to the service and decodes its response into response.
+func (s *Signer) do(ctx context.Context, method, path string, body []byte, response any) error {
+	request, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if s.token != "" {
+		request.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	httpResponse, err := s.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRequestFailed, err)
+	}
+	defer httpResponse.Body.Close() //nolint:errcheck
+
+	responseBody, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRequestFailed, err)
+	}
+	if httpResponse.StatusCode != http.StatusOK {
+		failure := &signapi.SignResponse{}
+		if err := json.Unmarshal(responseBody, failure); err == nil && failure.Error != "" {
+			return fmt.Errorf("%w: %s", ErrRequestFailed, failure.Error)
+		}
+		return fmt.Errorf("%w: %s", ErrRequestFailed, httpResponse.Status)
+	}
+	if err := json.Unmarshal(responseBody, response); err != nil {
+		return fmt.Errorf("%w: invalid response: %w", ErrRequestFailed, err)
+	}
+	return nil
+}
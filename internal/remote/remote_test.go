@@ -0,0 +1,180 @@
+package remote
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/server"
+	essdssh "github.com/adityasaky/essd/internal/ssh"
+)
+
+const (
+	token           = "token"
+	restrictedToken = "restricted"
+)
+
+// swappedSigner publishes the key of its embedded signer, but signs using
+// another key, like a misconfigured or compromised signing service.
+type swappedSigner struct {
+	*essdssh.Signer
+	other *essdssh.Signer
+}
+
+func (s *swappedSigner) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	return s.other.Sign(ctx, data)
+}
+
+func (s *swappedSigner) SignDigest(ctx context.Context, digest []byte) ([]byte, error) {
+	return s.other.SignDigest(ctx, digest)
+}
+
+// newService starts a signing service that signs using the signer for a
+// client that authenticates using token and may sign every payload type and
+// digests, and a client that authenticates using restrictedToken and may only
+// sign text/plain payloads. It returns the reference to the service and the
+// options to connect to it with as the first client.
+func newService(t *testing.T, signer dsse.Signer) (string, *Options) {
+	t.Helper()
+	dir := t.TempDir()
+	tokenHash := sha256.Sum256([]byte(token))
+	restrictedTokenHash := sha256.Sum256([]byte(restrictedToken))
+	clients := "version: 1\nclients:\n" +
+		"  ci:\n    tokenSHA256: " + hex.EncodeToString(tokenHash[:]) + "\n    payloadTypes: [\"*\"]\n    allowDigests: true\n" +
+		"  restricted:\n    tokenSHA256: " + hex.EncodeToString(restrictedTokenHash[:]) + "\n    payloadTypes: [text/plain]\n"
+	clientsPath := filepath.Join(dir, "clients.yaml")
+	if err := os.WriteFile(clientsPath, []byte(clients), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := server.New(server.Config{Signer: signer, ClientsPath: clientsPath, AuditLog: io.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := httptest.NewTLSServer(s.Handler())
+	t.Cleanup(service.Close)
+
+	caPath := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: service.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tokenPath := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenPath, []byte(token+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return Prefix + strings.TrimPrefix(service.URL, "https://"), &Options{CAPath: caPath, TokenPath: tokenPath}
+}
+
+func TestSigner(t *testing.T) {
+	sshSigner := essdssh.NewSignerForTest(t, t.TempDir(), "key")
+	ref, opts := newService(t, sshSigner)
+	ctx := context.Background()
+
+	signer, err := NewSigner(ctx, ref, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID, err := signer.KeyID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, _ := sshSigner.KeyID(); keyID != expected {
+		t.Fatalf("unexpected key ID '%s', expected '%s'", keyID, expected)
+	}
+
+	envSigner, err := dsse.NewEnvelopeSigner(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envVerifier, err := dsse.NewEnvelopeVerifier(sshSigner.Verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Payloads are sent to the service
+	env, err := envSigner.SignPayload(ctx, "text/plain", []byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := envVerifier.Verify(ctx, env); err != nil {
+		t.Fatal(err)
+	}
+
+	// Streamed payloads are hashed, and only their digest is sent
+	sig, err := signer.SignStream(ctx, strings.NewReader(string(dsse.PAE("text/plain", []byte("payload")))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sshSigner.Verify(ctx, dsse.PAE("text/plain", []byte("payload")), sig); err != nil {
+		t.Fatal(err)
+	}
+
+	// The service only signs the payload types allowed for the client, and
+	// does not sign digests for clients restricted to some payload types
+	restrictedTokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(restrictedTokenPath, []byte(restrictedToken), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	restricted, err := NewSigner(ctx, ref, &Options{CAPath: opts.CAPath, TokenPath: restrictedTokenPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restrictedEnvSigner, err := dsse.NewEnvelopeSigner(restricted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restrictedEnvSigner.SignPayload(ctx, "text/plain", []byte("payload")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restrictedEnvSigner.SignPayload(ctx, "application/octet-stream", []byte("payload")); !errors.Is(err, ErrRequestFailed) {
+		t.Fatalf("expected ErrRequestFailed, got %v", err)
+	}
+	if _, err := restricted.SignStream(ctx, strings.NewReader(string(dsse.PAE("application/octet-stream", []byte("payload"))))); !errors.Is(err, ErrRequestFailed) {
+		t.Fatalf("expected ErrRequestFailed signing digest, got %v", err)
+	}
+}
+
+func TestSignerInvalidSignature(t *testing.T) {
+	dir := t.TempDir()
+	ref, opts := newService(t, &swappedSigner{Signer: essdssh.NewSignerForTest(t, dir, "key"), other: essdssh.NewSignerForTest(t, dir, "other")})
+	ctx := context.Background()
+
+	signer, err := NewSigner(ctx, ref, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pae := dsse.PAE("text/plain", []byte("payload"))
+	if _, err := signer.Sign(ctx, pae); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+	if _, err := signer.SignStream(ctx, strings.NewReader(string(pae))); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature signing stream, got %v", err)
+	}
+}
+
+func TestNewSignerUnauthenticated(t *testing.T) {
+	ref, opts := newService(t, essdssh.NewSignerForTest(t, t.TempDir(), "key"))
+	opts.TokenPath = ""
+
+	if _, err := NewSigner(context.Background(), ref, opts); !errors.Is(err, ErrRequestFailed) {
+		t.Fatalf("expected ErrRequestFailed, got %v", err)
+	}
+}
+
+func TestNewSignerInvalidReference(t *testing.T) {
+	for _, ref := range []string{"signer.example.com", "remote://", "remote://signer.example.com?key=a"} {
+		if _, err := NewSigner(context.Background(), ref, &Options{}); !errors.Is(err, ErrInvalidReference) {
+			t.Fatalf("expected ErrInvalidReference for '%s', got %v", ref, err)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/adityasaky/essd/internal/admission"
+	"github.com/adityasaky/essd/internal/oci"
+	"github.com/adityasaky/essd/internal/policy"
+)
+
+const (
+	OutcomeAdmitted = "admitted"
+
+	// AnyNamespace matches namespaces without a policy of their own.
+	AnyNamespace = "*"
+)
+
+func (s *Server) handleAdmit(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.config.MaxRequestSize))
+	if err != nil {
+		s.metrics.admissions.WithLabelValues(OutcomeInvalid, "").Inc()
+		maxBytesErr := &http.MaxBytesError{}
+		if errors.As(err, &maxBytesErr) {
+			writeText(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request exceeds %d bytes", maxBytesErr.Limit))
+			return
+		}
+		writeText(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	review, err := admission.Parse(body)
+	if err != nil {
+		s.metrics.admissions.WithLabelValues(OutcomeInvalid, "").Inc()
+		writeText(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	policyName, err := s.admit(r.Context(), review.Request)
+	if err != nil {
+		s.metrics.admissions.WithLabelValues(OutcomeDenied, policyName).Inc()
+		slog.Info("Denied admission", slog.String("kind", review.Request.Kind.Kind), slog.String("namespace", review.Request.Namespace), slog.String("name", review.Request.Name), slog.Any("error", err))
+		writeJSON(w, http.StatusOK, admission.NewResponse(review, false, err.Error()))
+		return
+	}
+	s.metrics.admissions.WithLabelValues(OutcomeAdmitted, policyName).Inc()
+	writeJSON(w, http.StatusOK, admission.NewResponse(review, true, ""))
+}
+
+/*
+admit verifies the images of the object in the request against the policy of
+its namespace, and returns the name of the policy. Objects in namespaces
+without a policy, objects that do not run containers, and operations other
+than creating and updating objects are admitted without verification.
+*/
+func (s *Server) admit(ctx context.Context, request *admission.Request) (string, error) {
+	if request.Operation != admission.OperationCreate && request.Operation != admission.OperationUpdate {
+		return "", nil
+	}
+
+	policyName, enforced := s.config.NamespacePolicies[request.Namespace]
+	if !enforced {
+		policyName, enforced = s.config.NamespacePolicies[AnyNamespace]
+	}
+	if !enforced {
+		return "", nil
+	}
+
+	images, err := request.Images()
+	if errors.Is(err, admission.ErrUnsupportedResource) {
+		return policyName, nil
+	} else if err != nil {
+		return policyName, err
+	}
+
+	p := s.state.Load().policies[policyName]
+	client := oci.NewClient(ctx, s.config.InsecureRegistries)
+	denied := []string{}
+	for _, image := range images {
+		if err := verifyImage(ctx, client, p, image); err != nil {
+			denied = append(denied, fmt.Sprintf("image '%s': %s", image, err))
+		}
+	}
+	if len(denied) > 0 {
+		return policyName, fmt.Errorf("denied by policy '%s': %s", policyName, strings.Join(denied, "; "))
+	}
+	return policyName, nil
+}
+
+// verifyImage checks that at least one envelope attached to the image holds
+// an in-toto statement that records the image's digest as a subject and
+// satisfies the policy. Envelopes with other payload types are rejected, as
+// they could have been copied from another image.
+func verifyImage(ctx context.Context, client *oci.Client, p *policy.Policy, image string) error {
+	subject, err := client.Resolve(image)
+	if err != nil {
+		return fmt.Errorf("unable to resolve image: %w", err)
+	}
+	attached, err := client.Envelopes(subject)
+	if err != nil {
+		return fmt.Errorf("unable to fetch attached envelopes: %w", err)
+	}
+	if len(attached) == 0 {
+		return errors.New("no envelopes are attached")
+	}
+
+	failures := []string{}
+	for _, artifact := range attached {
+		if artifact.Err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", artifact.Digest.DigestStr(), artifact.Err))
+			continue
+		}
+
+		if err := oci.CheckSubject(artifact.Envelope, subject); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", artifact.Digest.DigestStr(), err))
+			continue
+		}
+
+		result, err := p.Verify(ctx, artifact.Envelope)
+		if err == nil {
+			err = result.Err()
+		}
+		if err == nil {
+			return nil
+		}
+		failures = append(failures, fmt.Sprintf("%s: %s", artifact.Digest.DigestStr(), err))
+	}
+	return fmt.Errorf("no attached envelope satisfies the policy (%s)", strings.Join(failures, "; "))
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adityasaky/essd/internal/admission"
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/intoto"
+	"github.com/adityasaky/essd/internal/oci"
+	essdssh "github.com/adityasaky/essd/internal/ssh"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	ita1 "github.com/in-toto/attestation/go/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const releasePolicy = `version: 1
+keys:
+  alice: alice.pub
+payloadTypes:
+  application/vnd.in-toto+json:
+    signers: [alice]
+  text/plain:
+    signers: [alice]
+`
+
+// pushImage pushes a random image to the registry as repository:v1, and
+// returns its reference and digest.
+func pushImage(t *testing.T, registryHost, repository string) (string, string) {
+	t.Helper()
+	image, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := registryHost + "/" + repository + ":v1"
+	parsedRef, err := name.ParseReference(ref, name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(parsedRef, image); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := image.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref, digest.String()
+}
+
+// statement returns an in-toto statement whose subject has the digest.
+func statement(t *testing.T, digest string) []byte {
+	t.Helper()
+	algorithm, encoded, _ := strings.Cut(digest, ":")
+	s, err := intoto.NewStatement(
+		[]*ita1.ResourceDescriptor{{Name: "app", Digest: map[string]string{algorithm: encoded}}},
+		"https://example.com/predicate/v1",
+		&structpb.Struct{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := protojson.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payload
+}
+
+// review returns an AdmissionReview for the operation on an object of the kind
+// in the namespace, whose Pod spec runs the image.
+func review(t *testing.T, kind, namespace, operation, image string) *admission.Review {
+	t.Helper()
+	object, err := json.Marshal(map[string]any{
+		"spec": map[string]any{"containers": []map[string]string{{"name": "app", "image": image}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &admission.Review{
+		APIVersion: admission.APIVersion,
+		Kind:       admission.Kind,
+		Request: &admission.Request{
+			UID:       "uid",
+			Kind:      admission.GroupVersionKind{Version: "v1", Kind: kind},
+			Namespace: namespace,
+			Name:      "app",
+			Operation: operation,
+			Object:    object,
+		},
+	}
+}
+
+func TestAdmit(t *testing.T) {
+	registryServer := httptest.NewServer(registry.New(registry.WithReferrersSupport(true), registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(registryServer.Close)
+	registryHost := strings.TrimPrefix(registryServer.URL, "http://")
+
+	dir := t.TempDir()
+	alice := essdssh.NewSignerForTest(t, dir, "alice")
+	policyPath := filepath.Join(dir, "policy.yaml")
+	if err := os.WriteFile(policyPath, []byte(releasePolicy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only statements recording the image's digest as a subject admit it,
+	// even though the policy accepts the other envelopes
+	c := oci.NewClient(context.Background(), true)
+	bound, boundDigest := pushImage(t, registryHost, "bound")
+	unbound, unboundDigest := pushImage(t, registryHost, "unbound")
+	mismatched, _ := pushImage(t, registryHost, "mismatched")
+	unsigned, _ := pushImage(t, registryHost, "unsigned")
+	for ref, env := range map[string]*dsse.Envelope{
+		bound:      signEnvelope(t, alice, intoto.PayloadType, statement(t, boundDigest)),
+		unbound:    signEnvelope(t, alice, "text/plain", []byte(unboundDigest)),
+		mismatched: signEnvelope(t, alice, intoto.PayloadType, statement(t, boundDigest)),
+	} {
+		if _, err := c.Attach(ref, env); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := New(Config{
+		Policies:           map[string]string{"release": policyPath},
+		NamespacePolicies:  map[string]string{"prod": "release"},
+		InsecureRegistries: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s.Handler())
+	t.Cleanup(server.Close)
+
+	tests := map[string]struct {
+		review  *admission.Review
+		allowed bool
+		message string
+	}{
+		"bound statement":           {review: review(t, "Pod", "prod", admission.OperationCreate, bound), allowed: true},
+		"bound statement in update": {review: review(t, "Pod", "prod", admission.OperationUpdate, bound), allowed: true},
+		"unbound payload":           {review: review(t, "Pod", "prod", admission.OperationCreate, unbound), message: oci.ErrNotStatement.Error()},
+		"subject mismatch":          {review: review(t, "Pod", "prod", admission.OperationCreate, mismatched), message: oci.ErrSubjectNotFound.Error()},
+		"no envelopes":              {review: review(t, "Pod", "prod", admission.OperationCreate, unsigned), message: "no envelopes are attached"},
+		"namespace without policy":  {review: review(t, "Pod", "dev", admission.OperationCreate, unsigned), allowed: true},
+		"delete":                    {review: review(t, "Pod", "prod", "DELETE", unsigned), allowed: true},
+		"unsupported kind":          {review: review(t, "ConfigMap", "prod", admission.OperationCreate, unsigned), allowed: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			response := &admission.Review{}
+			if status := post(t, http.DefaultClient, server.URL+"/v1/admit", test.review, response); status != http.StatusOK {
+				t.Fatalf("unexpected status %d", status)
+			}
+			if response.Response == nil || response.Response.UID != "uid" || response.Response.Allowed != test.allowed {
+				t.Fatalf("unexpected response %+v", response.Response)
+			}
+			if !test.allowed && (response.Response.Status == nil || !strings.Contains(response.Response.Status.Message, test.message)) {
+				t.Fatalf("unexpected status %+v, expected message containing '%s'", response.Response.Status, test.message)
+			}
+		})
+	}
+
+	resp, err := http.Post(server.URL+"/v1/admit", "application/json", strings.NewReader(`{"apiVersion":"v1","kind":"Pod"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unexpected status %d for invalid review", resp.StatusCode)
+	}
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ClientsVersion is the clients file format version supported.
+	ClientsVersion = 1
+
+	// AnyPayloadType allows clients to sign payloads of every payload type.
+	AnyPayloadType = "*"
+)
+
+var ErrInvalidClients = errors.New("invalid clients file")
+
+// Clients declares the clients allowed to request signatures, as declared in
+// a clients file.
+type Clients struct {
+	Version int `json:"version"`
+	// Clients maps client names, which are recorded in the audit log, to
+	// clients.
+	Clients map[string]*Client `json:"clients"`
+}
+
+// Client declares how a client authenticates and what it may sign. Clients
+// authenticate using a bearer token, or using a client certificate if the
+// server requests them.
+type Client struct {
+	// TokenSHA256 is the hex encoded SHA-256 digest of the client's bearer
+	// token, so that tokens are not stored by the server.
+	TokenSHA256 string `json:"tokenSHA256,omitempty"`
+	// CommonName is the common name of the subject of the client's
+	// certificate.
+	CommonName string `json:"commonName,omitempty"`
+	// PayloadTypes lists the payload types the client may request signatures
+	// for. AnyPayloadType allows every payload type.
+	PayloadTypes []string `json:"payloadTypes"`
+	// AllowDigests allows the client to request signatures for digests, whose
+	// payloads the server cannot inspect. The payload type of digest requests
+	// cannot be checked, as it is hashed into the digest by the client, so
+	// only clients allowed every payload type may sign digests.
+	AllowDigests bool `json:"allowDigests,omitempty"`
+}
+
+// LoadClients reads the clients from a YAML or JSON file.
+func LoadClients(path string) (*Clients, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	clients := &Clients{}
+	if err := yaml.UnmarshalStrict(contents, clients); err != nil {
+		return nil, fmt.Errorf("%w: unable to parse '%s': %w", ErrInvalidClients, path, err)
+	}
+	if err := clients.Validate(); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// Validate checks that the clients are well formed, and that each client is
+// authenticated differently.
+func (c *Clients) Validate() error {
+	if c.Version != ClientsVersion {
+		return fmt.Errorf("%w: unsupported version %d, expected %d", ErrInvalidClients, c.Version, ClientsVersion)
+	}
+
+	tokens := map[string]string{}
+	commonNames := map[string]string{}
+	for _, name := range c.names() {
+		client := c.Clients[name]
+		if client == nil || client.TokenSHA256 == "" && client.CommonName == "" {
+			return fmt.Errorf("%w: client '%s' must set tokenSHA256 or commonName", ErrInvalidClients, name)
+		}
+		if len(client.PayloadTypes) == 0 {
+			return fmt.Errorf("%w: no payload types are allowed for client '%s'", ErrInvalidClients, name)
+		}
+		if client.AllowDigests && !slices.Contains(client.PayloadTypes, AnyPayloadType) {
+			return fmt.Errorf("%w: client '%s' must allow payload type '%s' to sign digests, whose payload types cannot be checked", ErrInvalidClients, name, AnyPayloadType)
+		}
+
+		if client.TokenSHA256 != "" {
+			tokenHash, err := hex.DecodeString(client.TokenSHA256)
+			if err != nil || len(tokenHash) != sha256.Size {
+				return fmt.Errorf("%w: tokenSHA256 of client '%s' is not a hex encoded SHA-256 digest", ErrInvalidClients, name)
+			}
+			normalized := hex.EncodeToString(tokenHash)
+			if other, exists := tokens[normalized]; exists {
+				return fmt.Errorf("%w: clients '%s' and '%s' use the same token", ErrInvalidClients, other, name)
+			}
+			tokens[normalized] = name
+		}
+		if client.CommonName != "" {
+			if other, exists := commonNames[client.CommonName]; exists {
+				return fmt.Errorf("%w: clients '%s' and '%s' use the same common name", ErrInvalidClients, other, name)
+			}
+			commonNames[client.CommonName] = name
+		}
+	}
+
+	return nil
+}
+
+// allows indicates if the client may sign payloads of the payload type.
+func (c *Client) allows(payloadType string) bool {
+	return slices.Contains(c.PayloadTypes, AnyPayloadType) || slices.Contains(c.PayloadTypes, payloadType)
+}
+
+/*
+authenticate returns the name of the client that sent the request, and the
+client. Clients are authenticated using their verified client certificate if
+they presented one, and otherwise using their bearer token. The name is empty
+if the client could not be authenticated.
+*/
+func (c *Clients) authenticate(r *http.Request) (string, *Client) {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		commonName := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		for _, name := range c.names() {
+			if client := c.Clients[name]; client.CommonName != "" && client.CommonName == commonName {
+				return name, client
+			}
+		}
+		return "", nil
+	}
+
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return "", nil
+	}
+	tokenHash := sha256.Sum256([]byte(token))
+	for _, name := range c.names() {
+		client := c.Clients[name]
+		expected, err := hex.DecodeString(client.TokenSHA256)
+		if err != nil || client.TokenSHA256 == "" {
+			continue
+		}
+		if subtle.ConstantTimeCompare(tokenHash[:], expected) == 1 {
+			return name, client
+		}
+	}
+	return "", nil
+}
+
+func (c *Clients) names() []string {
+	names := []string{}
+	for name := range c.Clients {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadClients(t *testing.T) {
+	const tokenHash = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	tests := map[string]struct {
+		clients string
+		valid   bool
+	}{
+		"valid": {
+			clients: "version: 1\nclients:\n  ci:\n    tokenSHA256: " + tokenHash + "\n    payloadTypes: [\"*\"]\n    allowDigests: true\n  builder:\n    commonName: builder\n    payloadTypes: [text/plain]\n",
+			valid:   true,
+		},
+		// Digests are signed regardless of the payload type hashed into them,
+		// which would let the client sign payload types it is not allowed
+		"digests for restricted client": {
+			clients: "version: 1\nclients:\n  ci:\n    tokenSHA256: " + tokenHash + "\n    payloadTypes: [text/plain]\n    allowDigests: true\n",
+		},
+		"unsupported version": {
+			clients: "version: 2\nclients:\n  ci:\n    tokenSHA256: " + tokenHash + "\n    payloadTypes: [text/plain]\n",
+		},
+		"unauthenticated client": {
+			clients: "version: 1\nclients:\n  ci:\n    payloadTypes: [text/plain]\n",
+		},
+		"no payload types": {
+			clients: "version: 1\nclients:\n  ci:\n    tokenSHA256: " + tokenHash + "\n",
+		},
+		"invalid token digest": {
+			clients: "version: 1\nclients:\n  ci:\n    tokenSHA256: token\n    payloadTypes: [text/plain]\n",
+		},
+		"shared token": {
+			clients: "version: 1\nclients:\n  ci:\n    tokenSHA256: " + tokenHash + "\n    payloadTypes: [text/plain]\n  other:\n    tokenSHA256: " + tokenHash + "\n    payloadTypes: [text/plain]\n",
+		},
+		"shared common name": {
+			clients: "version: 1\nclients:\n  ci:\n    commonName: builder\n    payloadTypes: [text/plain]\n  other:\n    commonName: builder\n    payloadTypes: [text/plain]\n",
+		},
+		"unknown field": {
+			clients: "version: 1\nclients:\n  ci:\n    tokenSHA256: " + tokenHash + "\n    payloadTypes: [text/plain]\n    allowDigest: true\n",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "clients.yaml")
+			if err := os.WriteFile(path, []byte(test.clients), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadClients(path)
+			if test.valid && err != nil {
+				t.Fatal(err)
+			}
+			if !test.valid && !errors.Is(err, ErrInvalidClients) {
+				t.Fatalf("expected ErrInvalidClients, got %v", err)
+			}
+		})
+	}
+}
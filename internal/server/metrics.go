@@ -0,0 +1,64 @@
+package server
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const (
+	reloadSuccess = "success"
+	reloadFailure = "failure"
+)
+
+// metrics holds the server's Prometheus metrics, which are registered with
+// their own registry rather than the global one.
+type metrics struct {
+	registry      *prometheus.Registry
+	verifications *prometheus.CounterVec
+	duration      prometheus.Histogram
+	reloads       *prometheus.CounterVec
+	signatures    *prometheus.CounterVec
+	admissions    *prometheus.CounterVec
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		verifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "essd_verifications_total",
+			Help: "Number of verification requests by outcome and policy.",
+		}, []string{"outcome", "policy"}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "essd_verification_duration_seconds",
+			Help:    "Duration of verification requests.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		reloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "essd_config_reloads_total",
+			Help: "Number of reloads of policies and keys by result.",
+		}, []string{"result"}),
+		signatures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "essd_signatures_total",
+			Help: "Number of signing requests by outcome and client.",
+		}, []string{"outcome", "client"}),
+		admissions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "essd_admissions_total",
+			Help: "Number of admission requests by outcome and policy.",
+		}, []string{"outcome", "policy"}),
+	}
+
+	// Reloads are exposed before the first one happens
+	m.reloads.WithLabelValues(reloadSuccess)
+	m.reloads.WithLabelValues(reloadFailure)
+
+	m.registry.MustRegister(
+		m.verifications,
+		m.duration,
+		m.reloads,
+		m.signatures,
+		m.admissions,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
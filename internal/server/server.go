@@ -0,0 +1,441 @@
+// Package server implements the essd HTTP API, which verifies DSSE envelopes
+// against the policies and keys the server is configured with.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/key"
+	"github.com/adityasaky/essd/internal/policy"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefaultMaxRequestSize is the default limit of the size of request bodies.
+const DefaultMaxRequestSize = 10 << 20
+
+const (
+	OutcomeVerified = "verified"
+	OutcomeRejected = "rejected"
+	OutcomeInvalid  = "invalid"
+	OutcomeError    = "error"
+)
+
+var (
+	ErrNoPolicyOrKey = errors.New("no policies, keys, or signer configured")
+	ErrNoClients     = errors.New("no clients file configured for signer")
+	ErrUnknownPolicy = errors.New("unknown policy")
+	ErrUnknownKey    = errors.New("unknown key")
+)
+
+// Config declares the policies and keys the server verifies envelopes with.
+type Config struct {
+	// Policies maps policy names to the paths of policy files.
+	Policies map[string]string
+	// Keys maps key names to key references, either paths of SSH keys or
+	// Sigstore identities in the form fulcio:<identity>::<issuer>.
+	Keys map[string]string
+	// MaxRequestSize is the limit of the size of request bodies in bytes.
+	MaxRequestSize int64
+
+	// Signer, if set, signs payloads for the clients declared in the file at
+	// ClientsPath. Signers that implement dsse.DigestSigner also sign digests,
+	// and signers that implement dsse.Verifier publish their public key.
+	Signer      dsse.Signer
+	ClientsPath string
+	// AuditLog is where signing requests are recorded, as JSON lines.
+	AuditLog io.Writer
+
+	// NamespacePolicies maps namespaces to the names of the policies the
+	// images of workloads in them are verified against when reviewing
+	// admission requests. AnyNamespace matches namespaces that are not listed.
+	NamespacePolicies map[string]string
+	// InsecureRegistries allows accessing registries over plain HTTP.
+	InsecureRegistries bool
+}
+
+// VerifyRequest is the body of a verification request. Exactly one of Policy
+// and Keys must be set.
+type VerifyRequest struct {
+	// Policy is the name of the policy the envelope is evaluated against.
+	Policy string `json:"policy,omitempty"`
+	// Keys lists the names of the keys whose signatures are verified.
+	Keys []string `json:"keys,omitempty"`
+	// Threshold is the number of keys whose signatures are required. It
+	// defaults to 1, and is only used with Keys.
+	Threshold int `json:"threshold,omitempty"`
+	// Envelope is the DSSE envelope in the JSON or protojson encoding.
+	Envelope json.RawMessage `json:"envelope"`
+}
+
+// VerifyResponse is the result of a verification request.
+type VerifyResponse struct {
+	Verified    bool     `json:"verified"`
+	Policy      string   `json:"policy,omitempty"`
+	PayloadType string   `json:"payloadType,omitempty"`
+	Signers     []Signer `json:"signers"`
+	Checks      []Check  `json:"checks"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// Signer describes a signer whose signature was verified.
+type Signer struct {
+	KeyID      string   `json:"keyid"`
+	Name       string   `json:"name"`
+	Identity   string   `json:"identity,omitempty"`
+	Issuer     string   `json:"issuer,omitempty"`
+	Timestamps []string `json:"timestamps,omitempty"`
+}
+
+// Check is the outcome of evaluating a single rule.
+type Check struct {
+	Rule    string `json:"rule"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message"`
+}
+
+// state holds the policies and keys loaded from the configured files, which
+// are replaced as a whole when the files change.
+type state struct {
+	policies map[string]*policy.Policy
+	// keys holds the verifiers of SSH keys. Verifiers of Sigstore identities
+	// hold the state of the signature being verified, so they are created for
+	// each request instead.
+	keys map[string]dsse.Verifier
+	// clients is only set if the server has a signer.
+	clients *Clients
+}
+
+// Server verifies envelopes received over HTTP.
+type Server struct {
+	config   Config
+	state    atomic.Pointer[state]
+	draining atomic.Bool
+	metrics  *metrics
+	auditLog *slog.Logger
+}
+
+// New creates a server for the configuration, loading its policies and keys.
+func New(config Config) (*Server, error) {
+	if len(config.Policies) == 0 && len(config.Keys) == 0 && config.Signer == nil {
+		return nil, ErrNoPolicyOrKey
+	}
+	if config.Signer != nil && config.ClientsPath == "" {
+		return nil, ErrNoClients
+	}
+	for namespace, name := range config.NamespacePolicies {
+		if _, exists := config.Policies[name]; !exists {
+			return nil, fmt.Errorf("%w '%s' for namespace '%s'", ErrUnknownPolicy, name, namespace)
+		}
+	}
+	if config.MaxRequestSize <= 0 {
+		config.MaxRequestSize = DefaultMaxRequestSize
+	}
+	if config.AuditLog == nil {
+		config.AuditLog = os.Stderr
+	}
+
+	s := &Server{
+		config:   config,
+		metrics:  newMetrics(),
+		auditLog: slog.New(slog.NewJSONHandler(config.AuditLog, nil)),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load loads the policies and keys, replacing those in use only if all of them
+// load successfully.
+func (s *Server) load() error {
+	loaded := &state{policies: map[string]*policy.Policy{}, keys: map[string]dsse.Verifier{}}
+	for name, path := range s.config.Policies {
+		p, err := policy.Load(path)
+		if err != nil {
+			return fmt.Errorf("unable to load policy '%s': %w", name, err)
+		}
+		if err := p.Preload(); err != nil {
+			return fmt.Errorf("unable to load policy '%s': %w", name, err)
+		}
+		loaded.policies[name] = p
+	}
+
+	for name, ref := range s.config.Keys {
+		verifier, err := key.NewVerifier(ref)
+		if err != nil {
+			return fmt.Errorf("unable to load key '%s': %w", name, err)
+		}
+		if !isSigstore(ref) {
+			loaded.keys[name] = verifier
+		}
+	}
+
+	if s.config.Signer != nil {
+		clients, err := LoadClients(s.config.ClientsPath)
+		if err != nil {
+			return fmt.Errorf("unable to load clients: %w", err)
+		}
+		loaded.clients = clients
+	}
+
+	s.state.Store(loaded)
+	return nil
+}
+
+// Drain marks the server as not ready, so that load balancers stop routing
+// requests to it before it shuts down.
+func (s *Server) Drain() {
+	s.draining.Store(true)
+}
+
+/*
+Handler returns the handler of the server's endpoints:
+
+	POST /v1/verify  verifies an envelope
+	GET  /v1/signer  describes the signer, if the server has one
+	POST /v1/sign    signs a payload or digest, if the server has a signer
+	POST /v1/admit   reviews Kubernetes admission requests, if namespaces
+	                 have policies
+	GET  /healthz    reports that the server is running
+	GET  /readyz     reports whether the server accepts requests
+	GET  /metrics    exposes Prometheus metrics
+*/
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/verify", s.handleVerify)
+	if s.config.Signer != nil {
+		mux.HandleFunc("GET /v1/signer", s.handleSigner)
+		mux.HandleFunc("POST /v1/sign", s.handleSign)
+	}
+	if len(s.config.NamespacePolicies) > 0 {
+		mux.HandleFunc("POST /v1/admit", s.handleAdmit)
+	}
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		writeText(w, http.StatusOK, "ok")
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if s.draining.Load() || s.state.Load() == nil {
+			writeText(w, http.StatusServiceUnavailable, "not ready")
+			return
+		}
+		writeText(w, http.StatusOK, "ready")
+	})
+	mux.Handle("GET /metrics", promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{}))
+	return mux
+}
+
+func (s *Server) handleVerify(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	status, response := s.verify(r.Context(), http.MaxBytesReader(w, r.Body, s.config.MaxRequestSize))
+
+	outcome := OutcomeVerified
+	switch {
+	case status >= http.StatusInternalServerError:
+		outcome = OutcomeError
+	case status >= http.StatusBadRequest:
+		outcome = OutcomeInvalid
+	case !response.Verified:
+		outcome = OutcomeRejected
+	}
+	// Only configured policies are used as labels, to bound their number
+	s.metrics.verifications.WithLabelValues(outcome, response.Policy).Inc()
+	s.metrics.duration.Observe(time.Since(start).Seconds())
+
+	writeJSON(w, status, response)
+}
+
+// verify decodes the request from body and verifies its envelope, returning
+// the response and its status code.
+func (s *Server) verify(ctx context.Context, body io.Reader) (int, *VerifyResponse) {
+	request := &VerifyRequest{}
+	response := &VerifyResponse{Signers: []Signer{}, Checks: []Check{}}
+	fail := func(status int, err error) (int, *VerifyResponse) {
+		response.Error = err.Error()
+		return status, response
+	}
+
+	if status, err := decodeJSON(body, request); err != nil {
+		return fail(status, err)
+	}
+	if (request.Policy == "") == (len(request.Keys) == 0) {
+		return fail(http.StatusBadRequest, errors.New("invalid request: exactly one of policy and keys must be set"))
+	}
+	if len(request.Envelope) == 0 {
+		return fail(http.StatusBadRequest, errors.New("invalid request: envelope is not set"))
+	}
+
+	env, _, err := dsse.Unmarshal(request.Envelope)
+	if err != nil {
+		return fail(http.StatusBadRequest, fmt.Errorf("invalid envelope: %w", err))
+	}
+	response.PayloadType = env.PayloadType
+
+	current := s.state.Load()
+	if request.Policy != "" {
+		p, exists := current.policies[request.Policy]
+		if !exists {
+			return fail(http.StatusNotFound, fmt.Errorf("%w '%s'", ErrUnknownPolicy, request.Policy))
+		}
+		response.Policy = request.Policy
+
+		result, err := p.Verify(ctx, env)
+		if err != nil {
+			return fail(http.StatusInternalServerError, err)
+		}
+		response.Verified = result.Passed()
+		response.Signers = newSigners(result.Signers)
+		for _, check := range result.Checks {
+			response.Checks = append(response.Checks, Check{Rule: check.Rule, Passed: check.Passed, Message: check.Message})
+		}
+		if err := result.Err(); err != nil {
+			response.Error = err.Error()
+		}
+		return http.StatusOK, response
+	}
+
+	return s.verifyKeys(ctx, current, request, env, response)
+}
+
+// verifyKeys verifies the envelope's signatures by the requested keys.
+func (s *Server) verifyKeys(ctx context.Context, current *state, request *VerifyRequest, env *dsse.Envelope, response *VerifyResponse) (int, *VerifyResponse) {
+	threshold := request.Threshold
+	if threshold == 0 {
+		threshold = 1
+	}
+	if threshold < 0 || threshold > len(request.Keys) {
+		response.Error = fmt.Sprintf("invalid request: threshold %d must be between 1 and the number of keys", threshold)
+		return http.StatusBadRequest, response
+	}
+
+	verifiers := []dsse.Verifier{}
+	for _, name := range request.Keys {
+		verifier, err := s.keyVerifier(current, name)
+		if err != nil {
+			response.Error = err.Error()
+			if errors.Is(err, ErrUnknownKey) {
+				return http.StatusNotFound, response
+			}
+			return http.StatusInternalServerError, response
+		}
+		verifiers = append(verifiers, verifier)
+	}
+
+	envVerifier, err := dsse.NewMultiEnvelopeVerifier(threshold, verifiers...)
+	if err != nil {
+		response.Error = err.Error()
+		return http.StatusInternalServerError, response
+	}
+	acceptedKeys, verifyErr := envVerifier.Verify(ctx, env)
+	signers, err := key.VerifiedSigners(acceptedKeys, verifiers, request.Keys)
+	if err != nil {
+		response.Error = err.Error()
+		return http.StatusInternalServerError, response
+	}
+
+	response.Verified = verifyErr == nil
+	response.Signers = newSigners(signers)
+	check := Check{Rule: policy.RuleThreshold, Passed: verifyErr == nil}
+	if verifyErr != nil {
+		check.Message = verifyErr.Error()
+		response.Error = verifyErr.Error()
+	} else {
+		check.Message = fmt.Sprintf("%d of %d required signatures verified", len(acceptedKeys), threshold)
+	}
+	response.Checks = append(response.Checks, check)
+	return http.StatusOK, response
+}
+
+func (s *Server) keyVerifier(current *state, name string) (dsse.Verifier, error) {
+	ref, exists := s.config.Keys[name]
+	if !exists {
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownKey, name)
+	}
+	if isSigstore(ref) {
+		return key.NewVerifier(ref)
+	}
+	return current.keys[name], nil
+}
+
+// watchedPaths returns the paths of the files the server loads.
+func (s *Server) watchedPaths() []string {
+	paths := []string{}
+	for _, path := range s.config.Policies {
+		paths = append(paths, path)
+	}
+	for _, ref := range s.config.Keys {
+		if !isSigstore(ref) {
+			paths = append(paths, ref)
+		}
+	}
+	if s.config.Signer != nil {
+		paths = append(paths, s.config.ClientsPath)
+	}
+	for _, p := range s.state.Load().policies {
+		paths = append(paths, p.KeyPaths()...)
+	}
+	slices.Sort(paths)
+	return slices.Compact(paths)
+}
+
+func newSigners(verified []key.VerifiedSigner) []Signer {
+	signers := []Signer{}
+	for _, signer := range verified {
+		timestamps := []string{}
+		for _, timestamp := range signer.Timestamps {
+			timestamps = append(timestamps, timestamp.Format(time.RFC3339))
+		}
+		signers = append(signers, Signer{
+			KeyID:      signer.KeyID,
+			Name:       signer.Name,
+			Identity:   signer.Identity,
+			Issuer:     signer.Issuer,
+			Timestamps: timestamps,
+		})
+	}
+	return signers
+}
+
+func isSigstore(ref string) bool {
+	return strings.HasPrefix(strings.TrimSpace(ref), key.SigstorePrefix)
+}
+
+// decodeJSON decodes the request body, returning the status code to respond
+// with if it is invalid.
+func decodeJSON(body io.Reader, request any) (int, error) {
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(request); err != nil {
+		maxBytesErr := &http.MaxBytesError{}
+		if errors.As(err, &maxBytesErr) {
+			return http.StatusRequestEntityTooLarge, fmt.Errorf("request exceeds %d bytes", maxBytesErr.Limit)
+		}
+		return http.StatusBadRequest, fmt.Errorf("invalid request: %w", err)
+	}
+	return http.StatusOK, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Debug("Unable to write response", slog.Any("error", err))
+	}
+}
+
+func writeText(w http.ResponseWriter, status int, text string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintln(w, text) //nolint:errcheck
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	essdssh "github.com/adityasaky/essd/internal/ssh"
+)
+
+const textPolicy = `version: 1
+keys:
+  alice: alice.pub
+payloadTypes:
+  text/plain:
+    signers: [alice]
+`
+
+func signEnvelope(t *testing.T, signer dsse.Signer, payloadType string, payload []byte) *dsse.Envelope {
+	t.Helper()
+	envSigner, err := dsse.NewEnvelopeSigner(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := envSigner.SignPayload(context.Background(), payloadType, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+// post sends the request as JSON to the URL, and decodes the response into
+// response, returning its status code.
+func post(t *testing.T, client *http.Client, url string, request, response any) int {
+	t.Helper()
+	body, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+// newVerifyServer starts a server verifying envelopes using the policy named
+// text and the keys named alice and bob, and returns it, its URL, and signers
+// for the keys.
+func newVerifyServer(t *testing.T) (*Server, string, *essdssh.Signer, *essdssh.Signer) {
+	t.Helper()
+	dir := t.TempDir()
+	alice := essdssh.NewSignerForTest(t, dir, "alice")
+	bob := essdssh.NewSignerForTest(t, dir, "bob")
+	policyPath := filepath.Join(dir, "policy.yaml")
+	if err := os.WriteFile(policyPath, []byte(textPolicy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(Config{
+		Policies:       map[string]string{"text": policyPath},
+		Keys:           map[string]string{"alice": alice.Path + ".pub", "bob": bob.Path + ".pub"},
+		MaxRequestSize: 4096,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s.Handler())
+	t.Cleanup(server.Close)
+	return s, server.URL, alice, bob
+}
+
+func TestVerify(t *testing.T) {
+	_, url, alice, bob := newVerifyServer(t)
+	byAlice := signEnvelope(t, alice, "text/plain", []byte("payload"))
+	byBob := signEnvelope(t, bob, "text/plain", []byte("payload"))
+
+	tests := map[string]struct {
+		request  *VerifyRequest
+		env      *dsse.Envelope
+		verified bool
+		signers  []string
+	}{
+		"policy": {
+			request:  &VerifyRequest{Policy: "text"},
+			env:      byAlice,
+			verified: true,
+			signers:  []string{"alice"},
+		},
+		"policy with untrusted signer": {
+			request: &VerifyRequest{Policy: "text"},
+			env:     byBob,
+		},
+		"keys": {
+			request:  &VerifyRequest{Keys: []string{"bob", "alice"}},
+			env:      byAlice,
+			verified: true,
+			signers:  []string{"alice"},
+		},
+		"keys below threshold": {
+			request: &VerifyRequest{Keys: []string{"bob", "alice"}, Threshold: 2},
+			env:     byAlice,
+			signers: []string{"alice"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			envBytes, err := json.Marshal(test.env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.request.Envelope = envBytes
+
+			response := &VerifyResponse{}
+			if status := post(t, http.DefaultClient, url+"/v1/verify", test.request, response); status != http.StatusOK {
+				t.Fatalf("unexpected status %d: %s", status, response.Error)
+			}
+			if response.Verified != test.verified || response.PayloadType != "text/plain" {
+				t.Fatalf("unexpected response %+v", response)
+			}
+			if test.verified != (response.Error == "") {
+				t.Fatalf("unexpected error '%s'", response.Error)
+			}
+			signers := []string{}
+			for _, signer := range response.Signers {
+				signers = append(signers, signer.Name)
+			}
+			if strings.Join(signers, ",") != strings.Join(test.signers, ",") {
+				t.Fatalf("unexpected signers %v", signers)
+			}
+		})
+	}
+}
+
+func TestVerifyInvalidRequest(t *testing.T) {
+	_, url, alice, _ := newVerifyServer(t)
+	env, err := json.Marshal(signEnvelope(t, alice, "text/plain", []byte("payload")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		request any
+		status  int
+	}{
+		"unknown policy":       {&VerifyRequest{Policy: "other", Envelope: env}, http.StatusNotFound},
+		"unknown key":          {&VerifyRequest{Keys: []string{"carol"}, Envelope: env}, http.StatusNotFound},
+		"policy and keys":      {&VerifyRequest{Policy: "text", Keys: []string{"alice"}, Envelope: env}, http.StatusBadRequest},
+		"no policy or keys":    {&VerifyRequest{Envelope: env}, http.StatusBadRequest},
+		"no envelope":          {&VerifyRequest{Policy: "text"}, http.StatusBadRequest},
+		"invalid envelope":     {&VerifyRequest{Policy: "text", Envelope: json.RawMessage(`"envelope"`)}, http.StatusBadRequest},
+		"threshold above keys": {&VerifyRequest{Keys: []string{"alice"}, Threshold: 2, Envelope: env}, http.StatusBadRequest},
+		"unknown field":        {map[string]any{"policy": "text", "envelope": env, "other": true}, http.StatusBadRequest},
+		"too large":            {&VerifyRequest{Policy: "text", Envelope: env, Keys: []string{strings.Repeat("a", 4096)}}, http.StatusRequestEntityTooLarge},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			response := &VerifyResponse{}
+			if status := post(t, http.DefaultClient, url+"/v1/verify", test.request, response); status != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, status, response.Error)
+			}
+			if response.Verified || response.Error == "" {
+				t.Fatalf("unexpected response %+v", response)
+			}
+		})
+	}
+}
+
+func TestHealth(t *testing.T) {
+	s, url, _, _ := newVerifyServer(t)
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(url + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close() //nolint:errcheck
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	if status, _ := get("/healthz"); status != http.StatusOK {
+		t.Fatalf("unexpected healthz status %d", status)
+	}
+	if status, _ := get("/readyz"); status != http.StatusOK {
+		t.Fatalf("unexpected readyz status %d", status)
+	}
+	// Signing endpoints are only served with a signer
+	if status, _ := get("/v1/signer"); status != http.StatusNotFound {
+		t.Fatalf("unexpected signer status %d", status)
+	}
+
+	s.Drain()
+	if status, _ := get("/readyz"); status != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected readyz status %d once draining", status)
+	}
+	if status, _ := get("/healthz"); status != http.StatusOK {
+		t.Fatalf("unexpected healthz status %d once draining", status)
+	}
+
+	if _, metrics := get("/metrics"); !strings.Contains(metrics, "essd_config_reloads_total") {
+		t.Fatal("metrics do not include reloads")
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	if _, err := New(Config{}); !errors.Is(err, ErrNoPolicyOrKey) {
+		t.Fatalf("expected ErrNoPolicyOrKey, got %v", err)
+	}
+	if _, err := New(Config{Signer: nopSigner{}}); !errors.Is(err, ErrNoClients) {
+		t.Fatalf("expected ErrNoClients, got %v", err)
+	}
+	if _, err := New(Config{Keys: map[string]string{"alice": "alice.pub"}, NamespacePolicies: map[string]string{"default": "text"}}); !errors.Is(err, ErrUnknownPolicy) {
+		t.Fatalf("expected ErrUnknownPolicy, got %v", err)
+	}
+
+	// Servers do not start with policies that cannot be loaded
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte("version: 2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(Config{Policies: map[string]string{"text": path}}); err == nil || !strings.Contains(err.Error(), "'text'") {
+		t.Fatalf("expected error loading policy, got %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/signapi"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	OutcomeSigned = "signed"
+	OutcomeDenied = "denied"
+
+	modePayload = "payload"
+	modeDigest  = "digest"
+)
+
+// signRecord is a signing request as recorded in the audit log and metrics.
+type signRecord struct {
+	client      string
+	payloadType string
+	mode        string
+	digest      string
+	outcome     string
+	err         error
+}
+
+func (s *Server) handleSigner(w http.ResponseWriter, r *http.Request) {
+	if name, _ := s.state.Load().clients.authenticate(r); name == "" {
+		writeUnauthorized(w)
+		return
+	}
+
+	keyID, err := s.config.Signer.KeyID()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, &signapi.SignResponse{Error: err.Error()})
+		return
+	}
+	response := &signapi.SignerResponse{KeyID: keyID}
+	if verifier, ok := s.config.Signer.(dsse.Verifier); ok {
+		if pub, err := ssh.NewPublicKey(verifier.Public()); err == nil {
+			response.PublicKey = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+		}
+	}
+	if digestSigner, ok := s.config.Signer.(dsse.DigestSigner); ok {
+		response.DigestAlgorithm = signapi.DigestName(digestSigner.DigestAlgorithm())
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleSign(w http.ResponseWriter, r *http.Request) {
+	record := &signRecord{}
+	status, response := s.sign(r, http.MaxBytesReader(w, r.Body, s.config.MaxRequestSize), record)
+
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		record.outcome = OutcomeDenied
+	case status >= http.StatusInternalServerError:
+		record.outcome = OutcomeError
+	case status >= http.StatusBadRequest:
+		record.outcome = OutcomeInvalid
+	default:
+		record.outcome = OutcomeSigned
+	}
+	s.metrics.signatures.WithLabelValues(record.outcome, record.client).Inc()
+	s.audit(r, record, response)
+
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	writeJSON(w, status, response)
+}
+
+// sign authenticates the client, decodes the request from body and signs it,
+// returning the response and its status code.
+func (s *Server) sign(r *http.Request, body io.Reader, record *signRecord) (int, *signapi.SignResponse) {
+	fail := func(status int, err error) (int, *signapi.SignResponse) {
+		record.err = err
+		return status, &signapi.SignResponse{Error: err.Error()}
+	}
+
+	name, client := s.state.Load().clients.authenticate(r)
+	if name == "" {
+		return fail(http.StatusUnauthorized, errors.New("client is not authenticated"))
+	}
+	record.client = name
+
+	request := &signapi.SignRequest{}
+	if status, err := decodeJSON(body, request); err != nil {
+		return fail(status, err)
+	}
+	record.payloadType = request.PayloadType
+	if request.PayloadType == "" {
+		return fail(http.StatusBadRequest, errors.New("invalid request: payloadType is not set"))
+	}
+	if (request.Payload == nil) == (request.Digest == nil) {
+		return fail(http.StatusBadRequest, errors.New("invalid request: exactly one of payload and digest must be set"))
+	}
+	if !client.allows(request.PayloadType) {
+		return fail(http.StatusForbidden, fmt.Errorf("client '%s' may not sign payload type '%s'", name, request.PayloadType))
+	}
+
+	keyID, err := s.config.Signer.KeyID()
+	if err != nil {
+		return fail(http.StatusInternalServerError, err)
+	}
+
+	var sig []byte
+	if request.Payload != nil {
+		record.mode = modePayload
+		paeEnc := dsse.PAE(request.PayloadType, request.Payload)
+		paeDigest := sha256.Sum256(paeEnc)
+		record.digest = "sha256:" + hex.EncodeToString(paeDigest[:])
+
+		sig, err = s.config.Signer.Sign(r.Context(), paeEnc)
+	} else {
+		record.mode = modeDigest
+		if !client.AllowDigests {
+			return fail(http.StatusForbidden, fmt.Errorf("client '%s' may not sign digests", name))
+		}
+		digestSigner, ok := s.config.Signer.(dsse.DigestSigner)
+		if !ok {
+			return fail(http.StatusBadRequest, errors.New("signer cannot sign digests"))
+		}
+
+		algorithm := signapi.DigestName(digestSigner.DigestAlgorithm())
+		encoded, exists := request.Digest[algorithm]
+		if !exists || len(request.Digest) != 1 {
+			return fail(http.StatusBadRequest, fmt.Errorf("invalid request: digest must only be computed using %s", algorithm))
+		}
+		digest, err := hex.DecodeString(encoded)
+		if err != nil || len(digest) != digestSigner.DigestAlgorithm().Size() {
+			return fail(http.StatusBadRequest, fmt.Errorf("invalid request: invalid %s digest", algorithm))
+		}
+		record.digest = algorithm + ":" + hex.EncodeToString(digest)
+
+		sig, err = digestSigner.SignDigest(r.Context(), digest)
+	}
+	if err != nil {
+		return fail(http.StatusInternalServerError, fmt.Errorf("unable to sign: %w", err))
+	}
+
+	return http.StatusOK, &signapi.SignResponse{KeyID: keyID, Sig: base64.StdEncoding.EncodeToString(sig)}
+}
+
+// audit records the signing request in the audit log.
+func (s *Server) audit(r *http.Request, record *signRecord, response *signapi.SignResponse) {
+	attrs := []any{
+		slog.String("client", record.client),
+		slog.String("remoteAddr", r.RemoteAddr),
+		slog.String("outcome", record.outcome),
+	}
+	if record.payloadType != "" {
+		attrs = append(attrs, slog.String("payloadType", record.payloadType))
+	}
+	if record.mode != "" {
+		attrs = append(attrs, slog.String("mode", record.mode))
+	}
+	if record.digest != "" {
+		attrs = append(attrs, slog.String("digest", record.digest))
+	}
+	if response.KeyID != "" {
+		attrs = append(attrs, slog.String("keyid", response.KeyID))
+	}
+	if record.err != nil {
+		attrs = append(attrs, slog.String("error", record.err.Error()))
+	}
+	s.auditLog.Info("sign", attrs...)
+}
+
+func writeUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	writeJSON(w, http.StatusUnauthorized, &signapi.SignResponse{Error: "client is not authenticated"})
+}
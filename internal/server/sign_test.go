@@ -0,0 +1,263 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/signapi"
+	essdssh "github.com/adityasaky/essd/internal/ssh"
+)
+
+const signToken = "token"
+
+// clientCA issues client certificates.
+type clientCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newClientCA(t *testing.T) *clientCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "essd test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &clientCA{cert: cert, key: key}
+}
+
+// issue returns a client certificate with the common name.
+func (ca *clientCA) issue(t *testing.T, commonName string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// newSignServer starts a server signing using the signer over HTTPS, which
+// requests client certificates issued by the CA like essd serve does, for the
+// clients ci, which authenticates using signToken and may sign every payload
+// type and digests, and builder, which authenticates using its certificate and
+// may only sign text/plain payloads. The server's audit log
+// is written to auditLog.
+func newSignServer(t *testing.T, signer dsse.Signer, ca *clientCA, auditLog *bytes.Buffer) *httptest.Server {
+	t.Helper()
+	tokenHash := sha256.Sum256([]byte(signToken))
+	clients := "version: 1\nclients:\n" +
+		"  ci:\n    tokenSHA256: " + hex.EncodeToString(tokenHash[:]) + "\n    payloadTypes: [\"*\"]\n    allowDigests: true\n" +
+		"  builder:\n    commonName: builder\n    payloadTypes: [text/plain]\n"
+	clientsPath := filepath.Join(t.TempDir(), "clients.yaml")
+	if err := os.WriteFile(clientsPath, []byte(clients), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(Config{Signer: signer, ClientsPath: clientsPath, AuditLog: auditLog})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(s.Handler())
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	server.TLS = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven, MinVersion: tls.VersionTLS12}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newSignClient returns a client of the server that presents the certificate,
+// if any, and sends the token, if any.
+func newSignClient(server *httptest.Server, cert *tls.Certificate, token string) *http.Client {
+	transport := server.Client().Transport.(*http.Transport).Clone()
+	if cert != nil {
+		transport.TLSClientConfig.Certificates = []tls.Certificate{*cert}
+	}
+	return &http.Client{Transport: &tokenTransport{base: transport, token: token}}
+}
+
+type tokenTransport struct {
+	base  http.RoundTripper
+	token string
+}
+
+func (t *tokenTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if t.token != "" {
+		r = r.Clone(r.Context())
+		r.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	return t.base.RoundTrip(r)
+}
+
+func TestSigner(t *testing.T) {
+	signer := essdssh.NewSignerForTest(t, t.TempDir(), "signer")
+	ca := newClientCA(t)
+	server := newSignServer(t, signer, ca, &bytes.Buffer{})
+
+	response := &signapi.SignerResponse{}
+	resp, err := newSignClient(server, nil, "").Get(server.URL + "/v1/signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") != "Bearer" {
+		t.Fatalf("unexpected status %d for unauthenticated client", resp.StatusCode)
+	}
+
+	builderCert := ca.issue(t, "builder")
+	resp, err = newSignClient(server, &builderCert, "").Get(server.URL + "/v1/signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		t.Fatal(err)
+	}
+
+	keyID, err := signer.KeyID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.KeyID != keyID || !strings.HasPrefix(response.PublicKey, "ssh-ed25519 ") || response.DigestAlgorithm != "sha512" {
+		t.Fatalf("unexpected signer %+v", response)
+	}
+}
+
+func TestSign(t *testing.T) {
+	signer := essdssh.NewSignerForTest(t, t.TempDir(), "signer")
+	ca := newClientCA(t)
+	auditLog := &bytes.Buffer{}
+	server := newSignServer(t, signer, ca, auditLog)
+
+	builderCert := ca.issue(t, "builder")
+	unknownCert := ca.issue(t, "unknown")
+	ci := newSignClient(server, nil, signToken)
+	builder := newSignClient(server, &builderCert, "")
+
+	payload := []byte("payload")
+	paeDigest := sha512.Sum512(dsse.PAE("application/vnd.in-toto+json", payload))
+	sha512Digest := map[string]string{"sha512": hex.EncodeToString(paeDigest[:])}
+
+	tests := map[string]struct {
+		client  *http.Client
+		request *signapi.SignRequest
+		status  int
+	}{
+		"payload by token":             {ci, &signapi.SignRequest{PayloadType: "application/vnd.in-toto+json", Payload: payload}, http.StatusOK},
+		"payload by certificate":       {builder, &signapi.SignRequest{PayloadType: "text/plain", Payload: payload}, http.StatusOK},
+		"any payload type":             {ci, &signapi.SignRequest{PayloadType: "text/plain", Payload: payload}, http.StatusOK},
+		"digest":                       {ci, &signapi.SignRequest{PayloadType: "application/vnd.in-toto+json", Digest: sha512Digest}, http.StatusOK},
+		"unknown token":                {newSignClient(server, nil, "other"), &signapi.SignRequest{PayloadType: "text/plain", Payload: payload}, http.StatusUnauthorized},
+		"unknown certificate":          {newSignClient(server, &unknownCert, signToken), &signapi.SignRequest{PayloadType: "text/plain", Payload: payload}, http.StatusUnauthorized},
+		"payload type not allowed":     {builder, &signapi.SignRequest{PayloadType: "application/vnd.in-toto+json", Payload: payload}, http.StatusForbidden},
+		"digest of other payload type": {builder, &signapi.SignRequest{PayloadType: "text/plain", Digest: sha512Digest}, http.StatusForbidden},
+		"no payload type":              {ci, &signapi.SignRequest{Payload: payload}, http.StatusBadRequest},
+		"payload and digest":           {ci, &signapi.SignRequest{PayloadType: "application/vnd.in-toto+json", Payload: payload, Digest: sha512Digest}, http.StatusBadRequest},
+		"digest of other algorithm":    {ci, &signapi.SignRequest{PayloadType: "application/vnd.in-toto+json", Digest: map[string]string{"sha256": strings.Repeat("0", 64)}}, http.StatusBadRequest},
+		"digest of invalid size":       {ci, &signapi.SignRequest{PayloadType: "application/vnd.in-toto+json", Digest: map[string]string{"sha512": "00"}}, http.StatusBadRequest},
+		"digest of several algorithms": {ci, &signapi.SignRequest{PayloadType: "application/vnd.in-toto+json", Digest: map[string]string{"sha512": sha512Digest["sha512"], "sha256": strings.Repeat("0", 64)}}, http.StatusBadRequest},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			response := &signapi.SignResponse{}
+			if status := post(t, test.client, server.URL+"/v1/sign", test.request, response); status != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, status, response.Error)
+			}
+			if test.status != http.StatusOK {
+				if response.Error == "" || response.Sig != "" {
+					t.Fatalf("unexpected response %+v", response)
+				}
+				return
+			}
+
+			sig, err := base64.StdEncoding.DecodeString(response.Sig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.request.Payload != nil {
+				err = signer.Verify(context.Background(), dsse.PAE(test.request.PayloadType, test.request.Payload), sig)
+			} else {
+				err = signer.VerifyDigest(context.Background(), paeDigest[:], sig)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	// Each request is recorded in the audit log, including those denied
+	records := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSpace(auditLog.String()), "\n") {
+		record := map[string]any{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		records[record["outcome"].(string)]++
+		if record["outcome"] == OutcomeSigned && record["mode"] == modeDigest && record["digest"] != "sha512:"+sha512Digest["sha512"] {
+			t.Fatalf("unexpected audit record %v", record)
+		}
+	}
+	if records[OutcomeSigned] != 4 || records[OutcomeDenied] != 4 || records[OutcomeInvalid] != 5 {
+		t.Fatalf("unexpected audit records %v", records)
+	}
+}
+
+func TestSignDigestUnsupported(t *testing.T) {
+	ca := newClientCA(t)
+	server := newSignServer(t, nopSigner{}, ca, &bytes.Buffer{})
+
+	response := &signapi.SignResponse{}
+	request := &signapi.SignRequest{PayloadType: "application/vnd.in-toto+json", Digest: map[string]string{"sha512": strings.Repeat("0", 128)}}
+	if status := post(t, newSignClient(server, nil, signToken), server.URL+"/v1/sign", request, response); status != http.StatusBadRequest {
+		t.Fatalf("unexpected status %d: %s", status, response.Error)
+	}
+}
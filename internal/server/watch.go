@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDelay is how long changes are collected before reloading, as editors
+// and tools often update files in several steps.
+const reloadDelay = 500 * time.Millisecond
+
+/*
+Watch reloads the policies and keys when their files change, until ctx is
+done. The directories of the files are watched rather than the files
+themselves, so that files replaced by renaming, as editors do, continue to be
+watched. Files that are symlinks are also watched through their targets, and
+are reloaded when they resolve to other files, as happens when Kubernetes
+updates the ..data symlink of a ConfigMap volume. If reloading fails, the
+previously loaded policies and keys remain in use.
+*/
+func (s *Server) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close() //nolint:errcheck
+
+	watched := map[string]bool{}
+	resolved := map[string]string{}
+	watchedDirs := map[string]bool{}
+	updateWatches := func() error {
+		watched = map[string]bool{}
+		resolved = map[string]string{}
+		dirs := map[string]bool{}
+		for _, path := range s.watchedPaths() {
+			path, err := filepath.Abs(path)
+			if err != nil {
+				return err
+			}
+			watched[path] = true
+			dirs[filepath.Dir(path)] = true
+
+			// Files that do not exist yet are only watched by path
+			if target, err := filepath.EvalSymlinks(path); err == nil {
+				resolved[path] = target
+				watched[target] = true
+				dirs[filepath.Dir(target)] = true
+			}
+		}
+
+		for dir := range watchedDirs {
+			if !dirs[dir] {
+				// The directory may have been removed, which removes its watch
+				_ = watcher.Remove(dir)
+			}
+		}
+		for dir := range dirs {
+			if watchedDirs[dir] {
+				continue
+			}
+			if err := watcher.Add(dir); err != nil {
+				return fmt.Errorf("unable to watch '%s': %w", dir, err)
+			}
+		}
+		watchedDirs = dirs
+		return nil
+	}
+	// retargeted returns true if a watched file resolves to another file than
+	// when it was last watched.
+	retargeted := func() bool {
+		for path, target := range resolved {
+			if current, err := filepath.EvalSymlinks(path); err != nil || current != target {
+				return true
+			}
+		}
+		return false
+	}
+	if err := updateWatches(); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			path, err := filepath.Abs(event.Name)
+			if err != nil || !watched[path] && !retargeted() {
+				continue
+			}
+			timer.Reset(reloadDelay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Error("Error watching policies and keys", slog.Any("error", err))
+		case <-timer.C:
+			if err := s.load(); err != nil {
+				s.metrics.reloads.WithLabelValues(reloadFailure).Inc()
+				slog.Error("Unable to reload policies and keys, continuing to use those loaded previously", slog.Any("error", err))
+			} else {
+				s.metrics.reloads.WithLabelValues(reloadSuccess).Inc()
+				slog.Info("Reloaded policies and keys")
+			}
+
+			// Reloaded policies may use other keys, and files may resolve to
+			// other targets
+			if err := updateWatches(); err != nil {
+				slog.Error("Unable to watch policies and keys", slog.Any("error", err))
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// nopSigner is a signer for servers whose signing requests are not tested.
+type nopSigner struct{}
+
+func (nopSigner) Sign(context.Context, []byte) ([]byte, error) {
+	return []byte("signature"), nil
+}
+
+func (nopSigner) KeyID() (string, error) {
+	return "nop", nil
+}
+
+func writeClients(t *testing.T, path, name string) {
+	t.Helper()
+	clients := "version: 1\nclients:\n  " + name + ":\n    commonName: " + name + "\n    payloadTypes: [text/plain]\n"
+	if err := os.WriteFile(path, []byte(clients), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// watchClients starts a server with a signer for the clients file at path,
+// watching its files until the test ends.
+func watchClients(t *testing.T, path string) *Server {
+	t.Helper()
+	s, err := New(Config{Signer: nopSigner{}, ClientsPath: path, AuditLog: io.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Watch(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+
+	// Changes made before the directories are watched would be missed
+	time.Sleep(100 * time.Millisecond)
+	return s
+}
+
+func waitForClient(t *testing.T, s *Server, name string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, exists := s.state.Load().clients.Clients[name]; exists {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("clients file was not reloaded with client '%s'", name)
+}
+
+func TestWatchReplacedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "clients.yaml")
+	writeClients(t, path, "first")
+	s := watchClients(t, path)
+
+	// Editors write a new file and rename it over the original
+	writeClients(t, filepath.Join(dir, "clients.yaml.tmp"), "second")
+	if err := os.Rename(filepath.Join(dir, "clients.yaml.tmp"), path); err != nil {
+		t.Fatal(err)
+	}
+	waitForClient(t, s, "second")
+}
+
+func TestWatchConfigMap(t *testing.T) {
+	// Kubernetes ConfigMap volumes link each file to the ..data symlink,
+	// which links to a directory holding the current files
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "..v1"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	writeClients(t, filepath.Join(dir, "..v1", "clients.yaml"), "first")
+	if err := os.Symlink("..v1", filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "clients.yaml")
+	if err := os.Symlink(filepath.Join("..data", "clients.yaml"), path); err != nil {
+		t.Fatal(err)
+	}
+	s := watchClients(t, path)
+
+	// Updates write a new directory, and atomically replace ..data with a
+	// symlink to it, leaving the file's own symlink unchanged
+	if err := os.Mkdir(filepath.Join(dir, "..v2"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	writeClients(t, filepath.Join(dir, "..v2", "clients.yaml"), "second")
+	if err := os.Symlink("..v2", filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(dir, "..v1")); err != nil {
+		t.Fatal(err)
+	}
+	waitForClient(t, s, "second")
+
+	// The new directory is watched once reloaded
+	writeClients(t, filepath.Join(dir, "..v2", "clients.yaml"), "third")
+	waitForClient(t, s, "third")
+}
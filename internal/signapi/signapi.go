@@ -0,0 +1,54 @@
+// Package signapi declares the requests and responses of the essd signing
+// service's API, which is served by essd serve and used by remote:// signers.
+package signapi
+
+import "crypto"
+
+// DigestAlgorithms maps the names of digest algorithms in requests, as used in
+// in-toto digest sets, to their hash functions.
+var DigestAlgorithms = map[string]crypto.Hash{
+	"sha256": crypto.SHA256,
+	"sha384": crypto.SHA384,
+	"sha512": crypto.SHA512,
+}
+
+// SignerResponse describes the service's signer.
+type SignerResponse struct {
+	KeyID string `json:"keyid"`
+	// PublicKey is the signer's public key in the SSH authorized keys format.
+	PublicKey string `json:"publicKey,omitempty"`
+	// DigestAlgorithm is the algorithm digests must be computed with, if the
+	// signer can sign digests.
+	DigestAlgorithm string `json:"digestAlgorithm,omitempty"`
+}
+
+/*
+SignRequest is the body of a signing request, which sets either the payload, or
+the digest of the PAE encoding of the payload type and payload. Digests are
+keyed by the name of their algorithm, which must be the signer's digest
+algorithm.
+*/
+type SignRequest struct {
+	PayloadType string            `json:"payloadType"`
+	Payload     []byte            `json:"payload,omitempty"`
+	Digest      map[string]string `json:"digest,omitempty"`
+}
+
+// SignResponse is the result of a signing request. The signature is base64
+// encoded like the signatures of DSSE envelopes.
+type SignResponse struct {
+	KeyID string `json:"keyid,omitempty"`
+	Sig   string `json:"sig,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// DigestName returns the name of the digest algorithm, which is empty if the
+// algorithm is not supported.
+func DigestName(hash crypto.Hash) string {
+	for name, algorithm := range DigestAlgorithms {
+		if algorithm == hash {
+			return name
+		}
+	}
+	return ""
+}
@@ -10,12 +10,13 @@ import (
 	"context"
 	"crypto"
 	"fmt"
-	"log"
 	"log/slog"
 	"time"
 
+	"github.com/adityasaky/essd/internal/dsse"
 	protobundle "github.com/sigstore/protobuf-specs/gen/pb-go/bundle/v1"
 	protocommon "github.com/sigstore/protobuf-specs/gen/pb-go/common/v1"
+	protorekor "github.com/sigstore/protobuf-specs/gen/pb-go/rekor/v1"
 	"github.com/sigstore/sigstore-go/pkg/bundle"
 	"github.com/sigstore/sigstore-go/pkg/root"
 	"github.com/sigstore/sigstore-go/pkg/sign"
@@ -41,25 +42,51 @@ const (
 	// EnvSigstoreRekorPublicKey     = "SIGSTORE_REKOR_PUBLIC_KEY"
 
 	sigstoreBundleMimeType = "application/vnd.dev.sigstore.bundle+json;version=0.3"
-
-	fulcioURL = "https://fulcio.sigstore.dev"
-	rekorURL  = "https://rekor.sigstore.dev"
-	clientID  = "sigstore"
-	issuerURL = "https://oauth2.sigstore.dev/auth"
 )
 
+// Instance identifies the Sigstore instance signatures are created with and
+// verified against.
+type Instance struct {
+	FulcioURL     string
+	RekorURL      string
+	OIDCIssuerURL string
+	OIDCClientID  string
+	// TrustedRootPath is the path of the instance's trusted root in the
+	// trusted_root.json format. If it is not set, the trusted root of the
+	// public-good instance is fetched using TUF.
+	TrustedRootPath string
+}
+
+// DefaultInstance is the public-good Sigstore instance.
+var DefaultInstance = Instance{
+	FulcioURL:     "https://fulcio.sigstore.dev",
+	RekorURL:      "https://rekor.sigstore.dev",
+	OIDCIssuerURL: "https://oauth2.sigstore.dev/auth",
+	OIDCClientID:  "sigstore",
+}
+
+var instance = DefaultInstance
+
+// Configure sets the instance used by signers and verifiers created
+// afterwards.
+func Configure(i Instance) {
+	instance = i
+}
+
 type Verifier struct {
-	rekorURL string
-	issuer   string
-	identity string
-	ext      *structpb.Struct
+	rekorURL        string
+	trustedRootPath string
+	issuer          string
+	identity        string
+	ext             *structpb.Struct
 }
 
 func NewVerifierFromIdentityAndIssuer(identity, issuer string) *Verifier {
 	return &Verifier{
-		rekorURL: rekorURL,
-		issuer:   issuer,
-		identity: identity,
+		rekorURL:        instance.RekorURL,
+		trustedRootPath: instance.TrustedRootPath,
+		issuer:          issuer,
+		identity:        identity,
 	}
 }
 
@@ -70,7 +97,7 @@ func (v *Verifier) Verify(_ context.Context, data, sig []byte) error {
 
 	trustedRoot, _, err := v.getTUFRoot()
 	if err != nil {
-		slog.Debug(fmt.Sprintf("Error getting TUF root: %v", err))
+		slog.Debug("Unable to load Sigstore instance's root of trust", slog.Any("error", err))
 		return err
 	}
 	slog.Debug("Loaded Sigstore instance's root of trust")
@@ -92,7 +119,7 @@ func (v *Verifier) Verify(_ context.Context, data, sig []byte) error {
 
 	sev, err := verify.NewSignedEntityVerifier(trustedRoot, opts...)
 	if err != nil {
-		slog.Debug(fmt.Sprintf("Error creating signed entity verifier: %v", err))
+		slog.Debug("Unable to create signed entity verifier", slog.Any("error", err))
 		return err
 	}
 
@@ -102,13 +129,13 @@ func (v *Verifier) Verify(_ context.Context, data, sig []byte) error {
 		return err
 	}
 	if err := protojson.Unmarshal(extBytes, verificationMaterial); err != nil {
-		slog.Debug(fmt.Sprintf("Error creating verification material: %v", err))
+		slog.Debug("Unable to create verification material", slog.Any("error", err))
 		return err
 	}
 
 	messageSignature := new(protocommon.MessageSignature)
 	if err := protojson.Unmarshal(sig, messageSignature); err != nil {
-		slog.Debug(fmt.Sprintf("Invalid Sigstore signature: %v", err))
+		slog.Debug("Invalid Sigstore signature", slog.Any("error", err))
 		return err
 	}
 
@@ -123,13 +150,13 @@ func (v *Verifier) Verify(_ context.Context, data, sig []byte) error {
 
 	apiBundle, err := bundle.NewBundle(pbBundle)
 	if err != nil {
-		slog.Debug(fmt.Sprintf("Unable to create Sigstore bundle for verification: %v", err))
+		slog.Debug("Unable to create Sigstore bundle for verification", slog.Any("error", err))
 		return err
 	}
 
 	expectedIdentity, err := verify.NewShortCertificateIdentity(v.issuer, "", v.identity, "")
 	if err != nil {
-		slog.Debug(fmt.Sprintf("Unable to create expected identity constraint: %v", err))
+		slog.Debug("Unable to create expected identity constraint", slog.Any("error", err))
 		return err
 	}
 
@@ -141,11 +168,11 @@ func (v *Verifier) Verify(_ context.Context, data, sig []byte) error {
 		),
 	)
 	if err != nil {
-		slog.Debug(fmt.Sprintf("Unable to verify Sigstore signature: %v", err))
+		slog.Debug("Unable to verify Sigstore signature", slog.Any("error", err))
 		return err
 	}
 
-	slog.Debug(fmt.Sprintf("Verified Sigstore signature issued by '%s' for '%s'", result.VerifiedIdentity.Issuer.Issuer, result.VerifiedIdentity.SubjectAlternativeName.SubjectAlternativeName))
+	slog.Debug("Verified Sigstore signature", slog.String("issuer", result.VerifiedIdentity.Issuer.Issuer), slog.String("identity", result.VerifiedIdentity.SubjectAlternativeName.SubjectAlternativeName))
 	return nil
 }
 
@@ -153,6 +180,82 @@ func (v *Verifier) KeyID() (string, error) {
 	return fmt.Sprintf("%s::%s", v.identity, v.issuer), nil
 }
 
+// Backend implements the dsse.BackendVerifier interface.
+func (v *Verifier) Backend() string {
+	return "sigstore"
+}
+
+// Identity returns the certificate identity signatures are verified against.
+func (v *Verifier) Identity() string {
+	return v.identity
+}
+
+// Issuer returns the OIDC issuer signatures are verified against.
+func (v *Verifier) Issuer() string {
+	return v.issuer
+}
+
+// IntegratedTimes returns the times at which a signature was recorded in the
+// transparency log, as per the verification material in the signature's
+// extension. The times are only trustworthy once the signature is verified.
+func IntegratedTimes(ext *dsse.Extension) ([]time.Time, error) {
+	entries, err := TlogEntries(ext)
+	if err != nil {
+		return nil, err
+	}
+
+	integratedTimes := []time.Time{}
+	for _, entry := range entries {
+		if entry.GetIntegratedTime() == 0 {
+			continue
+		}
+		integratedTimes = append(integratedTimes, time.Unix(entry.GetIntegratedTime(), 0).UTC())
+	}
+	return integratedTimes, nil
+}
+
+// TlogEntries returns the transparency log entries recorded in the
+// verification material in the signature's extension, if any.
+func TlogEntries(ext *dsse.Extension) ([]*protorekor.TransparencyLogEntry, error) {
+	if ext == nil || ext.Kind != ExtensionMimeType {
+		return nil, nil
+	}
+
+	extBytes, err := protojson.Marshal(ext.Ext)
+	if err != nil {
+		return nil, err
+	}
+	verificationMaterial := new(protobundle.VerificationMaterial)
+	if err := protojson.Unmarshal(extBytes, verificationMaterial); err != nil {
+		return nil, err
+	}
+
+	return verificationMaterial.GetTlogEntries(), nil
+}
+
+// NewKeyExtension creates an extension recording the transparency log entry
+// for a signature created using a key rather than a Sigstore certificate. The
+// key is identified using its key ID as the public key hint.
+func NewKeyExtension(keyID string, entry *protorekor.TransparencyLogEntry) (*dsse.Extension, error) {
+	verificationMaterial := &protobundle.VerificationMaterial{
+		Content: &protobundle.VerificationMaterial_PublicKey{
+			PublicKey: &protocommon.PublicKeyIdentifier{Hint: keyID},
+		},
+		TlogEntries: []*protorekor.TransparencyLogEntry{entry},
+	}
+
+	verificationMaterialBytes, err := protojson.Marshal(verificationMaterial)
+	if err != nil {
+		return nil, err
+	}
+	verificationMaterialStruct := new(structpb.Struct)
+	if err := protojson.Unmarshal(verificationMaterialBytes, verificationMaterialStruct); err != nil {
+		return nil, err
+	}
+
+	return &dsse.Extension{Kind: ExtensionMimeType, Ext: verificationMaterialStruct}, nil
+}
+
 func (v *Verifier) Public() crypto.PublicKey {
 	// TODO
 	return nil
@@ -226,6 +329,12 @@ func (v *Verifier) getTUFRoot() (root.TrustedMaterial, bool, error) {
 	// 	return trustedRoot, true, err
 	// }
 
+	if v.trustedRootPath != "" {
+		slog.Debug("Using trusted root of Sigstore instance", slog.String("path", v.trustedRootPath))
+		trustedRoot, err := root.NewTrustedRootFromPath(v.trustedRootPath)
+		return trustedRoot, true, err
+	}
+
 	// Use the TUF flow
 	// TODO: support custom sigstore TUF root URL
 
@@ -255,12 +364,13 @@ type Signer struct {
 
 func NewSigner() *Signer {
 	return &Signer{
-		issuerURL: issuerURL,
-		clientID:  clientID,
-		fulcioURL: fulcioURL,
-		rekorURL:  rekorURL,
+		issuerURL: instance.OIDCIssuerURL,
+		clientID:  instance.OIDCClientID,
+		fulcioURL: instance.FulcioURL,
+		rekorURL:  instance.RekorURL,
 		Verifier: &Verifier{
-			rekorURL: rekorURL,
+			rekorURL:        instance.RekorURL,
+			trustedRootPath: instance.TrustedRootPath,
 		},
 	}
 }
@@ -301,12 +411,44 @@ func (s *Signer) Sign(_ context.Context, data []byte) ([]byte, error) {
 
 	bundleJSON, err := protojson.Marshal(bundle)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	return bundleJSON, nil
 }
 
+// SignWithExtension implements the dsse.SignerWithExtension interface. The
+// bundle created by Sign is unpacked into the message signature, which is
+// returned as the signature, and the verification material, which is returned
+// as the extension.
+func (s *Signer) SignWithExtension(ctx context.Context, data []byte) ([]byte, *dsse.Extension, error) {
+	bundleJSON, err := s.Sign(ctx, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bundle := protobundle.Bundle{}
+	if err := protojson.Unmarshal(bundleJSON, &bundle); err != nil {
+		return nil, nil, err
+	}
+
+	sig, err := protojson.Marshal(bundle.GetMessageSignature())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	verificationMaterialBytes, err := protojson.Marshal(bundle.GetVerificationMaterial())
+	if err != nil {
+		return nil, nil, err
+	}
+	verificationMaterialStruct := new(structpb.Struct)
+	if err := protojson.Unmarshal(verificationMaterialBytes, verificationMaterialStruct); err != nil {
+		return nil, nil, err
+	}
+
+	return sig, &dsse.Extension{Kind: ExtensionMimeType, Ext: verificationMaterialStruct}, nil
+}
+
 func (s *Signer) KeyID() (string, error) {
 	// verifier can't return error
 	verifierKeyID, _ := s.Verifier.KeyID() //nolint:errcheck
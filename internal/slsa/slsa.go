@@ -0,0 +1,257 @@
+// Package slsa generates and validates SLSA v1.0 provenance predicates. See
+// https://slsa.dev/spec/v1.0/provenance.
+package slsa
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adityasaky/essd/internal/intoto"
+	slsav1 "github.com/in-toto/attestation/go/predicates/provenance/v1"
+	ita1 "github.com/in-toto/attestation/go/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// PredicateType is the in-toto predicate type for SLSA v1.0 provenance.
+	PredicateType = "https://slsa.dev/provenance/v1"
+
+	// goModuleDigest is the in-toto digest set key for Go module hashes as
+	// recorded in go.sum. The digest set records them hex encoded rather than
+	// in the base64 "h1:" form go.sum uses.
+	goModuleDigest   = "dirHash"
+	goModuleH1Prefix = "h1:"
+)
+
+var ErrInvalidProvenance = errors.New("invalid SLSA provenance")
+
+// BuildDescription describes a build for which provenance is generated. It is
+// typically loaded from a JSON file using LoadBuildDescription.
+type BuildDescription struct {
+	BuilderID      string            `json:"builderId"`
+	BuilderVersion map[string]string `json:"builderVersion,omitempty"`
+	BuildType      string            `json:"buildType"`
+
+	ExternalParameters json.RawMessage `json:"externalParameters"`
+	InternalParameters json.RawMessage `json:"internalParameters,omitempty"`
+
+	// Dependencies lists paths of files that are recorded as resolved
+	// dependencies with their sha256 digests.
+	Dependencies []string `json:"dependencies,omitempty"`
+	// GoSum is the path of a go.sum file whose modules are recorded as
+	// resolved dependencies.
+	GoSum string `json:"goSum,omitempty"`
+	// ResolvedDependencies are in-toto resource descriptors recorded as is,
+	// for dependencies that are not local files.
+	ResolvedDependencies []json.RawMessage `json:"resolvedDependencies,omitempty"`
+
+	InvocationID string `json:"invocationId,omitempty"`
+	// StartedOn and FinishedOn are RFC 3339 timestamps. If FinishedOn is not
+	// set, the time the provenance is generated is used.
+	StartedOn  string `json:"startedOn,omitempty"`
+	FinishedOn string `json:"finishedOn,omitempty"`
+}
+
+// LoadBuildDescription reads a JSON build description from the file at path.
+func LoadBuildDescription(path string) (*BuildDescription, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	description := &BuildDescription{}
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(description); err != nil {
+		return nil, fmt.Errorf("unable to parse build description '%s': %w", path, err)
+	}
+
+	return description, nil
+}
+
+// Provenance generates the SLSA provenance predicate for the build, and
+// validates it.
+func (d *BuildDescription) Provenance() (*slsav1.Provenance, error) {
+	externalParameters, err := parseParameters(d.ExternalParameters)
+	if err != nil {
+		return nil, fmt.Errorf("invalid externalParameters: %w", err)
+	}
+	internalParameters, err := parseParameters(d.InternalParameters)
+	if err != nil {
+		return nil, fmt.Errorf("invalid internalParameters: %w", err)
+	}
+
+	resolvedDependencies := []*ita1.ResourceDescriptor{}
+	for _, path := range d.Dependencies {
+		dependency, err := intoto.NewSubjectFromFile(path, []string{intoto.DigestSHA256})
+		if err != nil {
+			return nil, err
+		}
+		resolvedDependencies = append(resolvedDependencies, dependency)
+	}
+	if d.GoSum != "" {
+		goDependencies, err := ResolvedDependenciesFromGoSum(d.GoSum)
+		if err != nil {
+			return nil, err
+		}
+		resolvedDependencies = append(resolvedDependencies, goDependencies...)
+	}
+	for i, rawDependency := range d.ResolvedDependencies {
+		dependency := &ita1.ResourceDescriptor{}
+		if err := protojson.Unmarshal(rawDependency, dependency); err != nil {
+			return nil, fmt.Errorf("invalid resolvedDependencies[%d]: %w", i, err)
+		}
+		resolvedDependencies = append(resolvedDependencies, dependency)
+	}
+
+	metadata := &slsav1.BuildMetadata{InvocationId: d.InvocationID}
+	if d.StartedOn != "" {
+		startedOn, err := time.Parse(time.RFC3339, d.StartedOn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid startedOn: %w", err)
+		}
+		metadata.StartedOn = timestamppb.New(startedOn)
+	}
+	finishedOn := time.Now().UTC()
+	if d.FinishedOn != "" {
+		finishedOn, err = time.Parse(time.RFC3339, d.FinishedOn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid finishedOn: %w", err)
+		}
+	}
+	metadata.FinishedOn = timestamppb.New(finishedOn)
+
+	if metadata.StartedOn != nil && metadata.FinishedOn.AsTime().Before(metadata.StartedOn.AsTime()) {
+		return nil, fmt.Errorf("%w: finishedOn is before startedOn", ErrInvalidProvenance)
+	}
+
+	provenance := &slsav1.Provenance{
+		BuildDefinition: &slsav1.BuildDefinition{
+			BuildType:            d.BuildType,
+			ExternalParameters:   externalParameters,
+			InternalParameters:   internalParameters,
+			ResolvedDependencies: resolvedDependencies,
+		},
+		RunDetails: &slsav1.RunDetails{
+			Builder: &slsav1.Builder{
+				Id:      d.BuilderID,
+				Version: d.BuilderVersion,
+			},
+			Metadata: metadata,
+		},
+	}
+
+	if err := provenance.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProvenance, err)
+	}
+
+	return provenance, nil
+}
+
+// ToStruct converts the provenance into the generic representation used for
+// in-toto Statement predicates.
+func ToStruct(provenance *slsav1.Provenance) (*structpb.Struct, error) {
+	provenanceBytes, err := protojson.Marshal(provenance)
+	if err != nil {
+		return nil, err
+	}
+
+	predicate := &structpb.Struct{}
+	if err := protojson.Unmarshal(provenanceBytes, predicate); err != nil {
+		return nil, err
+	}
+	return predicate, nil
+}
+
+// Validate checks that the predicate is a conformant SLSA v1.0 provenance
+// predicate. Unknown fields are rejected.
+func Validate(predicate *structpb.Struct) error {
+	predicateBytes, err := protojson.Marshal(predicate)
+	if err != nil {
+		return err
+	}
+
+	provenance := &slsav1.Provenance{}
+	if err := protojson.Unmarshal(predicateBytes, provenance); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidProvenance, err)
+	}
+
+	if err := provenance.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidProvenance, err)
+	}
+
+	return nil
+}
+
+// ResolvedDependenciesFromGoSum returns a resource descriptor for each module
+// listed in the go.sum file at path. Entries for go.mod files are skipped as
+// the module's own entry covers them.
+func ResolvedDependenciesFromGoSum(path string) ([]*ita1.ResourceDescriptor, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() //nolint:errcheck
+
+	dependencies := []*ita1.ResourceDescriptor{}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("malformed entry in '%s' at line %d", filepath.Base(path), lineNumber)
+		}
+		module, version, hash := fields[0], fields[1], fields[2]
+		if strings.HasSuffix(version, "/go.mod") {
+			continue
+		}
+
+		if !strings.HasPrefix(hash, goModuleH1Prefix) {
+			return nil, fmt.Errorf("unsupported hash for module '%s' in '%s' at line %d", module, filepath.Base(path), lineNumber)
+		}
+		hashBytes, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(hash, goModuleH1Prefix))
+		if err != nil {
+			return nil, fmt.Errorf("malformed hash for module '%s' in '%s' at line %d", module, filepath.Base(path), lineNumber)
+		}
+
+		dependencies = append(dependencies, &ita1.ResourceDescriptor{
+			Name:   module,
+			Uri:    fmt.Sprintf("pkg:golang/%s@%s", module, version),
+			Digest: map[string]string{goModuleDigest: hex.EncodeToString(hashBytes)},
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return dependencies, nil
+}
+
+func parseParameters(raw json.RawMessage) (*structpb.Struct, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	parameters := &structpb.Struct{}
+	if err := protojson.Unmarshal(raw, parameters); err != nil {
+		return nil, err
+	}
+	return parameters, nil
+}
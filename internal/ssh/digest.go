@@ -0,0 +1,103 @@
+package ssh
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/hiddeco/sshsig"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshsigPreamble is the magic preamble of SSH signatures and of the data they
+// sign.
+const sshsigPreamble = "SSHSIG"
+
+// signedData is the data SSH signatures sign, which records the digest of the
+// message rather than the message.
+// https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.sshsig
+type signedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          string
+}
+
+// DigestAlgorithm implements the dsse.DigestSigner and dsse.DigestVerifier
+// interfaces for SSH keys. Signatures are created using SHA-512 digests, like
+// those of ssh-keygen.
+func (v *Verifier) DigestAlgorithm() crypto.Hash {
+	return crypto.SHA512
+}
+
+// VerifyDigest implements the dsse.DigestVerifier interface for SSH keys. The
+// signature is verified like one verified using VerifyStream for the message
+// the digest was computed over.
+func (v *Verifier) VerifyDigest(_ context.Context, digest []byte, sig []byte) error {
+	signature, err := sshsig.Unarmor(sig)
+	if err != nil {
+		return fmt.Errorf("failed to parse ssh signature: %w", err)
+	}
+	if ssh.FingerprintSHA256(signature.PublicKey) != ssh.FingerprintSHA256(v.sshKey) {
+		return fmt.Errorf("failed to verify ssh signature: %w", sshsig.ErrPublicKeyMismatch)
+	}
+	if signature.Namespace != SigNamespace {
+		return fmt.Errorf("failed to verify ssh signature: %w", sshsig.ErrNamespaceMismatch)
+	}
+
+	if err := v.sshKey.Verify(signedDigest(digest), signature.Signature); err != nil {
+		return fmt.Errorf("failed to verify ssh signature: %w", err)
+	}
+	return nil
+}
+
+// SignDigest implements the dsse.DigestSigner interface for SSH keys. The
+// signature is identical to one created by ssh-keygen for the message the
+// digest was computed over. Like PrivateKey, this requires an unencrypted
+// private key file.
+func (s *Signer) SignDigest(_ context.Context, digest []byte) ([]byte, error) {
+	if len(digest) != crypto.SHA512.Size() {
+		return nil, fmt.Errorf("invalid SHA-512 digest of %d bytes", len(digest))
+	}
+
+	key, err := s.PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromSigner(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data := signedDigest(digest)
+
+	var signature *ssh.Signature
+	if algorithmSigner, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		// RSA keys sign using SHA-512, like ssh-keygen
+		signature, err = algorithmSigner.SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA512)
+	} else {
+		signature, err = signer.Sign(rand.Reader, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return sshsig.Armor(&sshsig.Signature{
+		Version:       1,
+		PublicKey:     signer.PublicKey(),
+		Namespace:     SigNamespace,
+		HashAlgorithm: sshsig.HashSHA512,
+		Signature:     signature,
+	}), nil
+}
+
+// signedDigest returns the data SSH signatures sign for a message with the
+// SHA-512 digest.
+func signedDigest(digest []byte) []byte {
+	return append([]byte(sshsigPreamble), ssh.Marshal(signedData{
+		Namespace:     SigNamespace,
+		HashAlgorithm: string(sshsig.HashSHA512),
+		Hash:          string(digest),
+	})...)
+}
@@ -14,7 +14,9 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -31,6 +33,8 @@ const (
 	KeyType      = "ssh"
 )
 
+var ErrEncryptedKey = errors.New("encrypted private keys can only be used to create SSH signatures")
+
 // Verifier is a dsse.Verifier implementation for SSH keys.
 type Verifier struct {
 	keyID  string
@@ -38,14 +42,18 @@ type Verifier struct {
 }
 
 // Verify implements the dsse.Verifier.Verify interface for SSH keys.
-func (v *Verifier) Verify(_ context.Context, data []byte, sig []byte) error {
+func (v *Verifier) Verify(ctx context.Context, data []byte, sig []byte) error {
+	return v.VerifyStream(ctx, bytes.NewReader(data), sig)
+}
+
+// VerifyStream implements the dsse.StreamVerifier interface for SSH keys. The
+// message is hashed as it is read.
+func (v *Verifier) VerifyStream(_ context.Context, message io.Reader, sig []byte) error {
 	signature, err := sshsig.Unarmor(sig)
 	if err != nil {
 		return fmt.Errorf("failed to parse ssh signature: %w", err)
 	}
 
-	message := bytes.NewReader(data)
-
 	// ssh-keygen uses sha512 to sign with **any*** key
 	hash := sshsig.HashSHA512
 	if err := sshsig.Verify(message, signature, v.sshKey, hash, SigNamespace); err != nil {
@@ -67,6 +75,11 @@ func (v *Verifier) Public() crypto.PublicKey {
 	return v.sshKey.(ssh.CryptoPublicKey).CryptoPublicKey()
 }
 
+// Backend implements the dsse.BackendVerifier interface.
+func (v *Verifier) Backend() string {
+	return "ssh"
+}
+
 func (v *Verifier) MetadataKey() *signerverifier.SSLibKey {
 	return newSSHKey(v.sshKey, v.keyID)
 }
@@ -82,10 +95,17 @@ type Signer struct {
 // ecdsa or ed25519 key file in a format supported by "ssh-keygen". This aligns
 // with the git "user.signingKey" option.
 // https://git-scm.com/docs/git-config#Documentation/git-config.txt-usersigningKey
-func (s *Signer) Sign(_ context.Context, data []byte) ([]byte, error) {
+func (s *Signer) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	return s.SignStream(ctx, bytes.NewReader(data))
+}
+
+// SignStream implements the dsse.StreamSigner interface for SSH keys. The
+// message is passed to ssh-keygen as it is read, which hashes it
+// incrementally.
+func (s *Signer) SignStream(_ context.Context, message io.Reader) ([]byte, error) {
 	cmd := exec.Command("ssh-keygen", "-Y", "sign", "-n", SigNamespace, "-f", s.Path) //nolint:gosec
 
-	cmd.Stdin = bytes.NewBuffer(data)
+	cmd.Stdin = message
 
 	output, err := cmd.Output()
 	if err != nil {
@@ -95,6 +115,31 @@ func (s *Signer) Sign(_ context.Context, data []byte) ([]byte, error) {
 	return output, nil
 }
 
+// PrivateKey loads the private key at "s.Path", for signing using algorithms
+// other than SSH signatures. Unlike signing using "ssh-keygen", this requires
+// an unencrypted private key file.
+func (s *Signer) PrivateKey() (crypto.Signer, error) {
+	keyBytes, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ssh.ParseRawPrivateKey(keyBytes)
+	if err != nil {
+		var passphraseMissing *ssh.PassphraseMissingError
+		if errors.As(err, &passphraseMissing) {
+			return nil, fmt.Errorf("%w: '%s'", ErrEncryptedKey, s.Path)
+		}
+		return nil, fmt.Errorf("failed to parse private key '%s': %w", s.Path, err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
 // NewKeyFromFile imports an ssh SSlibKey from the passed path.
 // The path can point to a public or private, encrypted or plaintext, rsa,
 // ecdsa or ed25519 key file in a format supported by "ssh-keygen". This aligns
@@ -225,6 +270,32 @@ func parseSSH2Key(data string) (ssh.PublicKey, error) {
 	return parseSSH2Body(body)
 }
 
+// ParseRFC4716Key parses an SSH2 public key as defined in RFC4716. It is
+// subject to the same restrictions as parseSSH2Key.
+func ParseRFC4716Key(data []byte) (ssh.PublicKey, error) {
+	return parseSSH2Key(string(data))
+}
+
+// MarshalRFC4716Key encodes an SSH public key as defined in RFC4716 (section
+// 3.), wrapping the body at 70 characters like "ssh-keygen -e" does.
+func MarshalRFC4716Key(key ssh.PublicKey, comment string) []byte {
+	body := base64.StdEncoding.EncodeToString(key.Marshal())
+
+	var out bytes.Buffer
+	out.WriteString("---- BEGIN SSH2 PUBLIC KEY ----\n")
+	if comment != "" {
+		fmt.Fprintf(&out, "Comment: \"%s\"\n", comment)
+	}
+	for len(body) > 70 {
+		out.WriteString(body[:70] + "\n")
+		body = body[70:]
+	}
+	out.WriteString(body + "\n")
+	out.WriteString("---- END SSH2 PUBLIC KEY ----\n")
+
+	return out.Bytes()
+}
+
 func newSSHKey(key ssh.PublicKey, keyID string) *signerverifier.SSLibKey {
 	if keyID == "" {
 		keyID = ssh.FingerprintSHA256(key)
@@ -0,0 +1,26 @@
+package ssh
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// NewSignerForTest generates an unencrypted ed25519 key named name in dir,
+// and returns a signer for it. The public key is written alongside it, with
+// the .pub extension. Like NewKeyFromBytes, it's meant to be used for tests.
+func NewSignerForTest(t *testing.T, dir, name string) *Signer {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	cmd := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", name, "-f", path)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to run command %v: %v %s", cmd, err, output)
+	}
+
+	signer, err := NewSignerFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
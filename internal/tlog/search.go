@@ -0,0 +1,197 @@
+package tlog
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/go-openapi/swag"
+	protorekor "github.com/sigstore/protobuf-specs/gen/pb-go/rekor/v1"
+	"github.com/sigstore/rekor/pkg/generated/client/index"
+	"github.com/sigstore/rekor/pkg/generated/models"
+	"github.com/sigstore/sigstore-go/pkg/fulcio/certificate"
+	sigstoretlog "github.com/sigstore/sigstore-go/pkg/tlog"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	ErrInvalidQuery     = errors.New("invalid transparency log query")
+	ErrIdentityMismatch = errors.New("transparency log entry was not signed by the identity")
+	ErrIssuerMismatch   = errors.New("transparency log entry was signed by the identity from a different issuer")
+)
+
+// Query selects log entries. Entries must match every criterion that is set.
+type Query struct {
+	// SSHKey is an SSH public key that signed the entries.
+	SSHKey ssh.PublicKey
+	// Identity and Issuer are the Sigstore identity that signed the entries.
+	// Rekor only indexes identities that are email addresses.
+	Identity string
+	Issuer   string
+	// Digest is the lowercase hex encoded SHA-256 digest of the signed data.
+	// For signatures on DSSE envelopes, this is the digest of the envelope's
+	// PAE encoding.
+	Digest string
+}
+
+// FoundEntry is a log entry found using a query.
+type FoundEntry struct {
+	UUID  string
+	Entry *protorekor.TransparencyLogEntry
+}
+
+// Search returns the UUIDs of the log entries Rekor's index lists for the
+// query. The index is not authenticated, so the entries must be checked using
+// Match.
+func (c *Client) Search(ctx context.Context, query *Query) ([]string, error) {
+	searchIndex := &models.SearchIndex{Operator: "and"}
+
+	if query.SSHKey != nil {
+		searchIndex.PublicKey = &models.SearchIndexPublicKey{
+			Format:  swag.String(models.SearchIndexPublicKeyFormatSSH),
+			Content: ssh.MarshalAuthorizedKey(query.SSHKey),
+		}
+	}
+
+	if query.Identity != "" {
+		if _, err := mail.ParseAddress(query.Identity); err != nil {
+			return nil, fmt.Errorf("%w: Rekor can only search for identities that are email addresses", ErrInvalidQuery)
+		}
+		searchIndex.Email = strfmt.Email(query.Identity)
+	}
+
+	if query.Digest != "" {
+		searchIndex.Hash = "sha256:" + query.Digest
+	}
+
+	if err := searchIndex.Validate(strfmt.Default); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidQuery, err)
+	}
+	if searchIndex.PublicKey == nil && searchIndex.Email == "" && searchIndex.Hash == "" {
+		return nil, fmt.Errorf("%w: no criteria specified", ErrInvalidQuery)
+	}
+
+	params := index.NewSearchIndexParamsWithContext(ctx).WithQuery(searchIndex)
+	response, err := c.rekor.Index.SearchIndex(params)
+	if err != nil {
+		return nil, fmt.Errorf("unable to search transparency log: %w", err)
+	}
+
+	return response.Payload, nil
+}
+
+// Find searches for the log entries matching the query and retrieves them.
+func (c *Client) Find(ctx context.Context, query *Query) ([]*FoundEntry, error) {
+	uuids, err := c.Search(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	found := []*FoundEntry{}
+	for _, uuid := range uuids {
+		entry, err := c.Entry(ctx, uuid)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, &FoundEntry{UUID: uuid, Entry: entry})
+	}
+
+	return found, nil
+}
+
+// Match checks that the log entry's body matches the query.
+func (q *Query) Match(entry *protorekor.TransparencyLogEntry) error {
+	if q.SSHKey != nil {
+		body, err := ParseEntryBody(entry)
+		if err != nil {
+			return err
+		}
+		entryKey, _, _, _, err := ssh.ParseAuthorizedKey(body.Spec.Signature.PublicKey.Content)
+		if err != nil {
+			return fmt.Errorf("%w: entry %d: %w", ErrLogEntryMismatch, entry.GetLogIndex(), err)
+		}
+		if ssh.FingerprintSHA256(entryKey) != ssh.FingerprintSHA256(q.SSHKey) {
+			return fmt.Errorf("%w: entry %d records a different key", ErrLogEntryMismatch, entry.GetLogIndex())
+		}
+	}
+
+	if q.Identity != "" {
+		if err := q.matchIdentity(entry); err != nil {
+			return err
+		}
+	}
+
+	if q.Digest != "" {
+		digest, err := entryDigest(entry)
+		if err != nil {
+			return err
+		}
+		if digest != q.Digest {
+			return fmt.Errorf("%w: entry %d records a different payload", ErrLogEntryMismatch, entry.GetLogIndex())
+		}
+	}
+
+	return nil
+}
+
+// entryDigest returns the SHA-256 digest of the signed data recorded by the
+// entry. Only rekord entries, which essd creates for SSH signatures, and
+// hashedrekord entries, which Sigstore creates, record the digest; entries of
+// other kinds cannot be checked against a digest and are rejected.
+func entryDigest(entry *protorekor.TransparencyLogEntry) (string, error) {
+	body := &struct {
+		Kind string `json:"kind"`
+		Spec struct {
+			Data struct {
+				Hash struct {
+					Algorithm string `json:"algorithm"`
+					Value     string `json:"value"`
+				} `json:"hash"`
+			} `json:"data"`
+		} `json:"spec"`
+	}{}
+	if err := json.Unmarshal(entry.GetCanonicalizedBody(), body); err != nil {
+		return "", fmt.Errorf("%w: entry %d: %w", ErrLogEntryMismatch, entry.GetLogIndex(), err)
+	}
+
+	if body.Kind != entryKind && body.Kind != hashedrekordKind {
+		return "", fmt.Errorf("%w: entry %d is a %s entry, which does not record the digest of the signed data", ErrLogEntryMismatch, entry.GetLogIndex(), body.Kind)
+	}
+	if body.Spec.Data.Hash.Algorithm != models.RekordV001SchemaDataHashAlgorithmSha256 {
+		return "", fmt.Errorf("%w: entry %d records a %s digest, expected sha256", ErrLogEntryMismatch, entry.GetLogIndex(), body.Spec.Data.Hash.Algorithm)
+	}
+	return body.Spec.Data.Hash.Value, nil
+}
+
+// matchIdentity checks that the entry records a Fulcio certificate issued to
+// the query's identity by the query's issuer.
+func (q *Query) matchIdentity(entry *protorekor.TransparencyLogEntry) error {
+	parsed, err := sigstoretlog.NewTlogEntry(entry)
+	if err != nil {
+		return fmt.Errorf("%w: entry %d: %w", ErrIdentityMismatch, entry.GetLogIndex(), err)
+	}
+
+	cert, isCert := parsed.PublicKey().(*x509.Certificate)
+	if !isCert {
+		return fmt.Errorf("%w: entry %d does not record a certificate", ErrIdentityMismatch, entry.GetLogIndex())
+	}
+
+	summary, err := certificate.SummarizeCertificate(cert)
+	if err != nil {
+		return fmt.Errorf("%w: entry %d: %w", ErrIdentityMismatch, entry.GetLogIndex(), err)
+	}
+	if summary.SubjectAlternativeName != q.Identity {
+		return fmt.Errorf("%w: entry %d was signed by '%s'", ErrIdentityMismatch, entry.GetLogIndex(), summary.SubjectAlternativeName)
+	}
+	// Rekor's index does not record issuers, so entries for the same email
+	// address from other issuers are expected
+	if summary.Issuer != q.Issuer {
+		return fmt.Errorf("%w: entry %d was issued by '%s'", ErrIssuerMismatch, entry.GetLogIndex(), summary.Issuer)
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package tlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	essdssh "github.com/adityasaky/essd/internal/ssh"
+	protorekor "github.com/sigstore/protobuf-specs/gen/pb-go/rekor/v1"
+	"golang.org/x/crypto/ssh"
+)
+
+// searchIndex lists every entry regardless of the query, as Rekor's index is
+// not authenticated and entries found using it must be matched.
+func (r *rekorStandIn) searchIndex(w http.ResponseWriter, _ *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(append([]string{}, r.uuids...)) //nolint:errcheck
+}
+
+func TestFind(t *testing.T) {
+	_, rekorURL := newRekorStandIn(t)
+	signer, err := NewSigner(essdssh.NewSignerForTest(t, t.TempDir(), "key"), rekorURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewSigner(essdssh.NewSignerForTest(t, t.TempDir(), "key"), rekorURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, _, err := signer.SignWithExtension(ctx, []byte("payload")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := other.SignWithExtension(ctx, []byte("other")); err != nil {
+		t.Fatal(err)
+	}
+
+	sshKey, err := ssh.NewPublicKey(signer.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClient(rekorURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := &Query{SSHKey: sshKey, Digest: sha256Hex([]byte("payload"))}
+	found, err := c.Find(ctx, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(found))
+	}
+
+	matched := 0
+	for _, entry := range found {
+		if err := query.Match(entry.Entry); err != nil {
+			if !errors.Is(err, ErrLogEntryMismatch) {
+				t.Fatalf("expected ErrLogEntryMismatch, got %v", err)
+			}
+			continue
+		}
+		matched++
+	}
+	if matched != 1 {
+		t.Fatalf("expected one matching entry, got %d", matched)
+	}
+}
+
+func TestSearchInvalidQuery(t *testing.T) {
+	c, err := NewClient("http://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, query := range map[string]*Query{
+		"no criteria":           {},
+		"identity not an email": {Identity: "https://github.com/adityasaky/essd"},
+		"invalid digest":        {Digest: "not hex"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := c.Search(context.Background(), query); !errors.Is(err, ErrInvalidQuery) {
+				t.Fatalf("expected ErrInvalidQuery, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMatchDigest(t *testing.T) {
+	digest := sha256Hex([]byte("payload"))
+	query := &Query{Digest: digest}
+
+	tests := map[string]struct {
+		body  string
+		match bool
+	}{
+		"rekord": {
+			body:  `{"kind":"rekord","apiVersion":"0.0.1","spec":{"data":{"hash":{"algorithm":"sha256","value":"` + digest + `"}}}}`,
+			match: true,
+		},
+		"hashedrekord": {
+			body:  `{"kind":"hashedrekord","apiVersion":"0.0.1","spec":{"data":{"hash":{"algorithm":"sha256","value":"` + digest + `"}}}}`,
+			match: true,
+		},
+		"different digest": {
+			body: `{"kind":"rekord","apiVersion":"0.0.1","spec":{"data":{"hash":{"algorithm":"sha256","value":"` + sha256Hex([]byte("other")) + `"}}}}`,
+		},
+		"sha512 digest": {
+			body: `{"kind":"hashedrekord","apiVersion":"0.0.1","spec":{"data":{"hash":{"algorithm":"sha512","value":"` + digest + `"}}}}`,
+		},
+		// Other kinds do not record the digest of the signed data, even when
+		// they record a digest in the same place
+		"intoto": {
+			body: `{"kind":"intoto","apiVersion":"0.0.2","spec":{"data":{"hash":{"algorithm":"sha256","value":"` + digest + `"}}}}`,
+		},
+		"invalid body": {
+			body: `not json`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := query.Match(&protorekor.TransparencyLogEntry{CanonicalizedBody: []byte(test.body)})
+			if test.match && err != nil {
+				t.Fatal(err)
+			}
+			if !test.match && !errors.Is(err, ErrLogEntryMismatch) {
+				t.Fatalf("expected ErrLogEntryMismatch, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+// Package tlog records signatures created using SSH keys in a Rekor
+// transparency log, and verifies the resulting log entries offline using the
+// inclusion proofs, checkpoints, and signed entry timestamps recorded
+// alongside the signatures. Signatures are recorded as rekord entries, which
+// Rekor verifies before including them, as Rekor's dsse entries only support
+// raw signatures rather than SSH signatures.
+package tlog
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/sigstore"
+	essdssh "github.com/adityasaky/essd/internal/ssh"
+	"github.com/go-openapi/strfmt"
+	"github.com/go-openapi/swag"
+	protocommon "github.com/sigstore/protobuf-specs/gen/pb-go/common/v1"
+	protorekor "github.com/sigstore/protobuf-specs/gen/pb-go/rekor/v1"
+	"github.com/sigstore/rekor/pkg/client"
+	rekorclient "github.com/sigstore/rekor/pkg/generated/client"
+	"github.com/sigstore/rekor/pkg/generated/client/entries"
+	"github.com/sigstore/rekor/pkg/generated/models"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// DefaultRekorURL is the Rekor instance of the Sigstore public good
+	// instance.
+	DefaultRekorURL = "https://rekor.sigstore.dev"
+
+	entryKind       = "rekord"
+	entryAPIVersion = "0.0.1"
+
+	// hashedrekordKind is the kind of entries Sigstore creates for signatures.
+	hashedrekordKind = "hashedrekord"
+)
+
+var (
+	ErrNoLogEntry         = errors.New("signature has no transparency log entry")
+	ErrLogEntryMismatch   = errors.New("transparency log entry does not record the signature")
+	ErrUntrustedLog       = errors.New("transparency log entry is from an untrusted log")
+	ErrUnexpectedResponse = errors.New("unexpected response from transparency log")
+)
+
+// Client records entries in and retrieves entries from a Rekor instance.
+type Client struct {
+	rekor *rekorclient.Rekor
+}
+
+// NewClient creates a client for the Rekor instance at the URL.
+func NewClient(rekorURL string) (*Client, error) {
+	rekor, err := client.GetRekorClient(rekorURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{rekor: rekor}, nil
+}
+
+// Upload records the SSH signature over data, created using the public key's
+// private key, in the log and returns the log entry. If the log already
+// records the signature, the existing entry is returned.
+func (c *Client) Upload(ctx context.Context, data, sig []byte, publicKey crypto.PublicKey) (*protorekor.TransparencyLogEntry, error) {
+	sshKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	authorizedKey := strfmt.Base64(ssh.MarshalAuthorizedKey(sshKey))
+	sigContent := strfmt.Base64(sig)
+
+	proposedEntry := &models.Rekord{
+		APIVersion: swag.String(entryAPIVersion),
+		Spec: &models.RekordV001Schema{
+			Data: &models.RekordV001SchemaData{Content: data},
+			Signature: &models.RekordV001SchemaSignature{
+				Format:    swag.String(models.RekordV001SchemaSignatureFormatSSH),
+				Content:   &sigContent,
+				PublicKey: &models.RekordV001SchemaSignaturePublicKey{Content: &authorizedKey},
+			},
+		},
+	}
+
+	params := entries.NewCreateLogEntryParamsWithContext(ctx).WithProposedEntry(proposedEntry)
+	created, err := c.rekor.Entries.CreateLogEntry(params)
+	if err != nil {
+		// Signatures that are deterministic, such as ed25519 signatures, are
+		// already recorded when the same payload is signed again
+		conflict := &entries.CreateLogEntryConflict{}
+		if !errors.As(err, &conflict) {
+			return nil, fmt.Errorf("unable to upload to transparency log: %w", err)
+		}
+		return c.Entry(ctx, path.Base(conflict.Location.String()))
+	}
+
+	return singleEntry(created.Payload)
+}
+
+// Entry retrieves the log entry with the UUID, including its inclusion proof.
+func (c *Client) Entry(ctx context.Context, uuid string) (*protorekor.TransparencyLogEntry, error) {
+	params := entries.NewGetLogEntryByUUIDParamsWithContext(ctx).WithEntryUUID(uuid)
+	response, err := c.rekor.Entries.GetLogEntryByUUID(params)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch transparency log entry '%s': %w", uuid, err)
+	}
+
+	return singleEntry(response.Payload)
+}
+
+func singleEntry(logEntry models.LogEntry) (*protorekor.TransparencyLogEntry, error) {
+	if len(logEntry) != 1 {
+		return nil, fmt.Errorf("%w: expected one log entry, found %d", ErrUnexpectedResponse, len(logEntry))
+	}
+	for _, entry := range logEntry {
+		return fromLogEntryAnon(&entry)
+	}
+	return nil, nil
+}
+
+// Signer is a dsse.SignerWithExtension that signs using an SSH key and records
+// each signature in a transparency log. The log entry is recorded in the
+// signature's extension using Sigstore's verification material format, with
+// the key's ID as the public key hint.
+type Signer struct {
+	*essdssh.Signer
+	client *Client
+}
+
+// NewSigner creates a signer that records signatures created using the SSH
+// signer in the Rekor instance at the URL.
+func NewSigner(signer *essdssh.Signer, rekorURL string) (*Signer, error) {
+	c, err := NewClient(rekorURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{Signer: signer, client: c}, nil
+}
+
+// SignWithExtension implements the dsse.SignerWithExtension interface.
+func (s *Signer) SignWithExtension(ctx context.Context, data []byte) ([]byte, *dsse.Extension, error) {
+	sig, err := s.Sign(ctx, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entry, err := s.client.Upload(ctx, data, sig, s.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyID, err := s.KeyID()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ext, err := sigstore.NewKeyExtension(keyID, entry)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sig, ext, nil
+}
+
+// fromLogEntryAnon converts a log entry as returned by Rekor into the
+// representation used in Sigstore's verification material.
+func fromLogEntryAnon(entry *models.LogEntryAnon) (*protorekor.TransparencyLogEntry, error) {
+	if entry.LogIndex == nil || entry.LogID == nil || entry.IntegratedTime == nil || entry.Verification == nil || entry.Verification.InclusionProof == nil {
+		return nil, fmt.Errorf("%w: log entry is incomplete", ErrUnexpectedResponse)
+	}
+
+	body, isString := entry.Body.(string)
+	if !isString {
+		return nil, fmt.Errorf("%w: log entry body is not encoded", ErrUnexpectedResponse)
+	}
+	bodyBytes, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return nil, err
+	}
+
+	kindVersion := struct {
+		Kind       string `json:"kind"`
+		APIVersion string `json:"apiVersion"`
+	}{}
+	if err := json.Unmarshal(bodyBytes, &kindVersion); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnexpectedResponse, err)
+	}
+
+	logID, err := hex.DecodeString(*entry.LogID)
+	if err != nil {
+		return nil, err
+	}
+
+	inclusionProof := entry.Verification.InclusionProof
+	rootHash, err := hex.DecodeString(swag.StringValue(inclusionProof.RootHash))
+	if err != nil {
+		return nil, err
+	}
+	hashes := [][]byte{}
+	for _, hash := range inclusionProof.Hashes {
+		hashBytes, err := hex.DecodeString(hash)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hashBytes)
+	}
+
+	return &protorekor.TransparencyLogEntry{
+		LogIndex:       *entry.LogIndex,
+		LogId:          &protocommon.LogId{KeyId: logID},
+		KindVersion:    &protorekor.KindVersion{Kind: kindVersion.Kind, Version: kindVersion.APIVersion},
+		IntegratedTime: *entry.IntegratedTime,
+		InclusionPromise: &protorekor.InclusionPromise{
+			SignedEntryTimestamp: entry.Verification.SignedEntryTimestamp,
+		},
+		InclusionProof: &protorekor.InclusionProof{
+			LogIndex:   swag.Int64Value(inclusionProof.LogIndex),
+			RootHash:   rootHash,
+			TreeSize:   swag.Int64Value(inclusionProof.TreeSize),
+			Hashes:     hashes,
+			Checkpoint: &protorekor.Checkpoint{Envelope: swag.StringValue(inclusionProof.Checkpoint)},
+		},
+		CanonicalizedBody: bodyBytes,
+	}, nil
+}
+
+// toLogEntryAnon converts a log entry from the representation used in
+// Sigstore's verification material into the one used by Rekor.
+func toLogEntryAnon(entry *protorekor.TransparencyLogEntry) *models.LogEntryAnon {
+	inclusionProof := entry.GetInclusionProof()
+	hashes := []string{}
+	for _, hash := range inclusionProof.GetHashes() {
+		hashes = append(hashes, hex.EncodeToString(hash))
+	}
+
+	return &models.LogEntryAnon{
+		Body:           base64.StdEncoding.EncodeToString(entry.GetCanonicalizedBody()),
+		IntegratedTime: swag.Int64(entry.GetIntegratedTime()),
+		LogID:          swag.String(hex.EncodeToString(entry.GetLogId().GetKeyId())),
+		LogIndex:       swag.Int64(entry.GetLogIndex()),
+		Verification: &models.LogEntryAnonVerification{
+			InclusionProof: &models.InclusionProof{
+				Checkpoint: swag.String(inclusionProof.GetCheckpoint().GetEnvelope()),
+				Hashes:     hashes,
+				LogIndex:   swag.Int64(inclusionProof.GetLogIndex()),
+				RootHash:   swag.String(hex.EncodeToString(inclusionProof.GetRootHash())),
+				TreeSize:   swag.Int64(inclusionProof.GetTreeSize()),
+			},
+			SignedEntryTimestamp: entry.GetInclusionPromise().GetSignedEntryTimestamp(),
+		},
+	}
+}
+
+func sha256Hex(data []byte) string {
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:])
+}
@@ -0,0 +1,345 @@
+package tlog
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	essdssh "github.com/adityasaky/essd/internal/ssh"
+	"github.com/go-openapi/swag"
+	"github.com/sigstore/rekor/pkg/generated/models"
+	"github.com/sigstore/rekor/pkg/util"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+)
+
+const integratedTime = 1700000000
+
+// rekorStandIn is an in-process stand-in for Rekor, which records rekord
+// entries without verifying them. Each entry is the only leaf of its own tree,
+// so its inclusion proof is empty and the tree's root hash is its leaf hash.
+type rekorStandIn struct {
+	t       *testing.T
+	signer  signature.SignerVerifier
+	logID   string
+	mu      sync.Mutex
+	entries map[string]models.LogEntryAnon
+	uuids   []string
+}
+
+// newRekorStandIn starts a Rekor stand-in and returns it with its URL.
+func newRekorStandIn(t *testing.T) (*rekorStandIn, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := signature.LoadECDSASignerVerifier(key, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := cryptoutils.MarshalPublicKeyToDER(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &rekorStandIn{t: t, signer: signer, logID: sha256Hex(der), entries: map[string]models.LogEntryAnon{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/log/entries", r.createEntry)
+	mux.HandleFunc("GET /api/v1/log/entries/{uuid}", r.getEntry)
+	mux.HandleFunc("POST /api/v1/index/retrieve", r.searchIndex)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return r, server.URL
+}
+
+// trustedLogs returns the trusted logs holding the stand-in's log.
+func (r *rekorStandIn) trustedLogs() TrustedLogs {
+	return TrustedLogs{r.logID: r.signer}
+}
+
+func (r *rekorStandIn) createEntry(w http.ResponseWriter, req *http.Request) {
+	proposed := &struct {
+		Kind       string `json:"kind"`
+		APIVersion string `json:"apiVersion"`
+		Spec       struct {
+			Data struct {
+				Content []byte `json:"content"`
+			} `json:"data"`
+			Signature json.RawMessage `json:"signature"`
+		} `json:"spec"`
+	}{}
+	if err := json.NewDecoder(req.Body).Decode(proposed); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Rekor replaces the data with its digest in the canonicalized body
+	body, err := json.Marshal(map[string]any{
+		"kind":       proposed.Kind,
+		"apiVersion": proposed.APIVersion,
+		"spec": map[string]any{
+			"data":      map[string]any{"hash": map[string]string{"algorithm": "sha256", "value": sha256Hex(proposed.Spec.Data.Content)}},
+			"signature": proposed.Spec.Signature,
+		},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	uuid, entry := r.record(body)
+	if entry == nil {
+		w.Header().Set("Location", "/api/v1/log/entries/"+uuid)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	writeEntry(w, http.StatusCreated, uuid, *entry)
+}
+
+func (r *rekorStandIn) getEntry(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	entry, found := r.entries[req.PathValue("uuid")]
+	r.mu.Unlock()
+	if !found {
+		http.NotFound(w, req)
+		return
+	}
+	writeEntry(w, http.StatusOK, req.PathValue("uuid"), entry)
+}
+
+// record adds the canonicalized body to the log and returns its UUID and
+// entry, or no entry if the log already records it.
+func (r *rekorStandIn) record(body []byte) (string, *models.LogEntryAnon) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// RFC 6962 leaf hashes are prefixed to distinguish them from node hashes
+	leafDigest := sha256.Sum256(append([]byte{0}, body...))
+	leafHash := leafDigest[:]
+	uuid := hex.EncodeToString(leafHash)
+	if _, exists := r.entries[uuid]; exists {
+		return uuid, nil
+	}
+
+	entry := r.entry(body, int64(len(r.uuids)), integratedTime, leafHash)
+	r.entries[uuid] = entry
+	r.uuids = append(r.uuids, uuid)
+	return uuid, &entry
+}
+
+// entry returns the log entry for the canonicalized body, signed by the log.
+func (r *rekorStandIn) entry(body []byte, logIndex, integratedTime int64, leafHash []byte) models.LogEntryAnon {
+	r.t.Helper()
+	checkpoint, err := util.CreateAndSignCheckpoint(context.Background(), "rekor.test", logIndex, 1, leafHash, r.signer)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+
+	encodedBody := base64.StdEncoding.EncodeToString(body)
+	// The signed entry timestamp is over the canonical JSON encoding, which
+	// for these fields is the encoding of the fields in lexical order
+	bundle, err := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{encodedBody, integratedTime, r.logID, logIndex})
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	set, err := r.signer.SignMessage(bytes.NewReader(bundle))
+	if err != nil {
+		r.t.Fatal(err)
+	}
+
+	return models.LogEntryAnon{
+		Body:           encodedBody,
+		IntegratedTime: swag.Int64(integratedTime),
+		LogID:          swag.String(r.logID),
+		LogIndex:       swag.Int64(logIndex),
+		Verification: &models.LogEntryAnonVerification{
+			InclusionProof: &models.InclusionProof{
+				Checkpoint: swag.String(string(checkpoint)),
+				Hashes:     []string{},
+				LogIndex:   swag.Int64(0),
+				RootHash:   swag.String(hex.EncodeToString(leafHash)),
+				TreeSize:   swag.Int64(1),
+			},
+			SignedEntryTimestamp: set,
+		},
+	}
+}
+
+func writeEntry(w http.ResponseWriter, status int, uuid string, entry models.LogEntryAnon) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.LogEntry{uuid: entry}) //nolint:errcheck
+}
+
+func TestSignerVerify(t *testing.T) {
+	rekor, rekorURL := newRekorStandIn(t)
+	signer, err := NewSigner(essdssh.NewSignerForTest(t, t.TempDir(), "key"), rekorURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	data := []byte("payload")
+
+	sig, ext, err := signer.SignWithExtension(ctx, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	integrated, err := rekor.trustedLogs().Verify(ctx, ext, data, sig, signer.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !integrated.Equal(time.Unix(integratedTime, 0)) {
+		t.Fatalf("unexpected integrated time %s", integrated)
+	}
+
+	// ed25519 signatures are deterministic, so signing again finds the
+	// existing entry
+	sigAgain, extAgain, err := signer.SignWithExtension(ctx, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rekor.uuids) != 1 {
+		t.Fatalf("expected one log entry, got %d", len(rekor.uuids))
+	}
+	if _, err := rekor.trustedLogs().Verify(ctx, extAgain, data, sigAgain, signer.Public()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyMismatch(t *testing.T) {
+	rekor, rekorURL := newRekorStandIn(t)
+	signer, err := NewSigner(essdssh.NewSignerForTest(t, t.TempDir(), "key"), rekorURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	data := []byte("payload")
+
+	sig, ext, err := signer.SignWithExtension(ctx, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSig, err := signer.Sign(ctx, []byte("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		data      []byte
+		sig       []byte
+		publicKey crypto.PublicKey
+	}{
+		"different payload":   {data: []byte("other"), sig: otherSig, publicKey: signer.Public()},
+		"different key":       {data: data, sig: sig, publicKey: essdssh.NewSignerForTest(t, t.TempDir(), "key").Public()},
+		"different signature": {data: data, sig: otherSig, publicKey: signer.Public()},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := rekor.trustedLogs().Verify(ctx, ext, test.data, test.sig, test.publicKey)
+			if !errors.Is(err, ErrLogEntryMismatch) {
+				t.Fatalf("expected ErrLogEntryMismatch, got %v", err)
+			}
+		})
+	}
+
+	if _, err := rekor.trustedLogs().Verify(ctx, nil, data, sig, signer.Public()); !errors.Is(err, ErrNoLogEntry) {
+		t.Fatalf("expected ErrNoLogEntry, got %v", err)
+	}
+
+	// Entries are only trusted when recorded by a trusted log
+	other, _ := newRekorStandIn(t)
+	if _, err := other.trustedLogs().Verify(ctx, ext, data, sig, signer.Public()); !errors.Is(err, ErrUntrustedLog) {
+		t.Fatalf("expected ErrUntrustedLog, got %v", err)
+	}
+}
+
+func TestVerifyEntryTampered(t *testing.T) {
+	rekor, rekorURL := newRekorStandIn(t)
+	signer, err := NewSigner(essdssh.NewSignerForTest(t, t.TempDir(), "key"), rekorURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, _, err := signer.SignWithExtension(ctx, []byte("payload")); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClient(rekorURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := c.Entry(ctx, rekor.uuids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rekor.trustedLogs().VerifyEntry(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	// The signed entry timestamp covers the integrated time
+	entry.IntegratedTime++
+	if err := rekor.trustedLogs().VerifyEntry(ctx, entry); err == nil {
+		t.Fatal("expected error verifying entry with modified integrated time")
+	}
+	entry.IntegratedTime--
+
+	// The inclusion proof covers the body
+	entry.CanonicalizedBody = bytes.Replace(entry.CanonicalizedBody, []byte(sha256Hex([]byte("payload"))), []byte(sha256Hex([]byte("other"))), 1)
+	if err := rekor.trustedLogs().VerifyEntry(ctx, entry); err == nil {
+		t.Fatal("expected error verifying entry with modified body")
+	}
+}
+
+func TestLoadTrustedLog(t *testing.T) {
+	rekor, _ := newRekorStandIn(t)
+	publicKey, err := rekor.signer.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := cryptoutils.MarshalPublicKeyToDER(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "rekor.pub")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	logs, err := LoadTrustedLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, trusted := logs[rekor.logID]; !trusted || len(logs) != 1 {
+		t.Fatalf("unexpected trusted logs %v", logs)
+	}
+
+	if err := os.WriteFile(path, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTrustedLog(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Fatalf("expected error loading invalid key, got %v", err)
+	}
+}
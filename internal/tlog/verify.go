@@ -0,0 +1,212 @@
+package tlog
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/adityasaky/essd/internal/dsse"
+	"github.com/adityasaky/essd/internal/sigstore"
+	"github.com/hiddeco/sshsig"
+	protorekor "github.com/sigstore/protobuf-specs/gen/pb-go/rekor/v1"
+	"github.com/sigstore/rekor/pkg/generated/models"
+	rekorverify "github.com/sigstore/rekor/pkg/verify"
+	"github.com/sigstore/sigstore-go/pkg/root"
+	sigstoretuf "github.com/sigstore/sigstore-go/pkg/tuf"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"golang.org/x/crypto/ssh"
+)
+
+// TrustedLogs maps the hex encoded IDs of trusted transparency logs to
+// verifiers for their signing keys.
+type TrustedLogs map[string]signature.Verifier
+
+// LoadTrustedLogs trusts the transparency log whose PEM encoded public key is
+// at path, or the transparency logs of the Sigstore public good instance if
+// path is empty.
+func LoadTrustedLogs(path string) (TrustedLogs, error) {
+	if path == "" {
+		return SigstoreTrustedLogs()
+	}
+	return LoadTrustedLog(path)
+}
+
+// LoadTrustedLog trusts the transparency log whose PEM encoded public key is
+// at path. The log's ID is derived from its key, as Rekor does.
+func LoadTrustedLog(path string) (TrustedLogs, error) {
+	keyBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := cryptoutils.UnmarshalPEMToPublicKey(keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load transparency log key '%s': %w", path, err)
+	}
+	der, err := cryptoutils.MarshalPublicKeyToDER(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	verifier, err := signature.LoadVerifier(publicKey, crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	return TrustedLogs{sha256Hex(der): verifier}, nil
+}
+
+// SigstoreTrustedLogs trusts the transparency logs of the Sigstore public good
+// instance, as listed in its root of trust.
+func SigstoreTrustedLogs() (TrustedLogs, error) {
+	tufClient, err := sigstoretuf.New(sigstoretuf.DefaultOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	trustedRootJSON, err := tufClient.GetTarget("trusted_root.json")
+	if err != nil {
+		return nil, err
+	}
+	trustedRoot, err := root.NewTrustedRootFromJSON(trustedRootJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	logs := TrustedLogs{}
+	for logID, log := range trustedRoot.RekorLogs() {
+		verifier, err := signature.LoadVerifier(log.PublicKey, log.SignatureHashFunc)
+		if err != nil {
+			return nil, err
+		}
+		logs[logID] = verifier
+	}
+	return logs, nil
+}
+
+// Verify checks that the signature's extension records a log entry for the
+// SSH signature over data by the public key, which was included in one of the
+// trusted logs. The entry's inclusion proof, checkpoint, and signed entry
+// timestamp are verified offline. The time the entry was integrated into the
+// log is returned.
+func (t TrustedLogs) Verify(ctx context.Context, ext *dsse.Extension, data, sig []byte, publicKey crypto.PublicKey) (time.Time, error) {
+	logEntries, err := sigstore.TlogEntries(ext)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(logEntries) == 0 {
+		return time.Time{}, ErrNoLogEntry
+	}
+
+	// Only one entry has to be verified, entries from logs that are not
+	// trusted are ignored
+	errs := []error{}
+	for _, entry := range logEntries {
+		if err := t.verifyEntry(ctx, entry, data, sig, publicKey); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return time.Unix(entry.GetIntegratedTime(), 0).UTC(), nil
+	}
+
+	return time.Time{}, errors.Join(errs...)
+}
+
+// VerifyEntry verifies the entry's inclusion proof, checkpoint, and signed
+// entry timestamp using the log's key.
+func (t TrustedLogs) VerifyEntry(ctx context.Context, entry *protorekor.TransparencyLogEntry) error {
+	logID := hex.EncodeToString(entry.GetLogId().GetKeyId())
+	verifier, trusted := t[logID]
+	if !trusted {
+		return fmt.Errorf("%w: %s", ErrUntrustedLog, logID)
+	}
+
+	if err := rekorverify.VerifyLogEntry(ctx, toLogEntryAnon(entry), verifier); err != nil {
+		return fmt.Errorf("unable to verify transparency log entry %d: %w", entry.GetLogIndex(), err)
+	}
+	return nil
+}
+
+func (t TrustedLogs) verifyEntry(ctx context.Context, entry *protorekor.TransparencyLogEntry, data, sig []byte, publicKey crypto.PublicKey) error {
+	if err := t.VerifyEntry(ctx, entry); err != nil {
+		return err
+	}
+
+	body, err := ParseEntryBody(entry)
+	if err != nil {
+		return err
+	}
+
+	if body.Spec.Data.Hash.Algorithm != models.RekordV001SchemaDataHashAlgorithmSha256 || body.Spec.Data.Hash.Value != sha256Hex(data) {
+		return fmt.Errorf("%w: entry %d records a different payload", ErrLogEntryMismatch, entry.GetLogIndex())
+	}
+
+	entryKey, _, _, _, err := ssh.ParseAuthorizedKey(body.Spec.Signature.PublicKey.Content)
+	if err != nil {
+		return fmt.Errorf("%w: entry %d: %w", ErrLogEntryMismatch, entry.GetLogIndex(), err)
+	}
+	sshKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(entryKey.Marshal(), sshKey.Marshal()) {
+		return fmt.Errorf("%w: entry %d records a different key", ErrLogEntryMismatch, entry.GetLogIndex())
+	}
+
+	// Rekor stores signatures re-armored, so the signatures are compared once
+	// unarmored
+	entrySig, err := sshsig.Unarmor(body.Spec.Signature.Content)
+	if err != nil {
+		return fmt.Errorf("%w: entry %d: %w", ErrLogEntryMismatch, entry.GetLogIndex(), err)
+	}
+	envelopeSig, err := sshsig.Unarmor(sig)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(ssh.Marshal(entrySig.Signature), ssh.Marshal(envelopeSig.Signature)) {
+		return fmt.Errorf("%w: entry %d records a different signature", ErrLogEntryMismatch, entry.GetLogIndex())
+	}
+
+	return nil
+}
+
+// EntryBody is the canonicalized body of a rekord log entry.
+type EntryBody struct {
+	Kind       string `json:"kind"`
+	APIVersion string `json:"apiVersion"`
+	Spec       struct {
+		Data struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+		Signature struct {
+			Format    string `json:"format"`
+			Content   []byte `json:"content"`
+			PublicKey struct {
+				Content []byte `json:"content"`
+			} `json:"publicKey"`
+		} `json:"signature"`
+	} `json:"spec"`
+}
+
+// ParseEntryBody decodes the body of a log entry, which must be an SSH
+// rekord entry.
+func ParseEntryBody(entry *protorekor.TransparencyLogEntry) (*EntryBody, error) {
+	body := &EntryBody{}
+	if err := json.Unmarshal(entry.GetCanonicalizedBody(), body); err != nil {
+		return nil, fmt.Errorf("%w: entry %d: %w", ErrLogEntryMismatch, entry.GetLogIndex(), err)
+	}
+	if body.Kind != entryKind || body.APIVersion != entryAPIVersion || body.Spec.Signature.Format != models.RekordV001SchemaSignatureFormatSSH {
+		return nil, fmt.Errorf("%w: entry %d is a %s %s entry", ErrLogEntryMismatch, entry.GetLogIndex(), body.Kind, body.APIVersion)
+	}
+	return body, nil
+}